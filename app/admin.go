@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"main/auth"
+	"os"
+	"strings"
+)
+
+// admin -username alice < password.txt sets a password, creating the
+// admin if needed. admin -username alice -revoke signs alice out everywhere.
+func runAdmin(args []string) error {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	username := flags.String("username", "", "admin username")
+	revoke := flags.Bool("revoke", false, "revoke every session instead of setting the password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	if *revoke {
+		adminId, err := auth.AdminId(*username)
+		if err != nil {
+			return err
+		}
+		revoked, err := auth.RevokeAll(adminId)
+		if err != nil {
+			return err
+		}
+		log.Printf("Revoked %d sessions of %s", revoked, *username)
+		return nil
+	}
+
+	// Read from stdin so the password stays out of shell history
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("no password on stdin")
+	}
+
+	created, err := auth.SetPassword(*username, strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Created admin %s", *username)
+	} else {
+		log.Printf("Changed password of %s and revoked its sessions", *username)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"main/audit"
+	"main/message"
+	"main/ws"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CodeAlreadyRestored = "already_restored"
+	CodeNotRestorable   = "not_restorable"
+
+	// Admin sessions only, see server.AdminChannels
+	auditChannel = "audit"
+)
+
+// Who is behind a write, for the audit log
+func auditActor(r *http.Request) message.AuditActor {
+	actor := message.AuditActor{
+		Ip:        clientIp(r),
+		RequestId: RequestId(r),
+	}
+
+	principal := CurrentPrincipal(r)
+	if principal == nil {
+		return actor
+	}
+	actor.AdminId = principal.AdminId
+	actor.Username = principal.Username
+	actor.Type = audit.ActorSession
+	if principal.Token != nil {
+		actor.Type = audit.ActorToken
+		actor.TokenId = principal.Token.Id
+		actor.TokenName = principal.Token.Name
+	}
+	return actor
+}
+
+// Records a committed write and streams it to admins. The write already
+// happened, so a failure here is logged rather than returned.
+func recordAudit(r *http.Request, wsServer *ws.Server, entries []message.AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	entries, err := audit.Record(auditActor(r), entries)
+	if err != nil {
+		log.Printf("[%s] Audit log error: %v", RequestId(r), err)
+		return
+	}
+	broadcastAudit(wsServer, entries)
+}
+
+func broadcastAudit(wsServer *ws.Server, entries []message.AuditEntry) {
+	for _, entry := range entries {
+		wsServer.Broadcast <- message.Message{
+			Type:    "audit_entry",
+			Channel: auditChannel,
+			Data:    entry,
+		}
+	}
+}
+
+// A project write from before and after snapshots, nil for one that
+// does not exist on that side
+type projectChange struct {
+	before *message.Project
+	after  *message.Project
+}
+
+func recordProjectChanges(r *http.Request, wsServer *ws.Server, changes ...projectChange) {
+	entries := []message.AuditEntry{}
+	for _, c := range changes {
+		entries = append(entries, audit.Changes(c.before, c.after)...)
+	}
+	recordAudit(r, wsServer, entries)
+}
+
+// GET /api/audit lists entries newest first. Filters: entity, action,
+// projectId, entityId, actorType, actor (username), since and until
+// (RFC 3339), before (an entry id, for paging) and limit up to 500.
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	filter, errs := auditFilter(r)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	entries, err := audit.List(filter)
+	if err != nil {
+		writeInternalError(w, r, "Audit log error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func auditFilter(r *http.Request) (audit.Filter, message.ValidationErrors) {
+	query := r.URL.Query()
+	errs := message.ValidationErrors{}
+	filter := audit.Filter{
+		Entity:    query.Get("entity"),
+		Action:    query.Get("action"),
+		ActorType: query.Get("actorType"),
+		Actor:     query.Get("actor"),
+		Limit:     100,
+	}
+
+	oneOf := func(field, value string, allowed []string) {
+		if value != "" && !slices.Contains(allowed, value) {
+			errs = append(errs, message.FieldError{
+				Field:   field,
+				Code:    message.CodeInvalidValue,
+				Message: "must be one of " + strings.Join(allowed, ", "),
+			})
+		}
+	}
+	oneOf("entity", filter.Entity, audit.Entities)
+	oneOf("action", filter.Action, audit.Actions)
+	oneOf("actorType", filter.ActorType, []string{audit.ActorSession, audit.ActorToken})
+
+	number := func(field string, max int) int {
+		value := query.Get(field)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || (max > 0 && n > max) {
+			msg := "must be a positive integer"
+			if max > 0 {
+				msg = "must be between 1 and " + strconv.Itoa(max)
+			}
+			errs = append(errs, message.FieldError{Field: field, Code: message.CodeInvalidValue, Message: msg})
+		}
+		return n
+	}
+	filter.ProjectId = number("projectId", 0)
+	filter.EntityId = number("entityId", 0)
+	filter.Before = number("before", 0)
+	if limit := number("limit", 500); limit > 0 {
+		filter.Limit = limit
+	}
+
+	timestamp := func(field string) time.Time {
+		value := query.Get(field)
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, message.FieldError{
+				Field:   field,
+				Code:    message.CodeInvalidValue,
+				Message: "must be an RFC 3339 time",
+			})
+		}
+		return t
+	}
+	filter.Since = timestamp("since")
+	filter.Until = timestamp("until")
+
+	return filter, errs
+}
+
+// POST /api/audit/{id}/restore brings back the project a delete entry
+// recorded, media and links included. It gets a new id; the entry can
+// only be restored once, which the audit database enforces as the
+// restore entries commit together with the project.
+func AuditRestoreHandler(wsServer *ws.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+
+		idStr, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/audit/"), "/restore")
+		if !ok {
+			writeNotFound(w, r)
+			return
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			writeInvalidId(w, r)
+			return
+		}
+
+		entry, err := audit.Get(id)
+		if errors.Is(err, audit.ErrNoEntry) {
+			WriteError(w, r, http.StatusNotFound, CodeNotFound, "Audit entry not found", nil)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Restore load error", err)
+			return
+		}
+		if entry.Entity != audit.EntityProject || entry.Action != audit.ActionDelete {
+			WriteError(w, r, http.StatusConflict, CodeNotRestorable, "Only project deletions can be restored", nil)
+			return
+		}
+
+		restoredBy, err := audit.RestoredBy(id)
+		if err != nil {
+			writeInternalError(w, r, "Restore lookup error", err)
+			return
+		}
+		if restoredBy != 0 {
+			writeAlreadyRestored(w, r, restoredBy)
+			return
+		}
+
+		var snapshot message.Project
+		if err := json.Unmarshal(entry.Before, &snapshot); err != nil {
+			writeInternalError(w, r, "Restore snapshot error", err)
+			return
+		}
+		photos, videos := mediaURLs(snapshot.Media)
+		req := message.CreateProjectRequest{
+			Name:   snapshot.Name,
+			Desc:   snapshot.Desc,
+			Repo:   snapshot.Repo,
+			Photos: photos,
+			Videos: videos,
+			Links:  snapshot.Links,
+		}
+		// Rules may have tightened since the project was saved
+		if errs := req.Validate(); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+
+		tx, err := beginProjectTx("audit")
+		if err != nil {
+			writeInternalError(w, r, "Restore transaction error", err)
+			return
+		}
+		defer tx.rollback()
+
+		projectId, err := tx.createProject(req)
+		if err != nil {
+			writeInternalError(w, r, "Restore project error", err)
+			return
+		}
+		restored, err := tx.snapshot(int(projectId))
+		if err != nil {
+			writeInternalError(w, r, "Restore snapshot error", err)
+			return
+		}
+		// A concurrent restore of the same entry got there first
+		entries, err := audit.RecordTx(tx.tx, auditActor(r), audit.Restored(&restored, id))
+		if errors.Is(err, audit.ErrAlreadyRestored) {
+			tx.rollback()
+			restoredBy, _ := audit.RestoredBy(id)
+			writeAlreadyRestored(w, r, restoredBy)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Restore audit error", err)
+			return
+		}
+		if err := tx.commit(); err != nil {
+			writeInternalError(w, r, "Restore commit error", err)
+			return
+		}
+
+		projectsCache.invalidate()
+		wsServer.Broadcast <- message.Message{
+			Type:    "project_created",
+			Channel: "projects",
+			Data: map[string]interface{}{
+				"id":      projectId,
+				"name":    req.Name,
+				"version": 1,
+			},
+		}
+		broadcastAudit(wsServer, entries)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message.RestoreResponse{
+			Id:      projectId,
+			Message: "Project restored successfully",
+		})
+	}
+}
+
+func writeAlreadyRestored(w http.ResponseWriter, r *http.Request, restoredBy int) {
+	WriteError(
+		w, r,
+		http.StatusConflict,
+		CodeAlreadyRestored,
+		"Audit entry was already restored",
+		map[string]int{"restoredBy": restoredBy},
+	)
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"main/auth"
+	"main/message"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeInsufficientScope  = "insufficient_scope"
+
+	sessionCookie = "session"
+)
+
+type principalKey struct{}
+
+type resolvedPrincipal struct {
+	principal *auth.Principal
+	err       error
+}
+
+// Resolve Principal once per request. Everything after it reads the
+// result from the context instead of the auth database.
+func ResolvePrincipal(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := lookupPrincipal(r)
+		next(w, r.WithContext(context.WithValue(
+			r.Context(),
+			principalKey{},
+			resolvedPrincipal{principal, err},
+		)))
+	}
+}
+
+// Principal the request acts as, nil when anonymous. A bearer token
+// that does not check out is an error rather than anonymous, so a
+// client with a broken token finds out instead of reading public data.
+func resolvePrincipal(r *http.Request) (*auth.Principal, error) {
+	if resolved, ok := r.Context().Value(principalKey{}).(resolvedPrincipal); ok {
+		return resolved.principal, resolved.err
+	}
+	return lookupPrincipal(r)
+}
+
+// Principal stored in ctx, for code that only has the context
+func contextPrincipal(ctx context.Context) *auth.Principal {
+	resolved, _ := ctx.Value(principalKey{}).(resolvedPrincipal)
+	return resolved.principal
+}
+
+func lookupPrincipal(r *http.Request) (*auth.Principal, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, plain, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return nil, auth.ErrInvalidToken
+		}
+		token, err := auth.AuthenticateToken(strings.TrimSpace(plain))
+		if err != nil {
+			return nil, err
+		}
+		return &auth.Principal{AdminId: token.AdminId, Username: token.Username, Token: token}, nil
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	session, err := auth.Authenticate(cookie.Value)
+	if err != nil {
+		return nil, nil
+	}
+	return auth.SessionPrincipal(session), nil
+}
+
+func CurrentPrincipal(r *http.Request) *auth.Principal {
+	principal, _ := resolvePrincipal(r)
+	return principal
+}
+
+// Session the request was authenticated with, nil when anonymous or
+// signed in with a token
+func CurrentSession(r *http.Request) *auth.Session {
+	if principal := CurrentPrincipal(r); principal != nil {
+		return principal.Session
+	}
+	return nil
+}
+
+// Checks whether the session r signed in with is still live, for
+// connections that outlast the request. Nil when r has no session.
+func SessionCheck(r *http.Request) func() bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || CurrentSession(r) == nil {
+		return nil
+	}
+	return func() bool {
+		return auth.Active(cookie.Value)
+	}
+}
+
+func withPrincipal(r *http.Request, principal *auth.Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, resolvedPrincipal{principal: principal}))
+}
+
+// Require Admin, signed in through the browser. Tokens cannot manage
+// sessions or other tokens.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := CurrentSession(r)
+		if session == nil {
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Sign in required", nil)
+			return
+		}
+		next(w, withPrincipal(r, auth.SessionPrincipal(session)))
+	}
+}
+
+// Reads stay public, anything that changes data needs an admin session
+// or a token with projects:write. A token used for reading needs
+// projects:read.
+func ProjectAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := resolvePrincipal(r)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidToken) {
+				log.Printf("[%s] Token error: %v", RequestId(r), err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			WriteError(w, r, http.StatusUnauthorized, CodeInvalidToken, "Invalid or expired token", nil)
+			return
+		}
+
+		scope := auth.ScopeProjectsWrite
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if principal == nil {
+				next(w, r)
+				return
+			}
+			scope = auth.ScopeProjectsRead
+		}
+
+		if principal == nil {
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Sign in required", nil)
+			return
+		}
+		r = withPrincipal(r, principal)
+		if !requireScope(w, r, scope) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Writes a 403 and returns false when the principal lacks scope
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if CurrentPrincipal(r).Can(scope) {
+		return true
+	}
+	writeInsufficientScope(w, r, scope)
+	return false
+}
+
+func writeInsufficientScope(w http.ResponseWriter, r *http.Request, scope string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+	WriteError(
+		w, r,
+		http.StatusForbidden,
+		CodeInsufficientScope,
+		"Token is missing the "+scope+" scope",
+		map[string]string{"required": scope},
+	)
+}
+
+// Changing photos or videos needs media:write on top of projects:write
+func mediaChanged(current []message.Media, photos []string, videos []string) bool {
+	currentPhotos, currentVideos := mediaURLs(current)
+	return !slices.Equal(currentPhotos, photos) || !slices.Equal(currentVideos, videos)
+}
+
+func mediaURLs(media []message.Media) (photos []string, videos []string) {
+	for _, m := range media {
+		if m.Type == "photo" {
+			photos = append(photos, m.URL)
+		} else {
+			videos = append(videos, m.URL)
+		}
+	}
+	return photos, videos
+}
+
+// Login
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	limitBody(w, r)
+
+	var req message.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	token, session, err := auth.Login(req.Username, req.Password, r.UserAgent(), clientIp(r))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidCredentials, "Invalid username or password", nil)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Login error", err)
+		return
+	}
+
+	setSessionCookie(w, r, token, session.ExpiresAt)
+	writeSession(w, session)
+}
+
+// Logout
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := auth.Revoke(cookie.Value); err != nil {
+			writeInternalError(w, r, "Logout error", err)
+			return
+		}
+	}
+
+	clearSessionCookie(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET reports the current session, DELETE signs the admin out everywhere
+func SessionHandler(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		if session == nil {
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Not signed in", nil)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeSession(w, session)
+
+	case http.MethodDelete:
+		if session == nil {
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Sign in required", nil)
+			return
+		}
+		revoked, err := auth.RevokeAll(session.AdminId)
+		if err != nil {
+			writeInternalError(w, r, "Revoke sessions error", err)
+			return
+		}
+		clearSessionCookie(w, r)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(message.RevokeSessionsResponse{Revoked: revoked})
+
+	default:
+		WriteMethodNotAllowed(w, r)
+	}
+}
+
+func writeSession(w http.ResponseWriter, session *auth.Session) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message.SessionResponse{
+		Username:  session.Username,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+//
+// Cookie
+//
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(time.Until(expires).Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: auth.Settings().SameSite,
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: auth.Settings().SameSite,
+	})
+}
+
+func secureRequest(r *http.Request) bool {
+	return auth.Settings().Secure || tlsRequest(r)
+}
+
+// Behind a proxy every request comes from the proxy. Only then is
+// X-Forwarded-For trusted, and only the entry the proxy added.
+var trustProxy bool
+
+func SetTrustProxy(trust bool) {
+	trustProxy = trust
+}
+
+func clientIp(r *http.Request) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/tls"
+	"main/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIp(t *testing.T) {
+	defer SetTrustProxy(false)
+
+	tests := []struct {
+		name      string
+		trust     bool
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"remote address", false, "192.0.2.1:5000", nil, "192.0.2.1"},
+		{"IPv6", false, "[2001:db8::1]:5000", nil, "2001:db8::1"},
+		{"no port", false, "192.0.2.1", nil, "192.0.2.1"},
+		{"untrusted header", false, "192.0.2.1:5000", []string{"203.0.113.9"}, "192.0.2.1"},
+		{"trusted header", true, "192.0.2.1:5000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"entry the proxy added", true, "192.0.2.1:5000", []string{"10.0.0.1, 203.0.113.9"}, "203.0.113.9"},
+		{"last header", true, "192.0.2.1:5000", []string{"10.0.0.1", "203.0.113.9 "}, "203.0.113.9"},
+		{"empty entry", true, "192.0.2.1:5000", []string{"203.0.113.9,"}, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		SetTrustProxy(tt.trust)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIp(r); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSecureRequest(t *testing.T) {
+	defer SetTrustProxy(false)
+	defer auth.SetConfig(auth.Config{})
+
+	tests := []struct {
+		name   string
+		secure bool
+		trust  bool
+		tls    bool
+		proto  string
+		want   bool
+	}{
+		{"plain", false, false, false, "", false},
+		{"configured", true, false, false, "", true},
+		{"TLS", false, false, true, "", true},
+		{"untrusted proxy", false, false, false, "https", false},
+		{"trusted proxy", false, true, false, "https", true},
+		{"trusted proxy over HTTP", false, true, false, "http", false},
+	}
+
+	for _, tt := range tests {
+		auth.SetConfig(auth.Config{Secure: tt.secure})
+		SetTrustProxy(tt.trust)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		if got := secureRequest(r); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	defer auth.SetConfig(auth.Config{})
+	auth.SetConfig(auth.Config{SameSite: http.SameSiteStrictMode})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	setSessionCookie(w, r, "token", time.Now().Add(time.Hour))
+	cookie := w.Result().Cookies()[0]
+	if cookie.Name != sessionCookie || cookie.Value != "token" || !cookie.HttpOnly || cookie.Secure ||
+		cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge < 3590 {
+		t.Errorf("got %+v", cookie)
+	}
+
+	w = httptest.NewRecorder()
+	clearSessionCookie(w, r)
+	if cookie := w.Result().Cookies()[0]; cookie.Value != "" || cookie.MaxAge != -1 {
+		t.Errorf("got %+v", cookie)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	called := false
+	handler := RequireAdmin(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	token := &auth.Principal{Token: &auth.Token{Scopes: auth.Scopes}}
+	r := withPrincipal(httptest.NewRequest(http.MethodGet, "/api/tokens", nil), token)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if called || w.Code != http.StatusUnauthorized {
+		t.Errorf("token: got %d, called %v", w.Code, called)
+	}
+
+	session := auth.SessionPrincipal(&auth.Session{AdminId: 1, Username: "admin"})
+	handler(httptest.NewRecorder(), withPrincipal(httptest.NewRequest(http.MethodGet, "/api/tokens", nil), session))
+	if !called {
+		t.Error("session was refused")
+	}
+}
+
+func TestProjectAccess(t *testing.T) {
+	reader := &auth.Principal{Token: &auth.Token{Scopes: []string{auth.ScopeProjectsRead}}}
+	writer := &auth.Principal{Token: &auth.Token{Scopes: []string{auth.ScopeProjectsWrite}}}
+	admin := auth.SessionPrincipal(&auth.Session{AdminId: 1})
+
+	tests := []struct {
+		name      string
+		method    string
+		principal *auth.Principal
+		status    int
+	}{
+		{"public read", http.MethodGet, nil, http.StatusOK},
+		{"token read", http.MethodGet, reader, http.StatusOK},
+		{"read without the scope", http.MethodHead, writer, http.StatusForbidden},
+		{"anonymous write", http.MethodPost, nil, http.StatusUnauthorized},
+		{"write without the scope", http.MethodPut, reader, http.StatusForbidden},
+		{"token write", http.MethodDelete, writer, http.StatusOK},
+		{"session write", http.MethodPatch, admin, http.StatusOK},
+	}
+
+	handler := ProjectAccess(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		r := withPrincipal(httptest.NewRequest(tt.method, "/api/projects", nil), tt.principal)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if tt.status == http.StatusForbidden && decodeError(t, w).Code != CodeInsufficientScope {
+			t.Errorf("%s: got %s", tt.name, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+	r.Header.Set("Authorization", "Bearer nonsense")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer error="invalid_token"` {
+		t.Errorf("bad token: got %d %v", w.Code, w.Header())
+	}
+}
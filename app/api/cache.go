@@ -0,0 +1,140 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"main/message"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheControl = "public, max-age=0, must-revalidate"
+
+type CachePolicy struct {
+	List string
+	Item string
+}
+
+var cachePolicy = CachePolicy{
+	List: defaultCacheControl,
+	Item: defaultCacheControl,
+}
+
+// Set Cache Policy
+func SetCachePolicy(policy CachePolicy) {
+	if policy.List == "" {
+		policy.List = defaultCacheControl
+	}
+	if policy.Item == "" {
+		policy.Item = defaultCacheControl
+	}
+	cachePolicy = policy
+}
+
+// Serialized project list with its validators, rebuilt lazily
+// after any create, update or delete
+type cacheEntry struct {
+	projects     []message.Project
+	body         []byte
+	etag         string
+	lastModified time.Time
+}
+
+type projectListCache struct {
+	mutex       sync.Mutex
+	entry       *cacheEntry
+	invalidated time.Time
+}
+
+var projectsCache = &projectListCache{}
+
+func (c *projectListCache) get() (*cacheEntry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entry != nil {
+		return c.entry, nil
+	}
+
+	projects, err := getAllProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(projects)
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, '\n')
+
+	// Deletes leave no updatedAt behind, so the invalidation time counts too
+	lastModified := c.invalidated
+	for _, p := range projects {
+		if p.UpdatedAt.After(lastModified) {
+			lastModified = p.UpdatedAt
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	c.entry = &cacheEntry{
+		projects:     projects,
+		body:         body,
+		etag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+		lastModified: lastModified,
+	}
+	return c.entry, nil
+}
+
+func (c *projectListCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entry = nil
+	c.invalidated = time.Now().UTC()
+}
+
+// Strong validators differ per representation, so other API versions
+// tag theirs with the version name
+func versionETag(etag string, version string) string {
+	return `"` + version + "-" + strings.Trim(etag, `"`) + `"`
+}
+
+// Validators
+func setValidators(
+	w http.ResponseWriter,
+	etag string,
+	lastModified time.Time,
+	cacheControl string,
+) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+}
+
+// If-None-Match wins over If-Modified-Since when both are sent
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = decodedETag(strings.TrimPrefix(strings.TrimSpace(tag), "W/"))
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
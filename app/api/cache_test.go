@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := `"abc"`
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500, time.UTC)
+	at := func(d time.Duration) string {
+		return modified.Add(d).Format(http.TimeFormat)
+	}
+
+	tests := []struct {
+		name        string
+		noneMatch   string
+		since       string
+		modified    time.Time
+		notModified bool
+	}{
+		{"no validators", "", "", modified, false},
+		{"same tag", `"abc"`, "", modified, true},
+		{"weak tag", `W/"abc"`, "", modified, true},
+		{"one of several", `"x", "abc"`, "", modified, true},
+		{"gzip copy", `"abc-gzip"`, "", modified, true},
+		{"star", "*", "", modified, true},
+		{"other tag", `"abd"`, "", modified, false},
+		{"tag wins over date", `"abd"`, at(time.Hour), modified, false},
+		{"same second", "", at(0), modified, true},
+		{"later", "", at(time.Hour), modified, true},
+		{"earlier", "", at(-time.Second), modified, false},
+		{"bad date", "", "yesterday", modified, false},
+		{"no last modified", "", at(time.Hour), time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+		if tt.noneMatch != "" {
+			r.Header.Set("If-None-Match", tt.noneMatch)
+		}
+		if tt.since != "" {
+			r.Header.Set("If-Modified-Since", tt.since)
+		}
+		if got := notModified(r, etag, tt.modified); got != tt.notModified {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.notModified)
+		}
+	}
+}
+
+func TestVersionETag(t *testing.T) {
+	if got := versionETag(`"abc"`, V2); got != `"v2-abc"` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestSetValidators(t *testing.T) {
+	w := httptest.NewRecorder()
+	setValidators(w, `"abc"`, time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("x", 3600)), "no-cache")
+
+	h := w.Header()
+	if h.Get("ETag") != `"abc"` || h.Get("Cache-Control") != "no-cache" {
+		t.Errorf("got %v", h)
+	}
+	if got := h.Get("Last-Modified"); got != "Sun, 01 Mar 2026 11:00:00 GMT" {
+		t.Errorf("got Last-Modified %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	setValidators(w, `"abc"`, time.Time{}, "no-cache")
+	if _, ok := w.Header()["Last-Modified"]; ok {
+		t.Error("zero time sent as Last-Modified")
+	}
+}
+
+func TestSetCachePolicy(t *testing.T) {
+	defer SetCachePolicy(CachePolicy{})
+
+	SetCachePolicy(CachePolicy{List: "public, max-age=60"})
+	if cachePolicy.List != "public, max-age=60" || cachePolicy.Item != defaultCacheControl {
+		t.Errorf("got %+v", cachePolicy)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"main/ws"
 	"net/http"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type ClientsUpdate struct {
@@ -15,9 +17,26 @@ type ClientsUpdate struct {
 	Clients   []string `json:"clients"`
 }
 
+type ClientDetail struct {
+	Id       string   `json:"id"`
+	Channels []string `json:"channels"`
+}
+
+type ClientsSnapshot struct {
+	Type      string         `json:"type"`
+	Count     int            `json:"count"`
+	Timestamp string         `json:"timestamp"`
+	Clients   []string       `json:"clients"`
+	Details   []ClientDetail `json:"details"`
+}
+
 func ClientsConnectedHandler(s *ws.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Upgrade") == "websocket" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+		if websocket.IsWebSocketUpgrade(r) {
 			setClientCount(s, w, r)
 			return
 		}
@@ -84,9 +103,14 @@ func setClientCount(
 
 // Display
 func displayClientCount(s *ws.Server, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clientsSnapshot(s))
+}
+
+func clientsSnapshot(s *ws.Server) ClientsSnapshot {
 	s.Mutex.RLock()
 	clientIds := make([]string, 0, len(s.Clients))
-	clientDetails := make([]map[string]interface{}, 0, len(s.Clients))
+	clientDetails := make([]ClientDetail, 0, len(s.Clients))
 
 	for id, client := range s.Clients {
 		clientIds = append(clientIds, id)
@@ -96,22 +120,19 @@ func displayClientCount(s *ws.Server, w http.ResponseWriter) {
 			channels = append(channels, ch)
 		}
 
-		clientDetails = append(clientDetails, map[string]interface{}{
-			"id":       id,
-			"channels": channels,
+		clientDetails = append(clientDetails, ClientDetail{
+			Id:       id,
+			Channels: channels,
 		})
 	}
 	count := len(s.Clients)
 	s.Mutex.RUnlock()
 
-	data := map[string]interface{}{
-		"type":      "clientsSnapshot",
-		"count":     count,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"clients":   clientIds,
-		"details":   clientDetails,
+	return ClientsSnapshot{
+		Type:      "clientsSnapshot",
+		Count:     count,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Clients:   clientIds,
+		Details:   clientDetails,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
 }
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"main/static"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Brotli is left out, the standard library has no encoder. Scripts and
+// styles with a .br copy on disk are still served as brotli by the
+// static package.
+type CompressionConfig struct {
+	Off bool
+	// Smaller responses go out as they are
+	MinSize int
+	Level   int
+	// Content types worth compressing, without parameters
+	Types []string
+}
+
+var compression CompressionConfig
+
+var defaultCompressTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/problem+json",
+	"application/feed+json",
+	"application/manifest+json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+func init() {
+	SetCompression(CompressionConfig{})
+}
+
+// Set Compression, empty fields keep their default
+func SetCompression(c CompressionConfig) {
+	if c.MinSize <= 0 {
+		c.MinSize = 1024
+	}
+	if c.Level == 0 {
+		c.Level = gzip.DefaultCompression
+	}
+	if len(c.Types) == 0 {
+		c.Types = defaultCompressTypes
+	}
+	compression = c
+	gzipPool = sync.Pool{}
+	deflatePool = sync.Pool{}
+}
+
+var (
+	gzipPool    sync.Pool
+	deflatePool sync.Pool
+)
+
+// Compress the response with gzip or deflate when the client takes it
+// and the body is big enough and of a listed type. WebSocket upgrades
+// and range requests pass through untouched, as do responses that are
+// already encoded.
+func Compress(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if compression.Off ||
+			r.Method == http.MethodHead ||
+			r.Header.Get("Range") != "" ||
+			websocket.IsWebSocketUpgrade(r) {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			request:        r,
+			encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+			status:         http.StatusOK,
+		}
+		defer cw.close()
+		next(cw, r)
+	}
+}
+
+// gzip wins when both are taken
+func negotiateEncoding(header string) string {
+	for _, coding := range []string{"gzip", "deflate"} {
+		if static.AcceptsEncoding(header, coding) {
+			return coding
+		}
+	}
+	return ""
+}
+
+// Holds the body back until it is clear whether it is worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	request  *http.Request
+	encoding string
+	status   int
+
+	buf         []byte
+	decided     bool
+	wroteHeader bool
+	zw          compressor
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	// Informational responses go straight out, the real one follows
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < compression.MinSize && !cw.lengthKnownLarge() {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// A handler that announced a large body need not be buffered
+func (cw *compressWriter) lengthKnownLarge() bool {
+	n, err := strconv.Atoi(cw.Header().Get("Content-Length"))
+	return err == nil && n >= compression.MinSize
+}
+
+// Sends the headers and whatever is buffered, compressed or not
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	eligible := cw.eligible()
+	if eligible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if eligible && cw.encoding != "" && len(cw.buf) >= compression.MinSize {
+		// A different representation needs a validator of its own.
+		// Ranges would count the uncompressed bytes.
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Del("Content-Range")
+		h.Set("Content-Encoding", cw.encoding)
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", encodedETag(etag, cw.encoding))
+		}
+		cw.zw = getCompressor(cw.encoding, cw.ResponseWriter)
+	}
+	cw.revalidated()
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// A 304 confirms the tag the client holds, which for a compressed copy
+// is the encoded one. The body it stands for is not known here.
+func (cw *compressWriter) revalidated() {
+	h := cw.Header()
+	etag := h.Get("ETag")
+	if cw.status != http.StatusNotModified || etag == "" || cw.encoding == "" {
+		return
+	}
+
+	encoded := encodedETag(etag, cw.encoding)
+	for _, tag := range strings.Split(cw.request.Header.Get("If-None-Match"), ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(encoded, "W/") {
+			h.Set("ETag", encoded)
+			h.Add("Vary", "Accept-Encoding")
+			return
+		}
+	}
+}
+
+// "abc" becomes "abc-gzip", keeping a W/ prefix
+func encodedETag(etag string, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// The tag a client sends back for a compressed copy, as the handler
+// that made it knows it
+func decodedETag(tag string) string {
+	for _, coding := range []string{"gzip", "deflate"} {
+		if trimmed, ok := strings.CutSuffix(tag, "-"+coding+`"`); ok {
+			return trimmed + `"`
+		}
+	}
+	return tag
+}
+
+func (cw *compressWriter) eligible() bool {
+	switch {
+	case cw.status < http.StatusOK,
+		cw.status == http.StatusNoContent,
+		cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	contentType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return slices.Contains(compression.Types, contentType)
+}
+
+// Streaming handlers flush before the body is complete, which settles
+// the decision with what has been written so far
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return
+		}
+	}
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// For http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && (cw.wroteHeader || len(cw.buf) > 0) {
+		cw.decide()
+	}
+	if cw.zw != nil {
+		cw.zw.Close()
+		putCompressor(cw.encoding, cw.zw)
+		cw.zw = nil
+	}
+}
+
+func getCompressor(encoding string, w io.Writer) compressor {
+	if encoding == "gzip" {
+		if zw, ok := gzipPool.Get().(*gzip.Writer); ok {
+			zw.Reset(w)
+			return zw
+		}
+		zw, err := gzip.NewWriterLevel(w, compression.Level)
+		if err != nil {
+			zw = gzip.NewWriter(w)
+		}
+		return zw
+	}
+
+	// HTTP's deflate is the zlib format, not a bare deflate stream
+	if zw, ok := deflatePool.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+	zw, err := zlib.NewWriterLevel(w, compression.Level)
+	if err != nil {
+		zw = zlib.NewWriter(w)
+	}
+	return zw
+}
+
+func putCompressor(encoding string, zw compressor) {
+	if encoding == "gzip" {
+		gzipPool.Put(zw)
+	} else {
+		deflatePool.Put(zw)
+	}
+}
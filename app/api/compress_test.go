@@ -0,0 +1,276 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"gzip, deflate, br", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"br", ""},
+		{"identity", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestETagEncoding(t *testing.T) {
+	tests := []struct {
+		etag    string
+		enc     string
+		encoded string
+	}{
+		{`"abc"`, "gzip", `"abc-gzip"`},
+		{`W/"abc"`, "deflate", `W/"abc-deflate"`},
+		{`abc`, "gzip", `abc`},
+	}
+
+	for _, tt := range tests {
+		got := encodedETag(tt.etag, tt.enc)
+		if got != tt.encoded {
+			t.Errorf("%s with %s: got %s, want %s", tt.etag, tt.enc, got, tt.encoded)
+		}
+		if back := decodedETag(got); back != tt.etag {
+			t.Errorf("%s: decoded to %s", got, back)
+		}
+	}
+	if got := decodedETag(`"abc-br"`); got != `"abc-br"` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name": "project"}`, 100)
+
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		response func(w http.ResponseWriter)
+		encoding string
+	}{
+		{
+			"json", http.MethodGet, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"gzip",
+		},
+		{
+			"deflate", http.MethodGet, map[string]string{"Accept-Encoding": "deflate"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				io.WriteString(w, large)
+			},
+			"deflate",
+		},
+		{
+			"sniffed", http.MethodGet, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) { io.WriteString(w, "<!DOCTYPE html>"+large) },
+			"gzip",
+		},
+		{
+			"small", http.MethodGet, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{}`)
+			},
+			"",
+		},
+		{
+			"image", http.MethodGet, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, large)
+			},
+			"",
+		},
+		{
+			"not accepted", http.MethodGet, nil,
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"",
+		},
+		{
+			"already encoded", http.MethodGet, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, large)
+			},
+			"br",
+		},
+		{
+			"range", http.MethodGet, map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-9"},
+			func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"",
+		},
+		{
+			"no content", http.MethodDelete, map[string]string{"Accept-Encoding": "gzip"},
+			func(w http.ResponseWriter) { w.WriteHeader(http.StatusNoContent) },
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		handler := Compress(func(w http.ResponseWriter, r *http.Request) { tt.response(w) })
+		r := httptest.NewRequest(tt.method, "/api/projects", nil)
+		for key, value := range tt.header {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: got encoding %q, want %q", tt.name, got, tt.encoding)
+			continue
+		}
+
+		var body io.Reader = w.Body
+		switch tt.encoding {
+		case "gzip":
+			body, _ = gzip.NewReader(w.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(w.Body)
+		}
+		got, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.encoding != "" && tt.encoding != "br" && !strings.HasSuffix(string(got), large) {
+			t.Errorf("%s: body did not survive: %.40q", tt.name, got)
+		}
+	}
+}
+
+func TestCompressHeaders(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+	handler := Compress(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", "text/plain")
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		h.Set("Accept-Ranges", "bytes")
+		h.Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	h := w.Header()
+	if w.Code != http.StatusCreated || h.Get("ETag") != `"v1-gzip"` || h.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("got %d %v", w.Code, h)
+	}
+	for _, gone := range []string{"Content-Length", "Accept-Ranges"} {
+		if h.Get(gone) != "" {
+			t.Errorf("%s was kept", gone)
+		}
+	}
+}
+
+// A 304 for the compressed copy confirms the tag the client sent
+func TestCompressNotModified(t *testing.T) {
+	handler := Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if notModified(r, `"v1"`, time.Time{}) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, strings.Repeat("{}", 1024))
+	})
+
+	tests := []struct {
+		noneMatch string
+		accept    string
+		status    int
+		etag      string
+	}{
+		{`"v1-gzip"`, "gzip", http.StatusNotModified, `"v1-gzip"`},
+		{`"v1"`, "gzip", http.StatusNotModified, `"v1"`},
+		{`"v1"`, "", http.StatusNotModified, `"v1"`},
+		{`"v0-gzip"`, "gzip", http.StatusOK, `"v1-gzip"`},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", tt.noneMatch)
+		if tt.accept != "" {
+			r.Header.Set("Accept-Encoding", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.status || w.Header().Get("ETag") != tt.etag {
+			t.Errorf("%s: got %d %s, want %d %s", tt.noneMatch, w.Code, w.Header().Get("ETag"), tt.status, tt.etag)
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, strings.Repeat("b", 2048))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	// Flushed before the body was large enough, so it stays uncompressed
+	if w.Header().Get("Content-Encoding") != "" || !w.Flushed || !strings.HasPrefix(w.Body.String(), "first") {
+		t.Errorf("got %v, flushed %v", w.Header(), w.Flushed)
+	}
+}
+
+func TestSetCompression(t *testing.T) {
+	defer SetCompression(CompressionConfig{})
+
+	SetCompression(CompressionConfig{MinSize: 10, Types: []string{"text/plain"}})
+	if compression.Level != gzip.DefaultCompression || compression.MinSize != 10 {
+		t.Errorf("got %+v", compression)
+	}
+
+	SetCompression(CompressionConfig{Off: true})
+	handler := Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("a", 4096))
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("compressed while off")
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/message"
+	"net/http"
+	"strings"
+)
+
+const CodePreconditionFailed = "precondition_failed"
+
+var errVersionConflict = errors.New("project version conflict")
+
+// ETag
+func projectETag(p message.Project) string {
+	return fmt.Sprintf(`"p%d-v%d"`, p.Id, p.Version)
+}
+
+// If-Match uses strong comparison, so weak tags never match.
+// Without the header the request applies to whatever is current.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current message.Project) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	etag := projectETag(current)
+	for _, tag := range strings.Split(header, ",") {
+		tag = decodedETag(strings.TrimSpace(tag))
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	writePreconditionFailed(w, r, current)
+	return false
+}
+
+// Sends the current server state so the client can merge or retry
+func writePreconditionFailed(w http.ResponseWriter, r *http.Request, current message.Project) {
+	log.Printf(
+		"[%s] Precondition failed for project %d: If-Match %s, current %s",
+		RequestId(r),
+		current.Id,
+		r.Header.Get("If-Match"),
+		projectETag(current),
+	)
+
+	w.Header().Set("ETag", projectETag(current))
+	WriteError(
+		w, r,
+		http.StatusPreconditionFailed,
+		CodePreconditionFailed,
+		"Project was modified by someone else",
+		current,
+	)
+}
+
+// Called when a conditional write matched no rows
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, id int) {
+	current, err := getProject(id)
+	if err != nil {
+		writeNotFound(w, r)
+		return
+	}
+	writePreconditionFailed(w, r, current)
+}
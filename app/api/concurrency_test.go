@@ -0,0 +1,50 @@
+package api
+
+import (
+	"main/message"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	current := message.Project{Id: 3, Version: 2}
+
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"", true},
+		{`"p3-v2"`, true},
+		{"*", true},
+		{`"p3-v1", "p3-v2"`, true},
+		{`"p3-v2-gzip"`, true},
+		{`"p3-v2-deflate"`, true},
+		{`"p3-v1"`, false},
+		{`W/"p3-v2"`, false},
+		{`"p3-v2-br"`, false},
+		{`p3-v2`, false},
+		{`"p4-v2"`, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/projects/3", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+
+		if got := checkIfMatch(w, r, current); got != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.header, got, tt.ok)
+		}
+		if tt.ok {
+			continue
+		}
+		if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"p3-v2"` {
+			t.Errorf("%q: got %d with ETag %q", tt.header, w.Code, w.Header().Get("ETag"))
+		}
+		if body := decodeError(t, w); body.Code != CodePreconditionFailed {
+			t.Errorf("%q: got code %q", tt.header, body.Code)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"main/db"
+	"main/message"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxCSPReportSize = 64 << 10
+	// Older reports are dropped, a bad deploy can produce many
+	keepCSPReports = 1000
+)
+
+// The legacy report-uri body
+type legacyCSPReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// A Reporting API entry, several arrive in one array
+type reportingEntry struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+// POST /api/csp-report takes violation reports from browsers, in
+// either format
+func CSPReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	reports := []message.CSPReport{}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/reports+json" {
+		var entries []reportingEntry
+		if err := json.Unmarshal(body, &entries); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		for _, e := range entries {
+			if e.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, message.CSPReport{
+				DocumentURI: e.Body.DocumentURL,
+				Directive:   e.Body.EffectiveDirective,
+				BlockedURI:  e.Body.BlockedURL,
+				SourceFile:  e.Body.SourceFile,
+				LineNumber:  e.Body.LineNumber,
+				Disposition: e.Body.Disposition,
+			})
+		}
+	} else {
+		var legacy legacyCSPReport
+		if err := json.Unmarshal(body, &legacy); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		directive := legacy.Report.EffectiveDirective
+		if directive == "" {
+			directive = legacy.Report.ViolatedDirective
+		}
+		reports = append(reports, message.CSPReport{
+			DocumentURI: legacy.Report.DocumentURI,
+			Directive:   directive,
+			BlockedURI:  legacy.Report.BlockedURI,
+			SourceFile:  legacy.Report.SourceFile,
+			LineNumber:  legacy.Report.LineNumber,
+			Disposition: legacy.Report.Disposition,
+		})
+	}
+
+	now := time.Now().Unix()
+	for _, report := range reports {
+		if report.DocumentURI == "" || report.Directive == "" {
+			continue
+		}
+		_, err := db.Exec(
+			"security",
+			db.Q(db.InsertCSPReport),
+			truncate(report.DocumentURI),
+			truncate(report.Directive),
+			truncate(report.BlockedURI),
+			truncate(report.SourceFile),
+			report.LineNumber,
+			truncate(report.Disposition),
+			truncate(r.UserAgent()),
+			now,
+		)
+		if err != nil {
+			writeInternalError(w, r, "CSP report error", err)
+			return
+		}
+		log.Printf("[%s] CSP violation on %s: %s blocked %s", RequestId(r), report.DocumentURI, report.Directive, report.BlockedURI)
+	}
+	if _, err := db.Exec("security", db.Q(db.PruneCSPReports), keepCSPReports); err != nil {
+		log.Printf("[%s] CSP report prune error: %v", RequestId(r), err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/admin/csp-reports lists the latest reports, ?limit= up to 500
+func CSPReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 500 {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be between 1 and 500", nil)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.Query("security", db.Q(db.GetCSPReports), limit)
+	if err != nil {
+		writeInternalError(w, r, "CSP reports error", err)
+		return
+	}
+	defer rows.Close()
+
+	reports := []message.CSPReport{}
+	for rows.Next() {
+		var (
+			report    message.CSPReport
+			createdAt int64
+		)
+		err := rows.Scan(
+			&report.Id,
+			&report.DocumentURI,
+			&report.Directive,
+			&report.BlockedURI,
+			&report.SourceFile,
+			&report.LineNumber,
+			&report.Disposition,
+			&report.UserAgent,
+			&createdAt,
+		)
+		if err != nil {
+			writeInternalError(w, r, "CSP reports scan error", err)
+			return
+		}
+		report.CreatedAt = time.Unix(createdAt, 0).UTC()
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, r, "CSP reports error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// Reports are attacker-controlled, so stored fields are bounded, cut
+// at a rune boundary so the stored text stays valid UTF-8
+func truncate(s string) string {
+	const max = 2048
+	if len(s) <= max {
+		return s
+	}
+	end := max
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"short", "script-src", 10},
+		{"at the limit", strings.Repeat("a", 2048), 2048},
+		{"over the limit", strings.Repeat("a", 3000), 2048},
+		{"rune across the limit", strings.Repeat("a", 2047) + "é", 2047},
+		{"four byte runes", strings.Repeat("😀", 600), 2048},
+		{"rune ending at the limit", strings.Repeat("a", 2046) + "éa", 2048},
+	}
+
+	for _, tt := range tests {
+		got := truncate(tt.in)
+		if len(got) != tt.want || !utf8.ValidString(got) || !strings.HasPrefix(tt.in, got) {
+			t.Errorf("%s: got %d bytes, valid %v, want %d", tt.name, len(got), utf8.ValidString(got), tt.want)
+		}
+	}
+}
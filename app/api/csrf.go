@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"main/auth"
+	"main/message"
+	"net/http"
+)
+
+// Double-submit CSRF protection. The csrf cookie is readable by pages
+// on our origin, which echo it in X-CSRF-Token. Another site can make
+// the browser send the cookie but cannot read it to set the header.
+const (
+	CodeCSRFFailed = "csrf_failed"
+
+	csrfCookie      = "csrf"
+	csrfHeader      = "X-CSRF-Token"
+	csrfTokenLength = 32
+)
+
+// IssueCSRF returns the request's CSRF token, setting the cookie when
+// there is none yet. Called for the pages that make writes.
+func IssueCSRF(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && validCSRFToken(cookie.Value) {
+		return cookie.Value
+	}
+
+	b := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("CSRF token error: %v", err)
+		return ""
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: false,
+		Secure:   secureRequest(r),
+		SameSite: auth.Settings().SameSite,
+	})
+	return token
+}
+
+// CSRF rejects state-changing requests whose header does not match the
+// cookie. Bearer token requests carry no ambient credentials and pass.
+func CSRF(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			next(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookie)
+		if err != nil || !validCSRFToken(cookie.Value) {
+			writeCSRFError(w, r, "Missing CSRF cookie, reload the page")
+			return
+		}
+		header := r.Header.Get(csrfHeader)
+		if header == "" {
+			writeCSRFError(w, r, "Missing "+csrfHeader+" header")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			writeCSRFError(w, r, "CSRF token does not match")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GET /api/auth/csrf hands the token to clients that did not load one
+// of our pages
+func CSRFHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message.CSRFResponse{
+		Token:  IssueCSRF(w, r),
+		Header: csrfHeader,
+	})
+}
+
+func writeCSRFError(w http.ResponseWriter, r *http.Request, msg string) {
+	log.Printf("[%s] CSRF check failed for %s %s: %s", RequestId(r), r.Method, r.URL.Path, msg)
+	WriteError(w, r, http.StatusForbidden, CodeCSRFFailed, msg, nil)
+}
+
+func validCSRFToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && len(b) == csrfTokenLength
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"main/message"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testCSRFToken = "cm91dGUtdGVzdC1jc3JmLXRva2VuLTMyLWJ5dGVzISE"
+
+func TestValidCSRFToken(t *testing.T) {
+	tests := []struct {
+		token string
+		ok    bool
+	}{
+		{testCSRFToken, true},
+		{"", false},
+		{testCSRFToken[:42], false},
+		{testCSRFToken + "A", false},
+		{testCSRFToken + "=", false},
+		{strings.Replace(testCSRFToken, "c", "+", 1), false},
+	}
+
+	for _, tt := range tests {
+		if got := validCSRFToken(tt.token); got != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.token, got, tt.ok)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		bearer bool
+		ok     bool
+	}{
+		{"safe method", http.MethodGet, "", "", false, true},
+		{"preflight", http.MethodOptions, "", "", false, true},
+		{"matching", http.MethodPost, testCSRFToken, testCSRFToken, false, true},
+		{"bearer token", http.MethodDelete, "", "", true, true},
+		{"no cookie", http.MethodPost, "", testCSRFToken, false, false},
+		{"malformed cookie", http.MethodPut, "abc", "abc", false, false},
+		{"no header", http.MethodPatch, testCSRFToken, "", false, false},
+		{"mismatch", http.MethodDelete, testCSRFToken, "x" + testCSRFToken[1:], false, false},
+	}
+
+	for _, tt := range tests {
+		called := false
+		handler := CSRF(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+		r := httptest.NewRequest(tt.method, "/api/projects", nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set(csrfHeader, tt.header)
+		}
+		if tt.bearer {
+			r.Header.Set("Authorization", "Bearer pt_x_y")
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if called != tt.ok {
+			t.Errorf("%s: called %v, want %v", tt.name, called, tt.ok)
+		}
+		if !tt.ok && (w.Code != http.StatusForbidden || decodeError(t, w).Code != CodeCSRFFailed) {
+			t.Errorf("%s: got %d %s", tt.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestIssueCSRF(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	w := httptest.NewRecorder()
+	if got := IssueCSRF(w, r); got != testCSRFToken || len(w.Result().Cookies()) != 0 {
+		t.Errorf("existing cookie: got %q and %v", got, w.Result().Cookies())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/auth/csrf", nil)
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "stale"})
+	w = httptest.NewRecorder()
+	CSRFHandler(w, r)
+
+	var body message.CSRFResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if !validCSRFToken(body.Token) || body.Header != csrfHeader || len(cookies) != 1 || cookies[0].Value != body.Token {
+		t.Errorf("got %+v with cookies %v", body, cookies)
+	}
+	if cookies[0].HttpOnly || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("got cookie %+v and %v", cookies[0], w.Header())
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// Codes
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidId        = "invalid_id"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeValidationFailed = "validation_failed"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeUnsupportedType  = "unsupported_media_type"
+	CodeInternal         = "internal_error"
+	CodeCORSRejected     = "cors_rejected"
+)
+
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestId string      `json:"requestId"`
+}
+
+type requestIdKey struct{}
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Request Id
+func WithRequestId(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !requestIdPattern.MatchString(id) {
+			id = generateRequestId()
+		}
+
+		w.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(r.Context(), requestIdKey{}, id)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func RequestId(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+func generateRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "req_" + hex.EncodeToString(b)
+}
+
+// Write Error
+func WriteError(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	code string,
+	msg string,
+	details interface{},
+) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		Message:   msg,
+		Details:   details,
+		RequestId: RequestId(r),
+	})
+}
+
+// Logs the real cause, the client only gets a generic message
+func writeInternalError(w http.ResponseWriter, r *http.Request, context string, err error) {
+	log.Printf("[%s] %s: %v", RequestId(r), context, err)
+	WriteError(
+		w, r,
+		http.StatusInternalServerError,
+		CodeInternal,
+		"An internal error occurred",
+		nil,
+	)
+}
+
+func WriteMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(
+		w, r,
+		http.StatusMethodNotAllowed,
+		CodeMethodNotAllowed,
+		"Method "+r.Method+" not allowed",
+		nil,
+	)
+}
+
+func writeInvalidId(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusBadRequest, CodeInvalidId, "Invalid project Id", nil)
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusNotFound, CodeNotFound, "Project not found", nil)
+}
+
+// Decode errors are the client's fault, but the raw message can be noisy
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		WriteError(
+			w, r,
+			http.StatusRequestEntityTooLarge,
+			CodePayloadTooLarge,
+			"Request body too large",
+			map[string]interface{}{"limit": maxErr.Limit},
+		)
+		return
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		WriteError(
+			w, r,
+			http.StatusBadRequest,
+			CodeBadRequest,
+			"Malformed JSON body",
+			map[string]interface{}{"offset": syntaxErr.Offset},
+		)
+	case errors.As(err, &typeErr):
+		WriteError(
+			w, r,
+			http.StatusBadRequest,
+			CodeBadRequest,
+			"Wrong type for field "+typeErr.Field,
+			map[string]interface{}{"field": typeErr.Field, "expected": typeErr.Type.String()},
+		)
+	default:
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid request body", nil)
+	}
+}
+
+// Not Found
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(
+		w, r,
+		http.StatusNotFound,
+		CodeNotFound,
+		"No route for "+r.URL.Path,
+		nil,
+	)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	return body
+}
+
+func TestWithRequestId(t *testing.T) {
+	tests := []struct {
+		header string
+		kept   bool
+	}{
+		{"", false},
+		{"abc-123_x.y", true},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{"has space", false},
+		{"<script>", false},
+	}
+
+	for _, tt := range tests {
+		var seen string
+		handler := WithRequestId(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestId(r)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Request-Id", tt.header)
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if got := w.Header().Get("X-Request-Id"); got != seen {
+			t.Errorf("%q: header %q, context %q", tt.header, got, seen)
+		}
+		if tt.kept && seen != tt.header {
+			t.Errorf("%q: replaced by %q", tt.header, seen)
+		}
+		if !tt.kept && (seen == tt.header || !strings.HasPrefix(seen, "req_")) {
+			t.Errorf("%q: got %q, want a generated id", tt.header, seen)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-Id", "req-1")
+	w := httptest.NewRecorder()
+	WithRequestId(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusConflict, "conflict", "Busy", map[string]int{"version": 2})
+	})(w, r)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("got %d", w.Code)
+	}
+	body := decodeError(t, w)
+	if body.Code != "conflict" || body.Message != "Busy" || body.RequestId != "req-1" {
+		t.Errorf("got %+v", body)
+	}
+	if details, _ := body.Details.(map[string]interface{}); details["version"] != float64(2) {
+		t.Errorf("got details %#v", body.Details)
+	}
+}
+
+func TestWriteDecodeError(t *testing.T) {
+	decode := func(body string, v interface{}) error {
+		return json.NewDecoder(strings.NewReader(body)).Decode(v)
+	}
+	var project struct {
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"truncated", decode(`{"name":`, &project), http.StatusBadRequest, "Invalid request body"},
+		{"bad character", decode(`{"name" 1}`, &project), http.StatusBadRequest, "Malformed JSON body"},
+		{"type", decode(`{"name": 1}`, &project), http.StatusBadRequest, "Wrong type for field name"},
+		{"too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, "Request body too large"},
+		{"other", errors.New("boom"), http.StatusBadRequest, "Invalid request body"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeDecodeError(w, httptest.NewRequest(http.MethodPost, "/", nil), tt.err)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if body := decodeError(t, w); body.Message != tt.message {
+			t.Errorf("%s: got %q, want %q", tt.name, body.Message, tt.message)
+		}
+	}
+}
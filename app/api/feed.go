@@ -0,0 +1,429 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"io"
+	"main/message"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	rssType      = "application/rss+xml"
+	atomType     = "application/atom+xml"
+	jsonFeedType = "application/feed+json"
+
+	feedGenerator = "portfolio-server"
+)
+
+type feedWriter func(w io.Writer, base string, projects []message.Project, updated time.Time) error
+
+// Feeds are rebuilt from the cached project list, so they share its validators
+func feedHandler(format string, contentType string, write feedWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+
+		entry, err := projectsCache.get()
+		if err != nil {
+			writeInternalError(w, r, "Feed projects error", err)
+			return
+		}
+
+		etag := versionETag(entry.etag, format)
+		setValidators(w, etag, entry.lastModified, cachePolicy.List)
+		if notModified(r, etag, entry.lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		updated := entry.lastModified
+		if updated.IsZero() {
+			updated = time.Now().UTC()
+		}
+
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+		write(w, siteURL(r), feedProjects(entry.projects), updated)
+	}
+}
+
+var (
+	RSSFeedHandler  = feedHandler("rss", rssType, writeRSS)
+	AtomFeedHandler = feedHandler("atom", atomType, writeAtom)
+	JSONFeedHandler = feedHandler("json-feed", jsonFeedType, writeJSONFeed)
+)
+
+// Newest first, up to the configured limit
+func feedProjects(projects []message.Project) []message.Project {
+	sorted := append([]message.Project(nil), projects...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	if len(sorted) > site.FeedLimit {
+		sorted = sorted[:site.FeedLimit]
+	}
+	return sorted
+}
+
+//
+// RSS 2.0
+//
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	MediaNS string     `xml:"xmlns:media,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title          string      `xml:"title"`
+	Link           string      `xml:"link"`
+	Description    string      `xml:"description"`
+	Self           rssAtomLink `xml:"atom:link"`
+	ManagingEditor string      `xml:"managingEditor,omitempty"`
+	LastBuildDate  string      `xml:"lastBuildDate"`
+	Generator      string      `xml:"generator"`
+	Items          []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Guid        rssGuid       `xml:"guid"`
+	Description string        `xml:"description"`
+	PubDate     string        `xml:"pubDate"`
+	Author      string        `xml:"author,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	Media       []rssMedia    `xml:"media:content"`
+}
+
+type rssGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssMedia struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+}
+
+func writeRSS(w io.Writer, base string, projects []message.Project, updated time.Time) error {
+	author := ""
+	if site.AuthorEmail != "" {
+		author = site.AuthorEmail
+		if site.Author != "" {
+			author += " (" + site.Author + ")"
+		}
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		MediaNS: "http://search.yahoo.com/mrss/",
+		Channel: rssChannel{
+			Title:          site.Title,
+			Link:           base + "/",
+			Description:    site.Description,
+			Self:           rssAtomLink{Href: base + "/feed.xml", Rel: "self", Type: rssType},
+			ManagingEditor: author,
+			LastBuildDate:  updated.UTC().Format(time.RFC1123Z),
+			Generator:      feedGenerator,
+			Items:          []rssItem{},
+		},
+	}
+
+	for _, p := range projects {
+		link := projectURL(base, p.Id)
+		item := rssItem{
+			Title:       p.Name,
+			Link:        link,
+			Guid:        rssGuid{IsPermaLink: "true", Value: link},
+			Description: projectHTML(p),
+			PubDate:     p.CreatedAt.UTC().Format(time.RFC1123Z),
+			Author:      author,
+		}
+
+		// RSS allows one enclosure, Media RSS carries the rest
+		for _, m := range feedMedia(p) {
+			if item.Enclosure == nil {
+				item.Enclosure = &rssEnclosure{URL: m.url, Length: "0", Type: m.mimeType}
+			}
+			item.Media = append(item.Media, rssMedia{URL: m.url, Type: m.mimeType, Medium: m.medium})
+		}
+
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(feed)
+}
+
+//
+// Atom
+//
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Id        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href  string `xml:"href,attr"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	URI   string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Id        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func writeAtom(w io.Writer, base string, projects []message.Project, updated time.Time) error {
+	name := site.Author
+	if name == "" {
+		name = site.Title
+	}
+
+	feed := atomFeed{
+		Title:    site.Title,
+		Subtitle: site.Description,
+		Id:       base + "/",
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: base + "/", Rel: "alternate", Type: "text/html"},
+			{Href: base + "/atom.xml", Rel: "self", Type: atomType},
+		},
+		Author:    atomPerson{Name: name, Email: site.AuthorEmail, URI: site.AuthorURL},
+		Generator: feedGenerator,
+		Entries:   []atomEntry{},
+	}
+
+	for _, p := range projects {
+		link := projectURL(base, p.Id)
+		entry := atomEntry{
+			Title:     p.Name,
+			Id:        link,
+			Published: p.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   p.UpdatedAt.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Summary:   atomText{Type: "text", Body: summary(p.Desc)},
+			Content:   atomText{Type: "html", Body: projectHTML(p)},
+		}
+
+		for _, m := range feedMedia(p) {
+			entry.Links = append(entry.Links, atomLink{Href: m.url, Rel: "enclosure", Type: m.mimeType})
+		}
+		if p.Repo != "" {
+			entry.Links = append(entry.Links, atomLink{Href: p.Repo, Rel: "related", Title: "Repository"})
+		}
+		for _, l := range p.Links {
+			entry.Links = append(entry.Links, atomLink{Href: l.URL, Rel: "related", Title: l.Name})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(feed)
+}
+
+//
+// JSON Feed
+//
+
+func writeJSONFeed(w io.Writer, base string, projects []message.Project, updated time.Time) error {
+	feed := message.JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       site.Title,
+		HomePageURL: base + "/",
+		FeedURL:     base + "/feed.json",
+		Description: site.Description,
+		Items:       []message.JSONFeedItem{},
+	}
+	if site.Author != "" || site.AuthorURL != "" {
+		feed.Authors = []message.JSONFeedAuthor{{Name: site.Author, URL: site.AuthorURL}}
+	}
+
+	for _, p := range projects {
+		link := projectURL(base, p.Id)
+		item := message.JSONFeedItem{
+			Id:            link,
+			URL:           link,
+			ExternalURL:   p.Repo,
+			Title:         p.Name,
+			ContentHTML:   projectHTML(p),
+			ContentText:   p.Desc,
+			DatePublished: p.CreatedAt.UTC().Format(time.RFC3339),
+			DateModified:  p.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+
+		for _, m := range feedMedia(p) {
+			if item.Image == "" && m.medium == "image" {
+				item.Image = m.url
+			}
+			item.Attachments = append(item.Attachments, message.JSONFeedAttachment{
+				URL:      m.url,
+				MimeType: m.mimeType,
+			})
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(feed)
+}
+
+//
+// Content
+//
+
+// Description paragraphs, media and links as the HTML body of an entry
+func projectHTML(p message.Project) string {
+	var b strings.Builder
+
+	for _, paragraph := range strings.Split(strings.TrimSpace(p.Desc), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>") + "</p>\n")
+		}
+	}
+
+	for _, m := range p.Media {
+		src := html.EscapeString(m.URL)
+		if m.Type == "photo" {
+			b.WriteString(`<p><img src="` + src + `" alt="` + html.EscapeString(p.Name) + `"></p>` + "\n")
+		} else {
+			b.WriteString(`<p><a href="` + src + `">` + src + `</a></p>` + "\n")
+		}
+	}
+
+	if p.Repo != "" || len(p.Links) > 0 {
+		b.WriteString("<ul>\n")
+		if p.Repo != "" {
+			b.WriteString(`<li><a href="` + html.EscapeString(p.Repo) + `">Repository</a></li>` + "\n")
+		}
+		for _, l := range p.Links {
+			b.WriteString(`<li><a href="` + html.EscapeString(l.URL) + `">` + html.EscapeString(l.Name) + `</a></li>` + "\n")
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	return b.String()
+}
+
+// First paragraph, cut at a word boundary
+func summary(desc string) string {
+	const maxSummary = 280
+
+	text := strings.TrimSpace(desc)
+	if i := strings.Index(text, "\n\n"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len([]rune(text)) <= maxSummary {
+		return text
+	}
+	cut := string([]rune(text)[:maxSummary])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+type enclosure struct {
+	url      string
+	mimeType string
+	medium   string
+}
+
+var videoTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".ogv":  "video/ogg",
+}
+
+// Media that points at a file with a known type. Video pages such as
+// YouTube links are not files and stay in the content as links.
+func feedMedia(p message.Project) []enclosure {
+	out := []enclosure{}
+	for _, m := range p.Media {
+		u, err := url.Parse(m.URL)
+		if err != nil {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(u.Path))
+
+		mimeType, ok := videoTypes[ext]
+		if !ok {
+			mimeType, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+		}
+
+		medium, _, _ := strings.Cut(mimeType, "/")
+		if medium != "image" && medium != "video" && medium != "audio" {
+			continue
+		}
+		out = append(out, enclosure{url: m.URL, mimeType: mimeType, medium: medium})
+	}
+	return out
+}
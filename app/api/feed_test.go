@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"main/message"
+	"strings"
+	"testing"
+	"time"
+)
+
+func feedProject(id int, created time.Time) message.Project {
+	return message.Project{
+		Id:        id,
+		Name:      "Project <" + string(rune('A'+id)) + ">",
+		Desc:      "First & line\nsame paragraph\n\nSecond",
+		Repo:      "https://github.com/a/b",
+		CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour),
+		Media: []message.Media{
+			{Type: "photo", URL: "https://example.com/a.png?size=2"},
+			{Type: "video", URL: "https://example.com/b.MP4"},
+			{Type: "video", URL: "https://youtube.com/watch?v=x"},
+		},
+		Links: []message.Link{{Name: "Docs \"x\"", URL: "https://example.com/docs"}},
+	}
+}
+
+func TestFeedProjects(t *testing.T) {
+	defer SetSiteConfig(SiteConfig{})
+	SetSiteConfig(SiteConfig{FeedLimit: 2})
+
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	projects := []message.Project{
+		feedProject(1, day),
+		feedProject(2, day.AddDate(0, 0, 2)),
+		feedProject(3, day.AddDate(0, 0, 1)),
+	}
+
+	got := feedProjects(projects)
+	if len(got) != 2 || got[0].Id != 2 || got[1].Id != 3 {
+		t.Errorf("got %v", got)
+	}
+	if projects[0].Id != 1 {
+		t.Error("input was reordered")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	tests := []struct {
+		desc string
+		want string
+	}{
+		{"  One\n  line  ", "One line"},
+		{"First\n\nSecond", "First"},
+		{long, strings.TrimSpace(strings.Repeat("word ", 56)) + "…"},
+		{strings.Repeat("é", 300), strings.Repeat("é", 280) + "…"},
+	}
+
+	for _, tt := range tests {
+		if got := summary(tt.desc); got != tt.want {
+			t.Errorf("%.20q: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestProjectHTML(t *testing.T) {
+	got := projectHTML(feedProject(1, time.Now()))
+	for _, want := range []string{
+		"<p>First &amp; line<br>same paragraph</p>",
+		"<p>Second</p>",
+		`<img src="https://example.com/a.png?size=2" alt="Project &lt;B&gt;">`,
+		`<a href="https://youtube.com/watch?v=x">`,
+		`<li><a href="https://github.com/a/b">Repository</a></li>`,
+		`<li><a href="https://example.com/docs">Docs &#34;x&#34;</a></li>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+
+	if got := projectHTML(message.Project{Desc: "Only text"}); strings.Contains(got, "<ul>") {
+		t.Errorf("got a list without links: %s", got)
+	}
+}
+
+func TestFeedMedia(t *testing.T) {
+	got := feedMedia(feedProject(1, time.Now()))
+	if len(got) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if got[0].mimeType != "image/png" || got[0].medium != "image" {
+		t.Errorf("got %+v", got[0])
+	}
+	if got[1].mimeType != "video/mp4" || got[1].medium != "video" {
+		t.Errorf("got %+v", got[1])
+	}
+}
+
+func TestFeedWriters(t *testing.T) {
+	defer SetSiteConfig(SiteConfig{})
+	SetSiteConfig(SiteConfig{Title: "Site", Author: "Ann", AuthorEmail: "ann@example.com"})
+
+	updated := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	projects := []message.Project{feedProject(1, updated)}
+
+	var rss bytes.Buffer
+	if err := writeRSS(&rss, "https://example.com", projects, updated); err != nil {
+		t.Fatal(err)
+	}
+	var parsedRSS struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Link      string `xml:"link"`
+				Author    string `xml:"author"`
+				Enclosure struct {
+					URL string `xml:"url,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rss.Bytes(), &parsedRSS); err != nil {
+		t.Fatalf("RSS: %v\n%s", err, rss.String())
+	}
+	items := parsedRSS.Channel.Items
+	if parsedRSS.Channel.Title != "Site" || len(items) != 1 ||
+		items[0].Link != "https://example.com/projects/1" ||
+		items[0].Author != "ann@example.com (Ann)" ||
+		items[0].Enclosure.URL != "https://example.com/a.png?size=2" {
+		t.Errorf("RSS: got %+v", parsedRSS)
+	}
+
+	var atom bytes.Buffer
+	if err := writeAtom(&atom, "https://example.com", projects, updated); err != nil {
+		t.Fatal(err)
+	}
+	var parsedAtom struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Id string `xml:"id"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(atom.Bytes(), &parsedAtom); err != nil {
+		t.Fatalf("Atom: %v\n%s", err, atom.String())
+	}
+	if parsedAtom.Updated != "2026-02-01T00:00:00Z" || len(parsedAtom.Entries) != 1 {
+		t.Errorf("Atom: got %+v", parsedAtom)
+	}
+
+	var jsonFeed bytes.Buffer
+	if err := writeJSONFeed(&jsonFeed, "https://example.com", projects, updated); err != nil {
+		t.Fatal(err)
+	}
+	var parsedJSON message.JSONFeed
+	if err := json.Unmarshal(jsonFeed.Bytes(), &parsedJSON); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsedJSON.Items) != 1 || parsedJSON.Items[0].Image != "https://example.com/a.png?size=2" ||
+		len(parsedJSON.Items[0].Attachments) != 2 || parsedJSON.Authors[0].Name != "Ann" {
+		t.Errorf("JSON Feed: got %+v", parsedJSON)
+	}
+	if !strings.Contains(jsonFeed.String(), "<p>") {
+		t.Error("JSON Feed: HTML is escaped")
+	}
+}
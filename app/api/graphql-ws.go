@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"main/message"
+	"main/server"
+	"main/ws"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+)
+
+// Subscriptions speak the graphql-transport-ws protocol
+const graphqlWsProtocol = "graphql-transport-ws"
+
+// Subscription field to the hub event that triggers it
+var subscriptionEvents = map[string]string{
+	"projectCreated": "project_created",
+	"projectUpdated": "project_updated",
+	"projectDeleted": "project_deleted",
+}
+
+const connectionInitTimeout = 10 * time.Second
+
+type graphqlWsMessage struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Bulk changes do not report versions, so Version may be nil
+type projectEvent struct {
+	Type    string `json:"type"`
+	Id      int    `json:"id"`
+	Version *int   `json:"version"`
+}
+
+type graphqlConn struct {
+	conn   *websocket.Conn
+	schema *graphql.Schema
+	ctx    context.Context
+	write  sync.Mutex
+	mutex  sync.Mutex
+	subs   map[string]*graphqlOperation
+}
+
+func serveGraphQLSubscriptions(
+	s *ws.Server,
+	schema *graphql.Schema,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	header := http.Header{}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if protocol == graphqlWsProtocol {
+			header.Set("Sec-WebSocket-Protocol", graphqlWsProtocol)
+		}
+	}
+
+	conn, err := ws.Upgrader.Upgrade(w, r, header)
+	if err != nil {
+		log.Printf("GraphQL websocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	c := &graphqlConn{
+		conn:   conn,
+		schema: schema,
+		ctx:    r.Context(),
+		subs:   map[string]*graphqlOperation{},
+	}
+
+	// The hub only needs a send channel, so this connection joins it
+	// like any /ws client subscribed to projects
+	client := &server.Client{
+		Id:       server.GenerateClientId(),
+		Conn:     conn,
+		Send:     make(chan message.Message, 256),
+		Channels: map[string]bool{"projects": true},
+	}
+	s.Register <- client
+	defer func() { s.Unregister <- client }()
+
+	go c.deliver(client.Send)
+	c.read()
+}
+
+func (c *graphqlConn) send(msg graphqlWsMessage) {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	if err := c.conn.WriteJSON(msg); err != nil {
+		log.Printf("GraphQL websocket write error: %v", err)
+	}
+}
+
+func (c *graphqlConn) sendPayload(id string, kind string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("GraphQL websocket encode error: %v", err)
+		return
+	}
+	c.send(graphqlWsMessage{Id: id, Type: kind, Payload: body})
+}
+
+func (c *graphqlConn) close(code int, reason string) {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second),
+	)
+}
+
+// Read
+func (c *graphqlConn) read() {
+	acknowledged := false
+	c.conn.SetReadDeadline(time.Now().Add(connectionInitTimeout))
+
+	for {
+		var msg graphqlWsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if !acknowledged {
+				c.close(4408, "Connection initialisation timeout")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			if acknowledged {
+				c.close(4429, "Too many initialisation requests")
+				return
+			}
+			acknowledged = true
+			c.conn.SetReadDeadline(time.Time{})
+			c.send(graphqlWsMessage{Type: "connection_ack"})
+
+		case "ping":
+			c.send(graphqlWsMessage{Type: "pong"})
+
+		case "pong":
+
+		case "subscribe":
+			if !acknowledged {
+				c.close(4401, "Unauthorized")
+				return
+			}
+			if !c.subscribe(msg) {
+				return
+			}
+
+		case "complete":
+			c.mutex.Lock()
+			delete(c.subs, msg.Id)
+			c.mutex.Unlock()
+
+		default:
+			c.close(4400, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// Returns false when the connection has to close
+func (c *graphqlConn) subscribe(msg graphqlWsMessage) bool {
+	if msg.Id == "" {
+		c.close(4400, "Subscribe requires an id")
+		return false
+	}
+
+	c.mutex.Lock()
+	_, exists := c.subs[msg.Id]
+	c.mutex.Unlock()
+	if exists {
+		c.close(4409, "Subscriber for "+msg.Id+" already exists")
+		return false
+	}
+
+	var req graphqlRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		c.close(4400, "Invalid subscribe payload")
+		return false
+	}
+
+	op, errs := prepareGraphQL(c.schema, req)
+	if len(errs) > 0 {
+		c.sendPayload(msg.Id, "error", errs)
+		return true
+	}
+
+	// Queries over the socket answer once
+	if !op.subscription {
+		c.sendPayload(msg.Id, "next", op.execute(c.ctx, nil))
+		c.send(graphqlWsMessage{Id: msg.Id, Type: "complete"})
+		return true
+	}
+
+	c.mutex.Lock()
+	c.subs[msg.Id] = op
+	c.mutex.Unlock()
+	return true
+}
+
+// Deliver
+func (c *graphqlConn) deliver(events <-chan message.Message) {
+	for msg := range events {
+		for _, event := range projectEvents(msg) {
+			c.mutex.Lock()
+			matching := map[string]*graphqlOperation{}
+			for id, op := range c.subs {
+				if subscriptionEvents[op.rootField] == event.Type {
+					matching[id] = op
+				}
+			}
+			c.mutex.Unlock()
+
+			for id, op := range matching {
+				c.sendPayload(id, "next", op.execute(c.ctx, event))
+			}
+		}
+	}
+
+	// The hub dropped this client, so no more events will arrive
+	c.close(1011, "Event stream closed")
+	c.conn.Close()
+}
+
+// Hub messages as subscription events, bulk changes fanned out per project
+func projectEvents(msg message.Message) []projectEvent {
+	data, _ := msg.Data.(map[string]interface{})
+
+	switch msg.Type {
+	case "project_created", "project_updated", "project_deleted":
+		version := toInt(data["version"])
+		return []projectEvent{{
+			Type:    msg.Type,
+			Id:      toInt(data["id"]),
+			Version: &version,
+		}}
+
+	case "projects_bulk":
+		events := []projectEvent{}
+		for _, group := range []struct{ key, kind string }{
+			{"created", "project_created"},
+			{"updated", "project_updated"},
+			{"deleted", "project_deleted"},
+		} {
+			ids, _ := data[group.key].([]int)
+			for _, id := range ids {
+				events = append(events, projectEvent{Type: group.kind, Id: id})
+			}
+		}
+		return events
+	}
+
+	return nil
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,667 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/message"
+	"main/ws"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+const graphqlType = "application/graphql"
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQL
+func GraphQLHandler(s *ws.Server) http.HandlerFunc {
+	schema := newGraphQLSchema(s)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			serveGraphQLSubscriptions(s, schema, w, r)
+			return
+		}
+
+		var req graphqlRequest
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			req.Query = query.Get("query")
+			req.OperationName = query.Get("operationName")
+			if vars := query.Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+					WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "variables must be a JSON object", nil)
+					return
+				}
+			}
+
+		case http.MethodPost:
+			limitBody(w, r)
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+			if mediaType == graphqlType {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					writeDecodeError(w, r, err)
+					return
+				}
+				req.Query = string(body)
+			} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeDecodeError(w, r, err)
+				return
+			}
+
+		default:
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+
+		if strings.TrimSpace(req.Query) == "" {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "query is required", nil)
+			return
+		}
+
+		var result *graphql.Result
+		op, errs := prepareGraphQL(schema, req)
+		switch {
+		case len(errs) > 0:
+			result = &graphql.Result{Errors: errs}
+		case op.subscription:
+			result = &graphql.Result{Errors: []gqlerrors.FormattedError{
+				gqlerrors.NewFormattedError("Subscriptions require a WebSocket connection"),
+			}}
+		default:
+			result = op.execute(r.Context(), nil)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// Resolver failures reach the client without internals, like writeInternalError
+func graphqlInternalError(ctx context.Context, context string, err error) error {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	log.Printf("[%s] GraphQL %s: %v", id, context, err)
+	return errors.New("An internal error occurred")
+}
+
+//
+// Operations
+//
+
+// Parsing, validation and execution are left to graphql-go. This
+// adds the limits below and picks out the single field a subscription
+// listens to, since graphql-go runs subscriptions off resolvers that
+// return channels and the events here come from the hub instead.
+
+// Limits bound the work one operation can ask for, zero for no limit.
+// Fields are counted after fragments are expanded. An alias is how one
+// field gets resolved many times over, as in a: project(id: 1)
+// b: project(id: 2), so aliases have a limit of their own.
+type graphqlLimitConfig struct {
+	MaxDepth   int
+	MaxFields  int
+	MaxAliases int
+}
+
+var graphqlLimits = graphqlLimitConfig{
+	MaxDepth:   8,
+	MaxFields:  250,
+	MaxAliases: 15,
+}
+
+// A parsed, validated operation, run once for a query or once per
+// event for a subscription
+type graphqlOperation struct {
+	schema       *graphql.Schema
+	doc          *ast.Document
+	request      graphqlRequest
+	subscription bool
+	rootField    string
+}
+
+func prepareGraphQL(schema *graphql.Schema, req graphqlRequest) (*graphqlOperation, []gqlerrors.FormattedError) {
+	src := source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})
+	doc, err := parser.Parse(parser.ParseParams{Source: src})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if req.OperationName == "" && op != nil {
+				return nil, []gqlerrors.FormattedError{
+					gqlerrors.NewFormattedError("Must provide operation name if query contains multiple operations"),
+				}
+			}
+			if req.OperationName == "" || (def.Name != nil && def.Name.Value == req.OperationName) {
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	if op == nil {
+		return nil, []gqlerrors.FormattedError{
+			gqlerrors.NewFormattedError(fmt.Sprintf("Unknown operation named %q", req.OperationName)),
+		}
+	}
+	if op.Operation == ast.OperationTypeMutation {
+		return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(
+			gqlerrors.NewError("Schema does not support mutation operations", []ast.Node{op}, "", src, nil, nil),
+		)}
+	}
+
+	// Limits come before validation, which would otherwise have to work
+	// through every expansion of a query built to be expensive
+	walker := &limitWalker{
+		limits:    graphqlLimits,
+		src:       src,
+		fragments: fragments,
+		spreading: map[string]bool{},
+		rootKeys:  map[string]string{},
+	}
+	walker.selections(op.SelectionSet, 1)
+	if walker.err != nil {
+		return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(walker.err)}
+	}
+
+	// graphql-go's check for overlapping fields recurses without end on
+	// a fragment that spreads itself, so cycles are ruled out first
+	for _, rules := range [][]graphql.ValidationRuleFn{
+		{graphql.NoFragmentCyclesRule},
+		graphql.SpecifiedRules,
+	} {
+		if result := graphql.ValidateDocument(schema, doc, rules); !result.IsValid {
+			return nil, result.Errors
+		}
+	}
+
+	prepared := &graphqlOperation{
+		schema:       schema,
+		doc:          doc,
+		request:      req,
+		subscription: op.Operation == ast.OperationTypeSubscription,
+	}
+	if prepared.subscription {
+		if len(walker.rootKeys) != 1 {
+			return nil, []gqlerrors.FormattedError{gqlerrors.FormatError(
+				gqlerrors.NewError("Subscription must select exactly one top level field", []ast.Node{op}, "", src, nil, nil),
+			)}
+		}
+		for _, name := range walker.rootKeys {
+			prepared.rootField = name
+		}
+	}
+	return prepared, nil
+}
+
+// Runs against a root value, which for a subscription is the event
+// being delivered
+func (o *graphqlOperation) execute(ctx context.Context, root interface{}) *graphql.Result {
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        *o.schema,
+		Root:          root,
+		AST:           o.doc,
+		OperationName: o.request.OperationName,
+		Args:          o.request.Variables,
+		Context:       ctx,
+	})
+}
+
+type limitWalker struct {
+	limits    graphqlLimitConfig
+	src       *source.Source
+	fragments map[string]*ast.FragmentDefinition
+	spreading map[string]bool
+	fields    int
+	aliases   int
+	// Response key to field name for the top level selections
+	rootKeys map[string]string
+	err      error
+}
+
+// Stops at the first limit exceeded, which also keeps fragments
+// spread over and over from being expanded without end
+func (w *limitWalker) selections(set *ast.SelectionSet, depth int) {
+	if set == nil {
+		return
+	}
+
+	for _, sel := range set.Selections {
+		if w.err != nil {
+			return
+		}
+
+		switch sel := sel.(type) {
+		case *ast.Field:
+			w.fields++
+			key := sel.Name.Value
+			if sel.Alias != nil {
+				w.aliases++
+				key = sel.Alias.Value
+			}
+			if depth == 1 {
+				w.rootKeys[key] = sel.Name.Value
+			}
+			if w.overLimit(sel, depth) {
+				return
+			}
+			w.selections(sel.SelectionSet, depth+1)
+
+		case *ast.InlineFragment:
+			w.selections(sel.SelectionSet, depth)
+
+		case *ast.FragmentSpread:
+			// Unknown fragments and cycles are left to validation
+			fragment := w.fragments[sel.Name.Value]
+			if fragment == nil || w.spreading[fragment.Name.Value] {
+				continue
+			}
+			w.spreading[fragment.Name.Value] = true
+			w.selections(fragment.SelectionSet, depth)
+			delete(w.spreading, fragment.Name.Value)
+		}
+	}
+}
+
+func (w *limitWalker) overLimit(field *ast.Field, depth int) bool {
+	var message string
+	switch limits := w.limits; {
+	case limits.MaxDepth > 0 && depth > limits.MaxDepth:
+		message = fmt.Sprintf("Query is nested deeper than the limit of %d", limits.MaxDepth)
+	case limits.MaxFields > 0 && w.fields > limits.MaxFields:
+		message = fmt.Sprintf("Query selects more than the limit of %d fields", limits.MaxFields)
+	case limits.MaxAliases > 0 && w.aliases > limits.MaxAliases:
+		message = fmt.Sprintf("Query uses more than the limit of %d aliases", limits.MaxAliases)
+	default:
+		return false
+	}
+	w.err = gqlerrors.NewError(message, []ast.Node{field}, "", w.src, nil, nil)
+	return true
+}
+
+//
+// Schema
+//
+
+var dateTimeScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "DateTime",
+	Description: "RFC 3339 date and time",
+	Serialize: func(v interface{}) interface{} {
+		if t, ok := v.(time.Time); ok {
+			return t.UTC().Format(time.RFC3339)
+		}
+		return nil
+	},
+	ParseValue: func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t
+			}
+		}
+		return nil
+	},
+	ParseLiteral: func(v ast.Value) interface{} {
+		if s, ok := v.(*ast.StringValue); ok {
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				return t
+			}
+		}
+		return nil
+	},
+})
+
+func newGraphQLSchema(s *ws.Server) *graphql.Schema {
+	nonNull := func(t graphql.Type) graphql.Type {
+		return graphql.NewNonNull(t)
+	}
+	listOf := func(t graphql.Type) graphql.Type {
+		return nonNull(graphql.NewList(nonNull(t)))
+	}
+	pageArgs := func(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args["first"] = &graphql.ArgumentConfig{Type: graphql.Int, Description: "At most this many"}
+		args["offset"] = &graphql.ArgumentConfig{Type: graphql.Int, Description: "Skip this many"}
+		return args
+	}
+	mediaTypeArg := func() *graphql.ArgumentConfig {
+		return &graphql.ArgumentConfig{Type: graphql.String, Description: "photo or video"}
+	}
+
+	mediaType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Media",
+		Fields: graphql.Fields{
+			"id":        {Type: nonNull(graphql.Int)},
+			"projectId": {Type: nonNull(graphql.Int)},
+			"type":      {Type: nonNull(graphql.String), Description: "photo or video"},
+			"url":       {Type: nonNull(graphql.String)},
+		},
+	})
+
+	linkType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Link",
+		Fields: graphql.Fields{
+			"id":        {Type: nonNull(graphql.Int)},
+			"projectId": {Type: nonNull(graphql.Int)},
+			"name":      {Type: nonNull(graphql.String)},
+			"url":       {Type: nonNull(graphql.String)},
+		},
+	})
+
+	projectType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Project",
+		Fields: graphql.Fields{
+			"id":        {Type: nonNull(graphql.Int)},
+			"name":      {Type: nonNull(graphql.String)},
+			"desc":      {Type: nonNull(graphql.String)},
+			"repo":      {Type: nonNull(graphql.String)},
+			"version":   {Type: nonNull(graphql.Int)},
+			"createdAt": {Type: nonNull(dateTimeScalar)},
+			"updatedAt": {Type: nonNull(dateTimeScalar)},
+			"media": {
+				Type: listOf(mediaType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"type": mediaTypeArg(),
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					media := filterMedia(p.Source.(message.Project).Media, p.Args)
+					return page(media, p.Args)
+				},
+			},
+			"mediaCount": {
+				Type: nonNull(graphql.Int),
+				Args: graphql.FieldConfigArgument{
+					"type": mediaTypeArg(),
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return len(filterMedia(p.Source.(message.Project).Media, p.Args)), nil
+				},
+			},
+			"links": {
+				Type: listOf(linkType),
+				Args: pageArgs(graphql.FieldConfigArgument{}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return page(p.Source.(message.Project).Links, p.Args)
+				},
+			},
+		},
+	})
+
+	clientType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Client",
+		Fields: graphql.Fields{
+			"id":       {Type: nonNull(graphql.String)},
+			"channels": {Type: listOf(graphql.String)},
+		},
+	})
+
+	clientStatsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ClientStats",
+		Fields: graphql.Fields{
+			"count":     {Type: nonNull(graphql.Int)},
+			"timestamp": {Type: nonNull(graphql.String)},
+			"clients": {
+				Type: listOf(clientType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(ClientsSnapshot).Details, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"projects": {
+				Type:        listOf(projectType),
+				Description: "Most recently updated first",
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"ids":           {Type: graphql.NewList(nonNull(graphql.Int))},
+					"search":        {Type: graphql.String, Description: "Case-insensitive match on name or description"},
+					"hasRepo":       {Type: graphql.Boolean},
+					"mediaType":     {Type: graphql.String, Description: "Only projects with media of this type"},
+					"createdAfter":  {Type: dateTimeScalar},
+					"createdBefore": {Type: dateTimeScalar},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					entry, err := projectsCache.get()
+					if err != nil {
+						return nil, graphqlInternalError(p.Context, "projects", err)
+					}
+					return page(filterProjects(entry.projects, p.Args), p.Args)
+				},
+			},
+			"project": {
+				Type: projectType,
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: nonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					project, err := getProject(p.Args["id"].(int))
+					if err == sql.ErrNoRows {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, graphqlInternalError(p.Context, "project", err)
+					}
+					return project, nil
+				},
+			},
+			"media": {
+				Type: listOf(mediaType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"projectId": {Type: graphql.Int},
+					"type":      mediaTypeArg(),
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					projects, err := projectsFor(p)
+					if err != nil {
+						return nil, err
+					}
+					media := []message.Media{}
+					for _, project := range projects {
+						media = append(media, filterMedia(project.Media, p.Args)...)
+					}
+					return page(media, p.Args)
+				},
+			},
+			"links": {
+				Type: listOf(linkType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"projectId": {Type: graphql.Int},
+					"search":    {Type: graphql.String, Description: "Case-insensitive match on name or url"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					projects, err := projectsFor(p)
+					if err != nil {
+						return nil, err
+					}
+					search, _ := p.Args["search"].(string)
+					links := []message.Link{}
+					for _, project := range projects {
+						for _, link := range project.Links {
+							if containsFold(link.Name, search) || containsFold(link.URL, search) {
+								links = append(links, link)
+							}
+						}
+					}
+					return page(links, p.Args)
+				},
+			},
+			"clients": {
+				Type:        clientStatsType,
+				Description: "Connected WebSocket clients, for admin sessions only",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					principal := contextPrincipal(p.Context)
+					if principal == nil || principal.Session == nil {
+						return nil, errors.New("Sign in required to list clients")
+					}
+					return clientsSnapshot(s), nil
+				},
+			},
+		},
+	})
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ProjectEvent",
+		Fields: graphql.Fields{
+			"type":    {Type: nonNull(graphql.String), Description: "project_created, project_updated or project_deleted"},
+			"id":      {Type: nonNull(graphql.Int)},
+			"version": {Type: graphql.Int},
+			"project": {
+				Type:        projectType,
+				Description: "The project as it is now, null once deleted",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					event := p.Source.(projectEvent)
+					if event.Type == "project_deleted" {
+						return nil, nil
+					}
+					project, err := getProject(event.Id)
+					if err == sql.ErrNoRows {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, graphqlInternalError(p.Context, "event project", err)
+					}
+					return project, nil
+				},
+			},
+		},
+	})
+
+	subscriptionFields := graphql.Fields{}
+	for field := range subscriptionEvents {
+		subscriptionFields[field] = &graphql.Field{
+			Type: nonNull(eventType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source, nil
+			},
+		}
+	}
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Subscription: graphql.NewObject(graphql.ObjectConfig{Name: "Subscription", Fields: subscriptionFields}),
+	})
+	if err != nil {
+		log.Fatalf("GraphQL schema: %v", err)
+	}
+	return &schema
+}
+
+// Every project, or just the one named by a projectId argument
+func projectsFor(p graphql.ResolveParams) ([]message.Project, error) {
+	if id, ok := p.Args["projectId"].(int); ok {
+		project, err := getProject(id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, graphqlInternalError(p.Context, "project", err)
+		}
+		return []message.Project{project}, nil
+	}
+
+	entry, err := projectsCache.get()
+	if err != nil {
+		return nil, graphqlInternalError(p.Context, "projects", err)
+	}
+	return entry.projects, nil
+}
+
+//
+// Filters
+//
+
+func filterProjects(projects []message.Project, args map[string]interface{}) []message.Project {
+	ids := map[int]bool{}
+	if list, ok := args["ids"].([]interface{}); ok {
+		for _, id := range list {
+			ids[id.(int)] = true
+		}
+	}
+	search, _ := args["search"].(string)
+	hasRepo, filterRepo := args["hasRepo"].(bool)
+	mediaType, _ := args["mediaType"].(string)
+	after, _ := args["createdAfter"].(time.Time)
+	before, _ := args["createdBefore"].(time.Time)
+
+	out := []message.Project{}
+	for _, p := range projects {
+		switch {
+		case args["ids"] != nil && !ids[p.Id]:
+		case !containsFold(p.Name, search) && !containsFold(p.Desc, search):
+		case filterRepo && hasRepo != (p.Repo != ""):
+		case mediaType != "" && len(filterMedia(p.Media, map[string]interface{}{"type": mediaType})) == 0:
+		case !after.IsZero() && !p.CreatedAt.After(after):
+		case !before.IsZero() && !p.CreatedAt.Before(before):
+		default:
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func filterMedia(media []message.Media, args map[string]interface{}) []message.Media {
+	mediaType, _ := args["type"].(string)
+	if mediaType == "" {
+		return media
+	}
+
+	out := []message.Media{}
+	for _, m := range media {
+		if m.Type == mediaType {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Applies the offset and first arguments
+func page[T any](items []T, args map[string]interface{}) ([]T, error) {
+	offset, _ := args["offset"].(int)
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	items = items[offset:]
+
+	if first, ok := args["first"].(int); ok {
+		if first < 0 {
+			return nil, errors.New("first must not be negative")
+		}
+		if first < len(items) {
+			items = items[:first]
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrepareGraphQL(t *testing.T) {
+	schema := newGraphQLSchema(nil)
+
+	tests := []struct {
+		name  string
+		req   graphqlRequest
+		want  string
+		field string
+	}{
+		{"query", graphqlRequest{Query: `{ projects(first: 2) { id name } }`}, "", ""},
+		{"named operation", graphqlRequest{Query: `query A { clients { count } } query B { projects { id } }`, OperationName: "B"}, "", ""},
+		{"subscription", graphqlRequest{Query: `subscription { deleted: projectDeleted { id } }`}, "", "projectDeleted"},
+		{"syntax error", graphqlRequest{Query: `{ projects {`}, "Syntax Error", ""},
+		{"unknown field", graphqlRequest{Query: `{ nope }`}, `Cannot query field "nope" on type "Query"`, ""},
+		{"missing argument", graphqlRequest{Query: `{ project { id } }`}, `argument "id" of type "Int!" is required`, ""},
+		{"fragment cycle", graphqlRequest{Query: `{ projects { ...A } } fragment A on Project { ...A }`}, `Cannot spread fragment "A" within itself`, ""},
+		{"unnamed operations", graphqlRequest{Query: `query A { clients { count } } query B { projects { id } }`}, "Must provide operation name", ""},
+		{"unknown operation", graphqlRequest{Query: `query A { clients { count } }`, OperationName: "B"}, `Unknown operation named "B"`, ""},
+		{"two subscription fields", graphqlRequest{Query: `subscription { a: projectCreated { id } b: projectDeleted { id } }`}, "exactly one top level field", ""},
+		{"mutation", graphqlRequest{Query: `mutation { projects { id } }`}, "Schema does not support mutation operations", ""},
+	}
+
+	for _, tt := range tests {
+		op, errs := prepareGraphQL(schema, tt.req)
+		messages := []string{}
+		for _, err := range errs {
+			messages = append(messages, err.Message)
+		}
+		if tt.want == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: got %q", tt.name, messages)
+			} else if op.rootField != tt.field {
+				t.Errorf("%s: got root field %q, want %q", tt.name, op.rootField, tt.field)
+			}
+			continue
+		}
+		if !strings.Contains(strings.Join(messages, "\n"), tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, messages, tt.want)
+		}
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	schema := newGraphQLSchema(nil)
+
+	aliased := func(n int) string {
+		var b strings.Builder
+		b.WriteString("{")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, " p%d: project(id: %d) { id }", i, i)
+		}
+		b.WriteString(" }")
+		return b.String()
+	}
+	// The schema is shallow, but limits are checked before validation
+	nested := func(depth int) string {
+		return strings.Repeat("{ project(id: 1) ", depth) + "{ id" + strings.Repeat(" }", depth+1)
+	}
+	// Each fragment spreads the next one twice, doubling the fields
+	fragmentBomb := func(levels int) string {
+		var b strings.Builder
+		b.WriteString("{ projects { ...F0 } }")
+		for i := 0; i < levels; i++ {
+			fmt.Fprintf(&b, " fragment F%d on Project { ...F%d ... on Project { ...F%d } }", i, i+1, i+1)
+		}
+		fmt.Fprintf(&b, " fragment F%d on Project { id }", levels)
+		return b.String()
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"aliases under the limit", aliased(graphqlLimits.MaxAliases), ""},
+		{"too many aliases", aliased(graphqlLimits.MaxAliases + 1), "more than the limit of 15 aliases"},
+		{"fields at the limit", "{ projects { media { id projectId type url } links { id name url } } }", ""},
+		{"depth at the limit", nested(graphqlLimits.MaxDepth - 1), `Cannot query field "project" on type "Project"`},
+		{"too deep", nested(graphqlLimits.MaxDepth), "nested deeper than the limit of 8"},
+		{"fragments expanded past the field limit", fragmentBomb(30), "more than the limit of 250 fields"},
+	}
+
+	for _, tt := range tests {
+		_, errs := prepareGraphQL(schema, graphqlRequest{Query: tt.query})
+		if tt.want == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: got %v", tt.name, errs[0].Message)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Message, tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, errs, tt.want)
+		}
+	}
+}
+
+func TestGraphQLSubscriptionEvent(t *testing.T) {
+	op, errs := prepareGraphQL(newGraphQLSchema(nil), graphqlRequest{
+		Query: `subscription { deleted: projectDeleted { type id version project { id } } }`,
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	version := 3
+	result := op.execute(context.Background(), projectEvent{Type: "project_deleted", Id: 7, Version: &version})
+	out, _ := json.Marshal(result)
+	if want := `{"data":{"deleted":{"id":7,"project":null,"type":"project_deleted","version":3}}}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	handler := GraphQLHandler(nil)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   string
+	}{
+		{"no query", "", http.StatusBadRequest, "query is required"},
+		{"subscription", `subscription { projectCreated { id } }`, http.StatusOK, "Subscriptions require a WebSocket connection"},
+		{"clients without a session", `{ clients { count } }`, http.StatusOK, "Sign in required to list clients"},
+		{"invalid", `{ nope }`, http.StatusOK, `Cannot query field \"nope\"`},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(graphqlRequest{Query: tt.query})
+		r := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body)))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: got %d %s, want %d with %q", tt.name, w.Code, w.Body.String(), tt.status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,972 @@
+package api
+
+import (
+	"encoding/json"
+	"main/message"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Describes one mux pattern. Request and response bodies are sample
+// values whose Go types the schemas are generated from, so the spec
+// follows the message package instead of being maintained by hand.
+type RouteSpec struct {
+	Pattern    string
+	Path       string
+	Version    string
+	Deprecated bool
+	Operations []OperationSpec
+}
+
+type OperationSpec struct {
+	Method      string
+	Summary     string
+	Tag         string
+	Headers     []string
+	Request     interface{}
+	RequestType string
+	Responses   []ResponseSpec
+}
+
+type ResponseSpec struct {
+	Status      int
+	Range       string
+	Description string
+	Body        interface{}
+	ContentType string
+}
+
+const (
+	jsonType      = "application/json"
+	htmlType      = "text/html"
+	textType      = "text/plain"
+	xmlType       = "application/xml"
+	websocketNote = "Upgrades to a WebSocket when sent with Upgrade: websocket"
+)
+
+var (
+	errorResponses = []ResponseSpec{
+		{Status: 0, Description: "Error", Body: ErrorResponse{}},
+	}
+	writeResponses = []ResponseSpec{
+		{Status: http.StatusUnprocessableEntity, Description: "Validation failed", Body: errorWith(message.ValidationErrors{})},
+		{Status: http.StatusPreconditionFailed, Description: "Version conflict", Body: errorWith(message.Project{})},
+	}
+	unauthorizedResponse = ResponseSpec{
+		Status: http.StatusUnauthorized, Description: "Admin session or API token required", Body: ErrorResponse{},
+	}
+	forbiddenResponse = ResponseSpec{
+		Status: http.StatusForbidden, Description: "CSRF check failed, or the API token is missing a scope", Body: ErrorResponse{},
+	}
+	rateLimitedResponse = ResponseSpec{
+		Status: http.StatusTooManyRequests, Description: "Rate limited, retry after the Retry-After seconds", Body: ErrorResponse{},
+	}
+	csrfResponse = ResponseSpec{
+		Status: http.StatusForbidden, Description: "CSRF check failed, send the csrf cookie back in X-CSRF-Token", Body: ErrorResponse{},
+	}
+)
+
+// Every route registered in config.Setup. The v1 table is served both
+// unversioned and under /api/v1.
+var Routes = buildRoutes()
+
+func buildRoutes() []RouteSpec {
+	routes := append([]RouteSpec{}, pageRoutes...)
+
+	for _, route := range v1Routes {
+		alias := route
+		alias.Version = aliasVersion
+		alias.Deprecated = true
+		routes = append(routes, alias)
+	}
+	for _, route := range v1Routes {
+		route.Pattern = VersionedPath(V1, route.Pattern)
+		route.Path = VersionedPath(V1, route.Path)
+		route.Version = V1
+		routes = append(routes, route)
+	}
+	routes = append(routes, v2Routes...)
+
+	return append(routes, metaRoutes...)
+}
+
+var pageRoutes = []RouteSpec{
+	{
+		Pattern: "/",
+		Path:    "/",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Server page, static files under the server directory, and the editor at /editor",
+			Tag:     "pages",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "HTML page", ContentType: htmlType},
+			},
+		}},
+	},
+	{
+		Pattern: "/projects/",
+		Path:    "/projects/{id}",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Server-rendered project page with Open Graph, Twitter card and JSON-LD metadata",
+			Tag:     "pages",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "HTML page", ContentType: htmlType},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+				{Status: http.StatusNotFound, Description: "Not found page", ContentType: htmlType},
+			},
+		}},
+	},
+	{
+		Pattern: "/scripts/",
+		Path:    "/scripts/{path}",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Compiled frontend scripts",
+			Tag:     "assets",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "JavaScript module", ContentType: "application/javascript"},
+				{Status: http.StatusNotFound, Description: "Not found", ContentType: textType},
+			},
+		}},
+	},
+	{
+		Pattern: "/styles/",
+		Path:    "/styles/{path}",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Stylesheets",
+			Tag:     "assets",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Stylesheet", ContentType: "text/css"},
+				{Status: http.StatusNotFound, Description: "Not found", ContentType: textType},
+			},
+		}},
+	},
+	{
+		Pattern: "/ws",
+		Path:    "/ws",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "WebSocket hub. Send {type: subscribe, channel: projects} to receive project events, or channel audit for audit entries when connected with an admin session",
+			Tag:     "realtime",
+			Responses: []ResponseSpec{
+				{Status: http.StatusSwitchingProtocols, Description: "WebSocket of message.Message frames", Body: message.Message{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/hello",
+		Path:    "/hello",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Health check",
+			Tag:     "misc",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Greeting", ContentType: textType},
+			},
+		}},
+	},
+	{
+		Pattern: "/helloWs",
+		Path:    "/helloWs",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "WebSocket health check",
+			Tag:     "misc",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Greeting", ContentType: textType},
+			},
+		}},
+	},
+	{
+		Pattern: "/feed.xml",
+		Path:    "/feed.xml",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "RSS 2.0 feed of the newest projects",
+			Tag:     "feeds",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "RSS feed", ContentType: rssType},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+	{
+		Pattern: "/atom.xml",
+		Path:    "/atom.xml",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Atom feed of the newest projects",
+			Tag:     "feeds",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Atom feed", ContentType: atomType},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+	{
+		Pattern: "/feed.json",
+		Path:    "/feed.json",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "JSON Feed 1.1 of the newest projects",
+			Tag:     "feeds",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "JSON Feed", ContentType: jsonFeedType, Body: message.JSONFeed{}},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+	{
+		Pattern: "/sitemap.xml",
+		Path:    "/sitemap.xml",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Sitemap of the index and every project, or a sitemap index once it outgrows SITEMAP_LIMIT",
+			Tag:     "seo",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "urlset or sitemapindex", ContentType: xmlType},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+	{
+		Pattern: "/sitemaps/",
+		Path:    "/sitemaps/{page}.xml",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "One page of a sitemap index",
+			Tag:     "seo",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "urlset", ContentType: xmlType},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+				{Status: http.StatusNotFound, Description: "No such page", Body: ErrorResponse{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/robots.txt",
+		Path:    "/robots.txt",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Crawler rules from ROBOTS_DISALLOW or ROBOTS_FILE, pointing at the sitemap",
+			Tag:     "seo",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "robots.txt", ContentType: textType},
+			},
+		}},
+	},
+}
+
+// Patterns are unversioned
+var v1Routes = []RouteSpec{
+	{
+		Pattern: "/time-stream",
+		Path:    "/time-stream",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Current server time. " + websocketNote + " to receive TimeUpdate every second",
+			Tag:     "realtime",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Current time", Body: CurrentTime{}},
+				{Status: http.StatusSwitchingProtocols, Description: "Stream of TimeUpdate frames", Body: TimeUpdate{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/count",
+		Path:    "/count",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Connected WebSocket clients. " + websocketNote + " to receive ClientsUpdate every second",
+			Tag:     "realtime",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Clients snapshot", Body: ClientsSnapshot{}},
+				{Status: http.StatusSwitchingProtocols, Description: "Stream of ClientsUpdate frames", Body: ClientsUpdate{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/api/projects",
+		Path:    "/api/projects",
+		Operations: []OperationSpec{
+			{
+				Method:  http.MethodGet,
+				Summary: "List projects with media and links",
+				Tag:     "projects",
+				Headers: []string{"If-None-Match", "If-Modified-Since"},
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Projects", Body: []message.Project{}},
+					{Status: http.StatusNotModified, Description: "Not modified"},
+				},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Create a project",
+				Tag:     "projects",
+				Request: message.CreateProjectRequest{},
+				Responses: append([]ResponseSpec{
+					{Status: http.StatusOK, Description: "Created", Body: message.CreateProjectResponse{}},
+				}, writeResponses[0], unauthorizedResponse, forbiddenResponse),
+			},
+		},
+	},
+	{
+		Pattern: "/api/projects/",
+		Path:    "/api/projects/{id}",
+		Operations: []OperationSpec{
+			{
+				Method:  http.MethodGet,
+				Summary: "Get a project",
+				Tag:     "projects",
+				Headers: []string{"If-None-Match", "If-Modified-Since"},
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Project", Body: message.Project{}},
+					{Status: http.StatusNotModified, Description: "Not modified"},
+				},
+			},
+			{
+				Method:  http.MethodPut,
+				Summary: "Replace a project",
+				Tag:     "projects",
+				Headers: []string{"If-Match"},
+				Request: message.UpdateProjectRequest{},
+				Responses: append([]ResponseSpec{
+					{Status: http.StatusOK, Description: "Updated", Body: message.UpdateProjectResponse{}},
+				}, append(writeResponses, unauthorizedResponse, forbiddenResponse)...),
+			},
+			{
+				Method:      http.MethodPatch,
+				Summary:     "Partially update a project with JSON Merge Patch or JSON Patch",
+				Tag:         "projects",
+				Headers:     []string{"If-Match"},
+				Request:     []PatchOperation{},
+				RequestType: jsonPatchType,
+				Responses: append([]ResponseSpec{
+					{Status: http.StatusOK, Description: "Patched project", Body: message.Project{}},
+				}, append(writeResponses, unauthorizedResponse, forbiddenResponse)...),
+			},
+			{
+				Method:  http.MethodDelete,
+				Summary: "Delete a project with its media and links",
+				Tag:     "projects",
+				Headers: []string{"If-Match"},
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Deleted", Body: message.DeleteProjectResponse{}},
+					writeResponses[1],
+					unauthorizedResponse,
+					forbiddenResponse,
+				},
+			},
+		},
+	},
+	{
+		Pattern: "/api/projects/bulk",
+		Path:    "/api/projects/bulk",
+		Operations: []OperationSpec{{
+			Method:  http.MethodPost,
+			Summary: "Create, update and delete several projects in one transaction",
+			Tag:     "projects",
+			Request: message.BulkRequest{},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Per-operation results", Body: message.BulkResponse{}},
+				unauthorizedResponse,
+				forbiddenResponse,
+				{Range: "4XX", Description: "Atomic batch failed, the status is the failing operation's", Body: errorWith(message.BulkResponse{})},
+			},
+		}},
+	},
+}
+
+var v2Routes = []RouteSpec{
+	{
+		Pattern: "/api/v2/projects",
+		Path:    "/api/v2/projects",
+		Version: V2,
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "List projects, media split into photos and videos",
+			Tag:     "projects",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Projects", Body: message.ProjectListV2{}},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+	{
+		Pattern: "/api/v2/projects/",
+		Path:    "/api/v2/projects/{id}",
+		Version: V2,
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Get a project",
+			Tag:     "projects",
+			Headers: []string{"If-None-Match", "If-Modified-Since"},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Project", Body: message.ProjectItemV2{}},
+				{Status: http.StatusNotModified, Description: "Not modified"},
+			},
+		}},
+	},
+}
+
+var metaRoutes = []RouteSpec{
+	{
+		Pattern: "/api/auth/login",
+		Path:    "/api/auth/login",
+		Operations: []OperationSpec{{
+			Method:  http.MethodPost,
+			Summary: "Sign in as an admin, setting an HTTP-only session cookie",
+			Tag:     "auth",
+			Request: message.LoginRequest{},
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Signed in", Body: message.SessionResponse{}},
+				{Status: http.StatusUnauthorized, Description: "Invalid username or password", Body: ErrorResponse{}},
+				csrfResponse,
+				rateLimitedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/auth/logout",
+		Path:    "/api/auth/logout",
+		Operations: []OperationSpec{{
+			Method:  http.MethodPost,
+			Summary: "Revoke the current session and clear its cookie",
+			Tag:     "auth",
+			Responses: []ResponseSpec{
+				{Status: http.StatusNoContent, Description: "Signed out"},
+				csrfResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/auth/session",
+		Path:    "/api/auth/session",
+		Operations: []OperationSpec{
+			{
+				Method:  http.MethodGet,
+				Summary: "The signed in admin",
+				Tag:     "auth",
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Current session", Body: message.SessionResponse{}},
+					unauthorizedResponse,
+				},
+			},
+			{
+				Method:  http.MethodDelete,
+				Summary: "Revoke every session of the signed in admin",
+				Tag:     "auth",
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Sessions revoked", Body: message.RevokeSessionsResponse{}},
+					unauthorizedResponse,
+					csrfResponse,
+				},
+			},
+		},
+	},
+	{
+		Pattern: "/api/auth/csrf",
+		Path:    "/api/auth/csrf",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "The CSRF token to send in X-CSRF-Token with cookie-authenticated writes, setting the csrf cookie if missing",
+			Tag:     "auth",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Token", Body: message.CSRFResponse{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/api/auth/tokens",
+		Path:    "/api/auth/tokens",
+		Operations: []OperationSpec{
+			{
+				Method:  http.MethodGet,
+				Summary: "API tokens of the signed in admin, revoked ones included",
+				Tag:     "auth",
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "Tokens", Body: []message.TokenResponse{}},
+					unauthorizedResponse,
+				},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Create an API token for Authorization: Bearer. The token is only returned here.",
+				Tag:     "auth",
+				Request: message.CreateTokenRequest{},
+				Responses: []ResponseSpec{
+					{Status: http.StatusCreated, Description: "Created", Body: message.CreateTokenResponse{}},
+					writeResponses[0],
+					unauthorizedResponse,
+					csrfResponse,
+				},
+			},
+		},
+	},
+	{
+		Pattern: "/api/auth/tokens/",
+		Path:    "/api/auth/tokens/{id}",
+		Operations: []OperationSpec{{
+			Method:  http.MethodDelete,
+			Summary: "Revoke an API token",
+			Tag:     "auth",
+			Responses: []ResponseSpec{
+				{Status: http.StatusNoContent, Description: "Revoked"},
+				unauthorizedResponse,
+				csrfResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/admin/rate-limits",
+		Path:    "/api/admin/rate-limits",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Rate limit groups with the clients using them, and open WebSocket connections per IP",
+			Tag:     "admin",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Limit state", Body: message.RateLimitsResponse{}},
+				unauthorizedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/csp-report",
+		Path:    "/api/csp-report",
+		Operations: []OperationSpec{{
+			Method:      http.MethodPost,
+			Summary:     "Content-Security-Policy violation reports sent by browsers, as application/csp-report or application/reports+json",
+			Tag:         "security",
+			Request:     legacyCSPReport{},
+			RequestType: "application/csp-report",
+			Responses: []ResponseSpec{
+				{Status: http.StatusNoContent, Description: "Stored"},
+				rateLimitedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/admin/csp-reports",
+		Path:    "/api/admin/csp-reports",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "The latest Content-Security-Policy violation reports, as many as the limit parameter (1 to 500, default 100)",
+			Tag:     "admin",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Reports, newest first", Body: []message.CSPReport{}},
+				unauthorizedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/admin/ws-origins",
+		Path:    "/api/admin/ws-origins",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Origins allowed to open WebSockets, and rejected attempts per origin",
+			Tag:     "admin",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Origins", Body: message.WebSocketOriginsResponse{}},
+				unauthorizedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/audit",
+		Path:    "/api/audit",
+		Operations: []OperationSpec{{
+			Method: http.MethodGet,
+			Summary: "Audit log of project, media and link changes, newest first. Filters: entity, action, projectId, entityId, " +
+				"actorType, actor (username), since and until (RFC 3339), before (an entry id, for paging) and limit (1 to 500, default 100)",
+			Tag: "admin",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "Entries with before, after and diff", Body: []message.AuditEntry{}},
+				{Status: http.StatusUnprocessableEntity, Description: "Invalid filter", Body: errorWith(message.ValidationErrors{})},
+				unauthorizedResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/audit/",
+		Path:    "/api/audit/{id}/restore",
+		Operations: []OperationSpec{{
+			Method:  http.MethodPost,
+			Summary: "Bring back the project a delete entry recorded, under a new id. Each entry can be restored once",
+			Tag:     "admin",
+			Responses: []ResponseSpec{
+				{Status: http.StatusCreated, Description: "Restored", Body: message.RestoreResponse{}},
+				{Status: http.StatusNotFound, Description: "No such entry", Body: ErrorResponse{}},
+				{Status: http.StatusConflict, Description: "Not a project deletion, or already restored", Body: ErrorResponse{}},
+				unauthorizedResponse,
+				csrfResponse,
+			},
+		}},
+	},
+	{
+		Pattern: "/api/graphql",
+		Path:    "/api/graphql",
+		Operations: []OperationSpec{
+			{
+				Method:  http.MethodGet,
+				Summary: "Run a GraphQL query passed as query, operationName and variables parameters. " + websocketNote + " and the graphql-transport-ws protocol for subscriptions",
+				Tag:     "graphql",
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "GraphQL response with data and errors", Body: map[string]interface{}{}},
+					{Status: http.StatusSwitchingProtocols, Description: "graphql-transport-ws messages", Body: graphqlWsMessage{}},
+				},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Run a GraphQL query over projects, media and links. Connected clients are listed for admin sessions only",
+				Tag:     "graphql",
+				Request: graphqlRequest{},
+				Responses: []ResponseSpec{
+					{Status: http.StatusOK, Description: "GraphQL response with data and errors", Body: map[string]interface{}{}},
+				},
+			},
+		},
+	},
+	{
+		Pattern: "/api/openapi.json",
+		Path:    "/api/openapi.json",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "This document",
+			Tag:     "meta",
+			Responses: []ResponseSpec{
+				{Status: http.StatusOK, Description: "OpenAPI 3 document", Body: map[string]interface{}{}},
+			},
+		}},
+	},
+	{
+		Pattern: "/api/",
+		Path:    "/api/{path}",
+		Operations: []OperationSpec{{
+			Method:  http.MethodGet,
+			Summary: "Any other /api path",
+			Tag:     "meta",
+			Responses: []ResponseSpec{
+				{Status: http.StatusNotFound, Description: "No such route", Body: ErrorResponse{}},
+			},
+		}},
+	},
+}
+
+// Error body whose details field has a known shape
+type typedError struct {
+	ErrorResponse
+	details interface{}
+}
+
+func errorWith(details interface{}) typedError {
+	return typedError{details: details}
+}
+
+//
+// Document
+//
+
+var (
+	specOnce sync.Once
+	specJson []byte
+)
+
+// OpenAPI
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	specOnce.Do(func() {
+		specJson, _ = json.MarshalIndent(BuildOpenAPI(), "", "  ")
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(specJson)
+}
+
+func BuildOpenAPI() map[string]interface{} {
+	g := &schemaGenerator{components: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+
+	for _, route := range Routes {
+		item := map[string]interface{}{}
+		for _, op := range route.Operations {
+			item[strings.ToLower(op.Method)] = g.operation(route, op)
+		}
+		paths[route.Path] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Portfolio API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+				"token":   map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func (g *schemaGenerator) operation(route RouteSpec, op OperationSpec) map[string]interface{} {
+	out := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationId(op.Method, route.Path),
+		"tags":        []string{op.Tag},
+	}
+	if route.Deprecated || isDeprecated(route.Version) {
+		out["deprecated"] = true
+	}
+
+	params := []interface{}{}
+	for _, name := range pathParams(route.Path) {
+		schema := map[string]interface{}{"type": "string"}
+		if name == "id" || name == "page" {
+			schema = map[string]interface{}{"type": "integer"}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	for _, header := range op.Headers {
+		params = append(params, map[string]interface{}{
+			"name":   header,
+			"in":     "header",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.Request != nil {
+		content := map[string]interface{}{}
+		contentType := op.RequestType
+		if contentType == "" {
+			contentType = jsonType
+		}
+		content[contentType] = map[string]interface{}{
+			"schema": g.schema(reflect.TypeOf(op.Request)),
+		}
+		if op.Method == http.MethodPatch {
+			content[mergePatchType] = map[string]interface{}{
+				"schema": g.schema(reflect.TypeOf(message.UpdateProjectRequest{})),
+			}
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content,
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for _, res := range append(op.Responses, errorResponses...) {
+		key := "default"
+		switch {
+		case res.Range != "":
+			key = res.Range
+		case res.Status != 0:
+			key = strconv.Itoa(res.Status)
+		}
+		responses[key] = g.response(res)
+	}
+	out["responses"] = responses
+
+	return out
+}
+
+func (g *schemaGenerator) response(res ResponseSpec) map[string]interface{} {
+	out := map[string]interface{}{"description": res.Description}
+
+	if typed, ok := res.Body.(typedError); ok {
+		out["content"] = map[string]interface{}{
+			jsonType: map[string]interface{}{
+				"schema": map[string]interface{}{
+					"allOf": []interface{}{
+						g.schema(reflect.TypeOf(ErrorResponse{})),
+						map[string]interface{}{
+							"properties": map[string]interface{}{
+								"details": g.schema(reflect.TypeOf(typed.details)),
+							},
+						},
+					},
+				},
+			},
+		}
+		return out
+	}
+
+	switch {
+	case res.Body != nil:
+		contentType := res.ContentType
+		if contentType == "" {
+			contentType = jsonType
+		}
+		out["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(res.Body))},
+		}
+	case res.ContentType != "":
+		out["content"] = map[string]interface{}{
+			res.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+	}
+	return out
+}
+
+func operationId(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == '{' || r == '}'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func pathParams(path string) []string {
+	params := []string{}
+	for _, part := range strings.Split(path, "/") {
+		// Segments like {page}.xml carry a suffix after the parameter
+		if _, rest, ok := strings.Cut(part, "{"); ok {
+			if name, _, ok := strings.Cut(rest, "}"); ok {
+				params = append(params, name)
+			}
+		}
+	}
+	return params
+}
+
+//
+// Schemas
+//
+
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			g.components[t.Name()] = map[string]interface{}{}
+			g.components[t.Name()] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for _, f := range jsonFields(t) {
+		properties[f.name] = g.schema(f.typ)
+		if !f.omitempty {
+			required = append(required, f.name)
+		}
+	}
+
+	out := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
+
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+}
+
+// Exported fields as encoding/json sees them, embedded structs flattened
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && tag == "" {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{
+			name:      name,
+			typ:       f.Type,
+			omitempty: strings.Contains(opts, "omitempty"),
+		})
+	}
+	return fields
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/auth"
+	"main/message"
+	"main/ws"
+	"net/http"
+)
+
+const (
+	maxBulkOperations = 100
+	maxBulkBodySize   = 8 << 20
+
+	CodeBulkFailed = "bulk_failed"
+	CodeRolledBack = "rolled_back"
+	CodeSkipped    = "skipped"
+)
+
+// Bulk Projects
+func BulkProjectsHandler(wsServer *ws.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodySize)
+
+		var req message.BulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		if req.Mode == "" {
+			req.Mode = message.BulkAtomic
+		}
+		if errs := validateBulkRequest(req); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+
+		tx, err := beginProjectTx()
+		if err != nil {
+			writeInternalError(w, r, "Bulk transaction error", err)
+			return
+		}
+		defer tx.rollback()
+
+		results := make([]message.BulkResult, len(req.Operations))
+		changes := make([]projectChange, len(req.Operations))
+		failedAt := -1
+
+		for i, op := range req.Operations {
+			savepoint := fmt.Sprintf("bulk_%d", i)
+			if err := tx.savepoint(savepoint); err != nil {
+				writeInternalError(w, r, "Bulk savepoint error", err)
+				return
+			}
+
+			results[i], changes[i] = applyBulkOperation(r, tx, i, op)
+			if results[i].Error != nil {
+				if err := tx.rollbackTo(savepoint); err != nil {
+					writeInternalError(w, r, "Bulk rollback error", err)
+					return
+				}
+			}
+			if err := tx.release(savepoint); err != nil {
+				writeInternalError(w, r, "Bulk release error", err)
+				return
+			}
+
+			if results[i].Error != nil && req.Mode == message.BulkAtomic {
+				failedAt = i
+				break
+			}
+		}
+
+		// All or nothing: report why, and what would have happened to the rest
+		if failedAt >= 0 {
+			for i := range req.Operations {
+				switch {
+				case i < failedAt:
+					// Ids handed out inside the rolled back transaction mean nothing
+					if results[i].Op == "create" {
+						results[i].Id = 0
+					}
+					results[i].Version = 0
+					results[i].Status = http.StatusFailedDependency
+					results[i].Error = &message.BulkError{
+						Code:    CodeRolledBack,
+						Message: fmt.Sprintf("Rolled back because operation %d failed", failedAt),
+					}
+				case i > failedAt:
+					results[i] = message.BulkResult{
+						Index:  i,
+						Op:     req.Operations[i].Op,
+						Id:     req.Operations[i].Id,
+						Status: http.StatusFailedDependency,
+						Error: &message.BulkError{
+							Code:    CodeSkipped,
+							Message: fmt.Sprintf("Not attempted because operation %d failed", failedAt),
+						},
+					}
+				}
+			}
+
+			WriteError(
+				w, r,
+				results[failedAt].Status,
+				CodeBulkFailed,
+				fmt.Sprintf("Operation %d failed, nothing was applied", failedAt),
+				bulkResponse(req.Mode, results),
+			)
+			return
+		}
+
+		if err := tx.commit(); err != nil {
+			writeInternalError(w, r, "Bulk commit error", err)
+			return
+		}
+
+		response := bulkResponse(req.Mode, results)
+		if response.Succeeded > 0 {
+			projectsCache.invalidate()
+			wsServer.Broadcast <- bulkMessage(results)
+
+			applied := []projectChange{}
+			for i, res := range results {
+				if res.Error == nil {
+					applied = append(applied, changes[i])
+				}
+			}
+			recordProjectChanges(r, wsServer, applied...)
+		}
+
+		log.Printf(
+			"[%s] Bulk %s: %d succeeded, %d failed",
+			RequestId(r),
+			req.Mode,
+			response.Succeeded,
+			response.Failed,
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func validateBulkRequest(req message.BulkRequest) message.ValidationErrors {
+	errs := message.ValidationErrors{}
+
+	if req.Mode != message.BulkAtomic && req.Mode != message.BulkBestEffort {
+		errs = append(errs, message.FieldError{
+			Field:   "mode",
+			Code:    message.CodeInvalidValue,
+			Message: "must be atomic or best_effort",
+		})
+	}
+	if len(req.Operations) == 0 {
+		errs = append(errs, message.FieldError{
+			Field:   "operations",
+			Code:    message.CodeRequired,
+			Message: "is required",
+		})
+	}
+	if len(req.Operations) > maxBulkOperations {
+		errs = append(errs, message.FieldError{
+			Field:   "operations",
+			Code:    message.CodeTooMany,
+			Message: fmt.Sprintf("at most %d operations allowed", maxBulkOperations),
+		})
+	}
+
+	return errs
+}
+
+// Apply, returning what the operation did to the project for the audit
+// log. Snapshots come from the transaction, so they see earlier
+// operations in the same batch.
+func applyBulkOperation(
+	r *http.Request,
+	tx *projectTx,
+	index int,
+	op message.BulkOperation,
+) (message.BulkResult, projectChange) {
+	change := projectChange{}
+	result := message.BulkResult{
+		Index: index,
+		Op:    op.Op,
+		Id:    op.Id,
+	}
+
+	fail := func(status int, code, msg string, details interface{}) (message.BulkResult, projectChange) {
+		result.Status = status
+		result.Error = &message.BulkError{
+			Code:    code,
+			Message: msg,
+			Details: details,
+		}
+		return result, projectChange{}
+	}
+	internal := func(context string, err error) (message.BulkResult, projectChange) {
+		log.Printf("[%s] Bulk operation %d %s: %v", RequestId(r), index, context, err)
+		return fail(http.StatusInternalServerError, CodeInternal, "An internal error occurred", nil)
+	}
+	noMediaScope := func() (message.BulkResult, projectChange) {
+		return fail(
+			http.StatusForbidden,
+			CodeInsufficientScope,
+			"Token is missing the "+auth.ScopeMediaWrite+" scope",
+			map[string]string{"required": auth.ScopeMediaWrite},
+		)
+	}
+	canWriteMedia := CurrentPrincipal(r).Can(auth.ScopeMediaWrite)
+
+	switch op.Op {
+	case "create":
+		var data message.CreateProjectRequest
+		if err := json.Unmarshal(op.Data, &data); err != nil {
+			return fail(http.StatusBadRequest, CodeBadRequest, "Invalid project data", nil)
+		}
+		if errs := data.Validate(); len(errs) > 0 {
+			return fail(http.StatusUnprocessableEntity, CodeValidationFailed, "One or more fields are invalid", errs)
+		}
+		if !canWriteMedia && mediaChanged(nil, data.Photos, data.Videos) {
+			return noMediaScope()
+		}
+
+		id, err := tx.createProject(data)
+		if err != nil {
+			return internal("create error", err)
+		}
+		created, err := tx.snapshot(int(id))
+		if err != nil {
+			return internal("snapshot error", err)
+		}
+		change.after = &created
+		result.Id = int(id)
+		result.Status = http.StatusCreated
+		result.Version = 1
+		return result, change
+
+	case "update", "delete":
+		if op.Id <= 0 {
+			return fail(http.StatusBadRequest, CodeInvalidId, "Invalid project Id", nil)
+		}
+
+		version, err := tx.projectVersion(op.Id)
+		if err == sql.ErrNoRows {
+			return fail(http.StatusNotFound, CodeNotFound, "Project not found", nil)
+		}
+		if err != nil {
+			return internal("version error", err)
+		}
+		if op.Version != 0 && op.Version != version {
+			return fail(
+				http.StatusPreconditionFailed,
+				CodePreconditionFailed,
+				"Project was modified by someone else",
+				map[string]int{"version": version},
+			)
+		}
+
+		current, err := tx.snapshot(op.Id)
+		if err != nil {
+			return internal("snapshot error", err)
+		}
+		change.before = &current
+
+		if op.Op == "delete" {
+			if err := tx.deleteProject(op.Id, version); err != nil {
+				return internal("delete error", err)
+			}
+			result.Status = http.StatusOK
+			result.Version = version
+			return result, change
+		}
+
+		var data message.UpdateProjectRequest
+		if err := json.Unmarshal(op.Data, &data); err != nil {
+			return fail(http.StatusBadRequest, CodeBadRequest, "Invalid project data", nil)
+		}
+		if errs := data.Validate(); len(errs) > 0 {
+			return fail(http.StatusUnprocessableEntity, CodeValidationFailed, "One or more fields are invalid", errs)
+		}
+		if !canWriteMedia && mediaChanged(current.Media, data.Photos, data.Videos) {
+			return noMediaScope()
+		}
+		if err := tx.replaceProject(op.Id, version, data); err != nil {
+			return internal("update error", err)
+		}
+		updated, err := tx.snapshot(op.Id)
+		if err != nil {
+			return internal("snapshot error", err)
+		}
+		change.after = &updated
+		result.Status = http.StatusOK
+		result.Version = version + 1
+		return result, change
+	}
+
+	return fail(http.StatusBadRequest, CodeBadRequest, "Unknown op "+op.Op, nil)
+}
+
+func bulkResponse(mode string, results []message.BulkResult) message.BulkResponse {
+	response := message.BulkResponse{
+		Mode:    mode,
+		Results: results,
+	}
+	for _, res := range results {
+		if res.Error == nil {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
+
+// One event for the whole batch instead of one per project
+func bulkMessage(results []message.BulkResult) message.Message {
+	created := []int{}
+	updated := []int{}
+	deleted := []int{}
+
+	for _, res := range results {
+		if res.Error != nil {
+			continue
+		}
+		switch res.Op {
+		case "create":
+			created = append(created, res.Id)
+		case "update":
+			updated = append(updated, res.Id)
+		case "delete":
+			deleted = append(deleted, res.Id)
+		}
+	}
+
+	return message.Message{
+		Type:    "projects_bulk",
+		Channel: "projects",
+		Data: map[string]interface{}{
+			"created": created,
+			"updated": updated,
+			"deleted": deleted,
+		},
+	}
+}
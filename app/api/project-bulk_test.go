@@ -0,0 +1,65 @@
+package api
+
+import (
+	"main/message"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateBulkRequest(t *testing.T) {
+	ops := func(n int) []message.BulkOperation {
+		return make([]message.BulkOperation, n)
+	}
+
+	tests := []struct {
+		name string
+		req  message.BulkRequest
+		want []string
+	}{
+		{"atomic", message.BulkRequest{Mode: message.BulkAtomic, Operations: ops(1)}, nil},
+		{"best effort at the limit", message.BulkRequest{Mode: message.BulkBestEffort, Operations: ops(maxBulkOperations)}, nil},
+		{"no mode", message.BulkRequest{Operations: ops(1)}, []string{"mode:invalid_value"}},
+		{"unknown mode", message.BulkRequest{Mode: "Atomic", Operations: ops(1)}, []string{"mode:invalid_value"}},
+		{"no operations", message.BulkRequest{Mode: message.BulkAtomic}, []string{"operations:required"}},
+		{"too many", message.BulkRequest{Mode: message.BulkAtomic, Operations: ops(maxBulkOperations + 1)}, []string{"operations:too_many"}},
+	}
+
+	for _, tt := range tests {
+		got := fieldCodes(validateBulkRequest(tt.req))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBulkResponseAndMessage(t *testing.T) {
+	failed := &message.BulkError{Code: CodeNotFound}
+	results := []message.BulkResult{
+		{Index: 0, Op: "create", Id: 7, Status: http.StatusCreated},
+		{Index: 1, Op: "update", Id: 3, Status: http.StatusOK},
+		{Index: 2, Op: "delete", Id: 4, Status: http.StatusNotFound, Error: failed},
+		{Index: 3, Op: "delete", Id: 5, Status: http.StatusOK},
+	}
+
+	response := bulkResponse(message.BulkBestEffort, results)
+	if response.Succeeded != 3 || response.Failed != 1 || len(response.Results) != 4 {
+		t.Errorf("got %+v", response)
+	}
+
+	msg := bulkMessage(results)
+	data := msg.Data.(map[string]interface{})
+	for key, want := range map[string][]int{
+		"created": {7},
+		"updated": {3},
+		"deleted": {5},
+	} {
+		got := data[key].([]int)
+		if len(got) != len(want) || got[0] != want[0] {
+			t.Errorf("%s: got %v, want %v", key, got, want)
+		}
+	}
+	if msg.Channel != "projects" || msg.Type != "projects_bulk" {
+		t.Errorf("got %s on %s", msg.Type, msg.Channel)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"main/auth"
 	"main/db"
 	"main/message"
 	"main/ws"
@@ -17,95 +18,58 @@ import (
 // Get Projects
 func GetAllProjectsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteMethodNotAllowed(w, r)
 		return
 	}
 
-	projectDb, err := db.GetDb("project")
+	entry, err := projectsCache.get()
 	if err != nil {
-		log.Printf("Project database error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Get projects error", err)
 		return
 	}
 
-	rows, err := projectDb.Query(db.Q(db.GetAllProjects))
-	if err != nil {
-		log.Printf("Database query error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	setValidators(w, entry.etag, entry.lastModified, cachePolicy.List)
+	if notModified(r, entry.etag, entry.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	defer rows.Close()
-
-	projects := []message.Project{}
-	for rows.Next() {
-		var p message.Project
-		err := rows.Scan(
-			&p.Id,
-			&p.Name,
-			&p.Desc,
-			&p.Repo,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		)
-		if err != nil {
-			log.Printf("Error scanning project: %v", err)
-			continue
-		}
-
-		p.Media = getProjectMedia(p.Id)
-		p.Links = getProjectLinks(p.Id)
-		projects = append(projects, p)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(projects)
+	w.Write(entry.body)
 }
 
 func GetProjectHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteMethodNotAllowed(w, r)
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/projects/")
+	idStr := projectIdString(r)
 	if idStr == "" || idStr == "/" {
-		http.Error(w, "Invalid project Id", http.StatusBadRequest)
+		writeInvalidId(w, r)
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid project Id", http.StatusBadRequest)
-		return
-	}
-
-	projectDb, err := db.GetDb("project")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInvalidId(w, r)
 		return
 	}
 
-	var p message.Project
-	row := projectDb.QueryRow(db.Q(db.GetProjectById), id)
-
-	err = row.Scan(
-		&p.Id,
-		&p.Name,
-		&p.Desc,
-		&p.Repo,
-		&p.CreatedAt,
-		&p.UpdatedAt,
-	)
+	p, err := getProject(id)
 	if err == sql.ErrNoRows {
-		http.Error(w, "Project not found", http.StatusNotFound)
+		writeNotFound(w, r)
 		return
 	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Get project error", err)
 		return
 	}
 
-	p.Media = getProjectMedia(p.Id)
-	p.Links = getProjectLinks(p.Id)
+	setValidators(w, projectETag(p), p.UpdatedAt, cachePolicy.Item)
+	if notModified(r, projectETag(p), p.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
@@ -115,96 +79,63 @@ func GetProjectHandler(w http.ResponseWriter, r *http.Request) {
 func CreateProjectHandler(wsServer *ws.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			WriteMethodNotAllowed(w, r)
 			return
 		}
 
+		limitBody(w, r)
+
 		var req message.CreateProjectRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeDecodeError(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+		if mediaChanged(nil, req.Photos, req.Videos) && !requireScope(w, r, auth.ScopeMediaWrite) {
 			return
 		}
 
-		database, err := db.GetDb("project")
+		tx, err := beginProjectTx()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Create project transaction error", err)
 			return
 		}
+		defer tx.rollback()
 
-		tx, err := database.Begin()
+		projectId, err := tx.createProject(req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Create project error", err)
 			return
 		}
-		defer tx.Rollback()
-
-		res, err := tx.Exec(
-			db.Q(db.InsertProject),
-			req.Name,
-			req.Desc,
-			req.Repo,
-		)
+		created, err := tx.snapshot(int(projectId))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		projectId, _ := res.LastInsertId()
-		for _, photo := range req.Photos {
-			_, err := tx.Exec(
-				db.Q(db.InsertMedia),
-				projectId,
-				"photo",
-				photo,
-			)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-		for _, video := range req.Videos {
-			_, err := tx.Exec(
-				db.Q(db.InsertMedia),
-				projectId,
-				"video",
-				video,
-			)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-		for _, link := range req.Links {
-			_, err := tx.Exec(
-				db.Q(db.InsertLink),
-				projectId,
-				link.Name,
-				link.URL,
-			)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if err := tx.Commit(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Create project snapshot error", err)
+			return
+		}
+		if err := tx.commit(); err != nil {
+			writeInternalError(w, r, "Create project commit error", err)
 			return
 		}
 
+		projectsCache.invalidate()
 		wsServer.Broadcast <- message.Message{
 			Type:    "project_created",
 			Channel: "projects",
 			Data: map[string]interface{}{
-				"id":   projectId,
-				"name": req.Name,
+				"id":      projectId,
+				"name":    req.Name,
+				"version": 1,
 			},
 		}
+		recordProjectChanges(r, wsServer, projectChange{after: &created})
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      projectId,
-			"message": "Project created successfully",
+		json.NewEncoder(w).Encode(message.CreateProjectResponse{
+			Id:      projectId,
+			Message: "Project created successfully",
 		})
 	}
 }
@@ -213,188 +144,110 @@ func CreateProjectHandler(wsServer *ws.Server) http.HandlerFunc {
 func UpdateProjectHandler(wsServer *ws.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
-			log.Printf("Wrong method: %s", r.Method)
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			WriteMethodNotAllowed(w, r)
 			return
 		}
 
-		idStr := strings.TrimPrefix(r.URL.Path, "/api/projects/")
+		idStr := projectIdString(r)
 		log.Printf("Path: %s, ID string: %s", r.URL.Path, idStr)
 
 		if idStr == "" || idStr == "/" {
 			log.Printf("Empty ID string")
-			http.Error(w, "Invalid project Id", http.StatusBadRequest)
+			writeInvalidId(w, r)
 			return
 		}
 
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
 			log.Printf("Invalid ID conversion: %s, error: %v", idStr, err)
-			http.Error(w, "Invalid project Id", http.StatusBadRequest)
+			writeInvalidId(w, r)
 			return
 		}
 
 		log.Printf("Project ID to update: %d", id)
 
-		bodyBytes, _ := io.ReadAll(r.Body)
-		log.Printf("Raw request body: %s", string(bodyBytes))
-
-		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		var req message.UpdateProjectRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("JSON decode error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		current, err := getProject(id)
+		if err == sql.ErrNoRows {
+			writeNotFound(w, r)
 			return
 		}
-
-		projectDb, err := db.GetDb("project")
 		if err != nil {
-			log.Printf("Project database connection error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Update project load error", err)
 			return
 		}
-
-		log.Printf("Getting media database connection")
-		mediaDb, err := db.GetDb("media")
-		if err != nil {
-			log.Printf("Media database connection error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !checkIfMatch(w, r, current) {
 			return
 		}
 
-		log.Printf("Getting links database connection")
-		linksDb, err := db.GetDb("links")
+		limitBody(w, r)
+		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
-			log.Printf("Links database connection error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDecodeError(w, r, err)
 			return
 		}
+		log.Printf("Raw request body: %s", string(bodyBytes))
 
-		txProject, err := projectDb.Begin()
-		if err != nil {
-			log.Printf("Project transaction begin error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		var req message.UpdateProjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, r, err)
 			return
 		}
-		defer txProject.Rollback()
-
-		txMedia, err := mediaDb.Begin()
-		if err != nil {
-			log.Printf("Media transaction begin error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errs := req.Validate(); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
 			return
 		}
-		defer txMedia.Rollback()
-
-		txLinks, err := linksDb.Begin()
-		if err != nil {
-			log.Printf("Links transaction begin error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if mediaChanged(current.Media, req.Photos, req.Videos) && !requireScope(w, r, auth.ScopeMediaWrite) {
 			return
 		}
-		defer txLinks.Rollback()
 
-		result, err := txProject.Exec(
-			db.Q(db.UpdateProject),
-			req.Name,
-			req.Desc,
-			req.Repo,
-			id,
-		)
+		tx, err := beginProjectTx()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Update project transaction error", err)
 			return
 		}
+		defer tx.rollback()
 
-		rowsAffected, _ := result.RowsAffected()
-		log.Printf("Project Update successful, rows affected: %d", rowsAffected)
-
-		_, err = txMedia.Exec(db.Q(db.DeleteProjectMedia), id)
+		err = tx.replaceProject(id, current.Version, req)
+		if err == errVersionConflict {
+			writeVersionConflict(w, r, id)
+			return
+		}
 		if err != nil {
-			log.Printf("Delete media error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Update project error", err)
 			return
 		}
-
-		_, err = txLinks.Exec(db.Q(db.DeleteProjectLinks), id)
+		updated, err := tx.snapshot(id)
 		if err != nil {
-			log.Printf("Delete links error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		for i, photo := range req.Photos {
-			log.Printf("Photo %d: %s", i+1, photo)
-			_, err := txMedia.Exec(
-				db.Q(db.InsertMedia),
-				id,
-				"photo",
-				photo,
-			)
-			if err != nil {
-				log.Printf("Insert photo error: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-		for i, video := range req.Videos {
-			log.Printf("Video %d: %s", i+1, video)
-			_, err := txMedia.Exec(
-				db.Q(db.InsertMedia),
-				id,
-				"video",
-				video,
-			)
-			if err != nil {
-				log.Printf("Insert video error: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-		for i, link := range req.Links {
-			log.Printf("Link %d: Name='%s', URL='%s'", i+1, link.Name, link.URL)
-			_, err := txLinks.Exec(
-				db.Q(db.InsertLink),
-				id,
-				link.Name,
-				link.URL,
-			)
-			if err != nil {
-				log.Printf("Insert link error: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if err := txProject.Commit(); err != nil {
-			log.Printf("Project transaction commit error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if err := txMedia.Commit(); err != nil {
-			log.Printf("Media transaction commit error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if err := txLinks.Commit(); err != nil {
-			log.Printf("Links transaction commit error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Update project snapshot error", err)
 			return
 		}
+		if err := tx.commit(); err != nil {
+			writeInternalError(w, r, "Update project commit error", err)
+			return
+		}
+		log.Printf("Project %d updated: %d photos, %d videos, %d links", id, len(req.Photos), len(req.Videos), len(req.Links))
 
+		projectsCache.invalidate()
 		wsServer.Broadcast <- message.Message{
 			Type:    "project_updated",
 			Channel: "projects",
 			Data: map[string]interface{}{
-				"id": id,
+				"id":      id,
+				"version": current.Version + 1,
 			},
 		}
 
 		log.Printf("WebSocket broadcast sent")
+		recordProjectChanges(r, wsServer, projectChange{before: &current, after: &updated})
 
+		current.Version++
+		w.Header().Set("ETag", projectETag(current))
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Project updated successfully",
+		json.NewEncoder(w).Encode(message.UpdateProjectResponse{
+			Message: "Project updated successfully",
+			Version: current.Version,
 		})
 	}
 }
@@ -403,38 +256,137 @@ func UpdateProjectHandler(wsServer *ws.Server) http.HandlerFunc {
 func DeleteProjectHandler(wsServer *ws.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			WriteMethodNotAllowed(w, r)
 			return
 		}
 
-		idStr := strings.TrimPrefix(r.URL.Path, "/api/projects/")
+		idStr := projectIdString(r)
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			http.Error(w, "Invalid Project Id", http.StatusBadRequest)
+			writeInvalidId(w, r)
 			return
 		}
 
-		_, err = db.Exec("project", db.Q(db.DeleteProject), id)
+		current, err := getProject(id)
+		if err == sql.ErrNoRows {
+			writeNotFound(w, r)
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Delete project load error", err)
+			return
+		}
+		if !checkIfMatch(w, r, current) {
 			return
 		}
 
+		tx, err := beginProjectTx()
+		if err != nil {
+			writeInternalError(w, r, "Delete project transaction error", err)
+			return
+		}
+		defer tx.rollback()
+
+		err = tx.deleteProject(id, current.Version)
+		if err == errVersionConflict {
+			writeVersionConflict(w, r, id)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Delete project error", err)
+			return
+		}
+		if err := tx.commit(); err != nil {
+			writeInternalError(w, r, "Delete project commit error", err)
+			return
+		}
+
+		projectsCache.invalidate()
 		wsServer.Broadcast <- message.Message{
 			Type:    "project_deleted",
 			Channel: "projects",
 			Data: map[string]interface{}{
-				"id": id,
+				"id":      id,
+				"version": current.Version,
 			},
 		}
+		recordProjectChanges(r, wsServer, projectChange{before: &current})
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Project deleted successfully",
+		json.NewEncoder(w).Encode(message.DeleteProjectResponse{
+			Message: "Project deleted successfully",
 		})
 	}
 }
 
+// Whatever follows /projects/, so every version and alias parses alike
+func projectIdString(r *http.Request) string {
+	_, idStr, _ := strings.Cut(r.URL.Path, "/projects/")
+	return idStr
+}
+
+func getAllProjects() ([]message.Project, error) {
+	projectDb, err := db.GetDb("project")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := projectDb.Query(db.Q(db.GetAllProjects))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []message.Project{}
+	for rows.Next() {
+		var p message.Project
+		err := rows.Scan(
+			&p.Id,
+			&p.Name,
+			&p.Desc,
+			&p.Repo,
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning project: %v", err)
+			continue
+		}
+
+		p.Media = getProjectMedia(p.Id)
+		p.Links = getProjectLinks(p.Id)
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+func getProject(id int) (message.Project, error) {
+	var p message.Project
+
+	projectDb, err := db.GetDb("project")
+	if err != nil {
+		return p, err
+	}
+
+	err = projectDb.QueryRow(db.Q(db.GetProjectById), id).Scan(
+		&p.Id,
+		&p.Name,
+		&p.Desc,
+		&p.Repo,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	p.Media = getProjectMedia(p.Id)
+	p.Links = getProjectLinks(p.Id)
+	return p, nil
+}
+
 func getProjectMedia(projectId int) []message.Media {
 	mediaDb, err := db.GetDb("media")
 	if err != nil {
@@ -508,7 +460,7 @@ func HandleProjects(wsServer *ws.Server) http.HandlerFunc {
 		case http.MethodPost:
 			CreateProjectHandler(wsServer)(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			WriteMethodNotAllowed(w, r)
 		}
 	}
 }
@@ -520,10 +472,12 @@ func HandleProjectById(wsServer *ws.Server) http.HandlerFunc {
 			GetProjectHandler(w, r)
 		case http.MethodPut:
 			UpdateProjectHandler(wsServer)(w, r)
+		case http.MethodPatch:
+			PatchProjectHandler(wsServer)(w, r)
 		case http.MethodDelete:
 			DeleteProjectHandler(wsServer)(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			WriteMethodNotAllowed(w, r)
 		}
 	}
 }
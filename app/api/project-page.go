@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"main/message"
+	"main/static"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+var (
+	pageTemplates *template.Template
+	// Changes with the templates, so cached pages do not outlive a redeploy
+	templatesHash string
+	// Hashed script and style URLs, nil when assets are not fingerprinted
+	assetManifest *static.Manifest
+)
+
+func SetAssetManifest(m *static.Manifest) {
+	assetManifest = m
+}
+
+func init() {
+	if err := LoadTemplates(""); err != nil {
+		log.Fatalf("Default page templates error: %v", err)
+	}
+}
+
+// LoadTemplates parses the built-in page templates, then any *.html in
+// dir, which replace the built-in file of the same name
+func LoadTemplates(dir string) error {
+	sum := sha256.New()
+
+	t := template.New("pages")
+	defaults, err := fs.Glob(defaultTemplates, "templates/*.html")
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{}
+	for _, name := range defaults {
+		content, err := defaultTemplates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[filepath.Base(name)] = content
+	}
+
+	if dir != "" {
+		overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return err
+		}
+		if len(overrides) == 0 {
+			log.Printf("Warning: no templates found in %s", dir)
+		}
+		for _, name := range overrides {
+			content, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			files[filepath.Base(name)] = content
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := t.New(name).Parse(string(files[name])); err != nil {
+			return err
+		}
+		sum.Write([]byte(name))
+		sum.Write(files[name])
+	}
+
+	for _, required := range []string{"project.html", "not-found.html"} {
+		if t.Lookup(required) == nil {
+			return fmt.Errorf("template %s is missing", required)
+		}
+	}
+
+	pageTemplates = t
+	templatesHash = hex.EncodeToString(sum.Sum(nil)[:4])
+	return nil
+}
+
+type projectPage struct {
+	Site        SiteConfig
+	Project     message.Project
+	URL         string
+	Description string
+	Image       string
+	Photos      []string
+	Videos      []string
+	Paragraphs  []string
+	Published   string
+	Modified    string
+	JSONLD      map[string]interface{}
+	Nonce       string
+}
+
+// /projects/{id} rendered on the server, so crawlers and link previews
+// see the project. The client takes over from the embedded project.
+func ProjectPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimSuffix(projectIdString(r), "/"))
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	entry, err := projectsCache.get()
+	if err != nil {
+		writeInternalError(w, r, "Project page error", err)
+		return
+	}
+
+	var project *message.Project
+	for i := range entry.projects {
+		if entry.projects[i].Id == id {
+			project = &entry.projects[i]
+			break
+		}
+	}
+	if project == nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	// Validators only without a nonce, see noStoreNonced
+	if CSPNonce(r) == "" {
+		etag := `"page-` + strconv.Itoa(project.Id) + "-" + strconv.Itoa(project.Version) + "-" + templatesHash + assetManifest.Version() + `"`
+		setValidators(w, etag, project.UpdatedAt, cachePolicy.Item)
+		if notModified(r, etag, project.UpdatedAt) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	renderPage(w, r, http.StatusOK, "project.html", newProjectPage(siteURL(r), *project))
+}
+
+func renderNotFound(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, r, http.StatusNotFound, "not-found.html", projectPage{Site: site})
+}
+
+// Rendered into a buffer first, so a template error still gets a
+// proper error response
+func renderPage(w http.ResponseWriter, r *http.Request, status int, name string, data projectPage) {
+	data.Nonce = CSPNonce(r)
+
+	var body bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&body, name, data); err != nil {
+		writeInternalError(w, r, "Page template error", err)
+		return
+	}
+
+	noStoreNonced(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(assetManifest.Rewrite(body.Bytes()))
+	}
+}
+
+func newProjectPage(base string, p message.Project) projectPage {
+	page := projectPage{
+		Site:        site,
+		Project:     p,
+		URL:         projectURL(base, p.Id),
+		Description: summary(p.Desc),
+		Published:   p.CreatedAt.UTC().Format(time.RFC3339),
+		Modified:    p.UpdatedAt.UTC().Format(time.RFC3339),
+		Photos:      []string{},
+		Videos:      []string{},
+	}
+	if page.Description == "" {
+		page.Description = site.Description
+	}
+
+	for _, m := range p.Media {
+		if m.Type == "photo" {
+			page.Photos = append(page.Photos, m.URL)
+		} else {
+			page.Videos = append(page.Videos, m.URL)
+		}
+	}
+	if len(page.Photos) > 0 {
+		page.Image = page.Photos[0]
+	}
+
+	for _, paragraph := range strings.Split(strings.TrimSpace(p.Desc), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			page.Paragraphs = append(page.Paragraphs, paragraph)
+		}
+	}
+
+	page.JSONLD = creativeWork(page)
+	return page
+}
+
+// schema.org CreativeWork for search result rich snippets
+func creativeWork(page projectPage) map[string]interface{} {
+	work := map[string]interface{}{
+		"@context":     "https://schema.org",
+		"@type":        "CreativeWork",
+		"name":         page.Project.Name,
+		"description":  page.Description,
+		"url":          page.URL,
+		"dateCreated":  page.Published,
+		"dateModified": page.Modified,
+	}
+	if len(page.Photos) > 0 {
+		work["image"] = page.Photos
+	}
+
+	sameAs := []string{}
+	if page.Project.Repo != "" {
+		sameAs = append(sameAs, page.Project.Repo)
+	}
+	for _, l := range page.Project.Links {
+		sameAs = append(sameAs, l.URL)
+	}
+	if len(sameAs) > 0 {
+		work["sameAs"] = sameAs
+	}
+
+	if site.Author != "" {
+		author := map[string]interface{}{"@type": "Person", "name": site.Author}
+		if site.AuthorURL != "" {
+			author["url"] = site.AuthorURL
+		}
+		work["author"] = author
+	}
+	return work
+}
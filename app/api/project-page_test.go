@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"main/message"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewProjectPage(t *testing.T) {
+	defer SetSiteConfig(SiteConfig{})
+	SetSiteConfig(SiteConfig{Description: "Site description", Author: "Ann"})
+
+	page := newProjectPage("https://example.com", feedProject(1, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if page.URL != "https://example.com/projects/1" || page.Image != "https://example.com/a.png?size=2" {
+		t.Errorf("got %+v", page)
+	}
+	if len(page.Photos) != 1 || len(page.Videos) != 2 {
+		t.Errorf("got photos %v and videos %v", page.Photos, page.Videos)
+	}
+	if len(page.Paragraphs) != 2 || page.Paragraphs[1] != "Second" {
+		t.Errorf("got paragraphs %q", page.Paragraphs)
+	}
+	if page.Published != "2026-01-01T00:00:00Z" || page.Modified != "2026-01-01T01:00:00Z" {
+		t.Errorf("got %s and %s", page.Published, page.Modified)
+	}
+
+	work := page.JSONLD
+	if work["@type"] != "CreativeWork" || work["url"] != page.URL {
+		t.Errorf("got %v", work)
+	}
+	if sameAs := work["sameAs"].([]string); len(sameAs) != 2 || sameAs[0] != "https://github.com/a/b" {
+		t.Errorf("got sameAs %v", sameAs)
+	}
+	if author := work["author"].(map[string]interface{}); author["name"] != "Ann" || author["url"] != nil {
+		t.Errorf("got author %v", author)
+	}
+
+	bare := newProjectPage("https://example.com", message.Project{Id: 2, Name: "Bare"})
+	if bare.Description != "Site description" || bare.Image != "" || bare.Paragraphs != nil {
+		t.Errorf("got %+v", bare)
+	}
+	for _, key := range []string{"image", "sameAs"} {
+		if _, ok := bare.JSONLD[key]; ok {
+			t.Errorf("bare project has %s", key)
+		}
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	defer LoadTemplates("")
+	defaultHash := templatesHash
+
+	dir := t.TempDir()
+	override := `<p>{{.Project.Name}}</p>`
+	if err := os.WriteFile(filepath.Join(dir, "project.html"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+	if templatesHash == defaultHash {
+		t.Error("hash did not change with the templates")
+	}
+	if pageTemplates.Lookup("not-found.html") == nil {
+		t.Error("built-in template was dropped")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "project.html"), []byte("{{.Project"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTemplates(dir); err == nil {
+		t.Error("broken template loaded")
+	}
+	if pageTemplates.Lookup("project.html").Tree.Root.String() != override {
+		t.Error("failed load replaced the templates")
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	project := feedProject(1, time.Now())
+	project.Name = "</script><script>alert(1)</script>"
+
+	r := httptest.NewRequest(http.MethodGet, "/projects/1", nil)
+	r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, "n0nce"))
+	w := httptest.NewRecorder()
+	w.Header().Set("ETag", `"page"`)
+
+	renderPage(w, r, http.StatusOK, "project.html", newProjectPage("https://example.com", project))
+	body := w.Body.String()
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.Contains(body, "<script>alert") {
+		t.Error("project name is not escaped")
+	}
+	if strings.Count(body, `nonce="n0nce"`) != 3 {
+		t.Errorf("scripts without the nonce:\n%s", body)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("ETag") != "" {
+		t.Errorf("nonced page is cacheable: %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	renderNotFound(w, httptest.NewRequest(http.MethodHead, "/projects/9", nil))
+	if w.Code != http.StatusNotFound || w.Body.Len() != 0 {
+		t.Errorf("HEAD not found: got %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
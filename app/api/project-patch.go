@@ -0,0 +1,737 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/auth"
+	"main/db"
+	"main/message"
+	"main/ws"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// In-memory copy of a project that patches are applied to
+// before anything touches the database
+type projectDraft struct {
+	Name  string
+	Desc  string
+	Repo  string
+	Media []message.Media
+	Links []message.Link
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch Project
+func PatchProjectHandler(wsServer *ws.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			WriteMethodNotAllowed(w, r)
+			return
+		}
+
+		idStr := projectIdString(r)
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			writeInvalidId(w, r)
+			return
+		}
+
+		current, err := getProject(id)
+		if err == sql.ErrNoRows {
+			writeNotFound(w, r)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Patch project load error", err)
+			return
+		}
+		if !checkIfMatch(w, r, current) {
+			return
+		}
+
+		limitBody(w, r)
+		draft := newProjectDraft(current)
+
+		var errs message.ValidationErrors
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch contentType {
+		case jsonPatchType:
+			var ops []PatchOperation
+			if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+				writeDecodeError(w, r, err)
+				return
+			}
+			errs = draft.applyJsonPatch(ops)
+		case mergePatchType, "application/json", "":
+			var patch map[string]json.RawMessage
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				writeDecodeError(w, r, err)
+				return
+			}
+			errs = draft.applyMergePatch(patch)
+		default:
+			WriteError(
+				w, r,
+				http.StatusUnsupportedMediaType,
+				CodeUnsupportedType,
+				"Unsupported patch content type "+contentType,
+				[]string{mergePatchType, jsonPatchType},
+			)
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+		if errs := draft.validate(); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+		if !sameMedia(current.Media, draft.Media) && !requireScope(w, r, auth.ScopeMediaWrite) {
+			return
+		}
+
+		changed, err := saveProjectDraft(current, draft)
+		if err == errVersionConflict {
+			writeVersionConflict(w, r, id)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Patch project save error", err)
+			return
+		}
+
+		updated, err := getProject(id)
+		if err != nil {
+			writeInternalError(w, r, "Patch project reload error", err)
+			return
+		}
+
+		if len(changed) > 0 {
+			projectsCache.invalidate()
+			wsServer.Broadcast <- message.Message{
+				Type:    "project_updated",
+				Channel: "projects",
+				Data: map[string]interface{}{
+					"id":      id,
+					"version": updated.Version,
+					"fields":  changed,
+				},
+			}
+			recordProjectChanges(r, wsServer, projectChange{before: &current, after: &updated})
+		}
+
+		w.Header().Set("ETag", projectETag(updated))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+func newProjectDraft(p message.Project) *projectDraft {
+	d := &projectDraft{
+		Name:  p.Name,
+		Desc:  p.Desc,
+		Repo:  p.Repo,
+		Media: make([]message.Media, len(p.Media)),
+		Links: make([]message.Link, len(p.Links)),
+	}
+	copy(d.Media, p.Media)
+	copy(d.Links, p.Links)
+	return d
+}
+
+// Validate
+func (d *projectDraft) validate() message.ValidationErrors {
+	req := message.UpdateProjectRequest{
+		Name:  d.Name,
+		Desc:  d.Desc,
+		Repo:  d.Repo,
+		Links: d.Links,
+	}
+
+	errs := message.ValidationErrors{}
+	for i, m := range d.Media {
+		switch m.Type {
+		case "photo":
+			req.Photos = append(req.Photos, m.URL)
+		case "video":
+			req.Videos = append(req.Videos, m.URL)
+		default:
+			errs = append(errs, message.FieldError{
+				Field:   fmt.Sprintf("media[%d].type", i),
+				Code:    message.CodeInvalidValue,
+				Message: "must be photo or video",
+			})
+		}
+	}
+
+	return append(errs, req.Validate()...)
+}
+
+//
+// Merge Patch (RFC 7396)
+//
+
+func (d *projectDraft) applyMergePatch(patch map[string]json.RawMessage) message.ValidationErrors {
+	errs := message.ValidationErrors{}
+
+	for key, raw := range patch {
+		isNull := string(raw) == "null"
+
+		switch key {
+		case "name", "desc", "repo":
+			var value string
+			if !isNull {
+				if err := json.Unmarshal(raw, &value); err != nil {
+					errs = append(errs, invalidType(key, "string"))
+					continue
+				}
+			}
+			d.setField(key, value)
+		case "photos", "videos":
+			var urls []string
+			if !isNull {
+				if err := json.Unmarshal(raw, &urls); err != nil {
+					errs = append(errs, invalidType(key, "array of strings"))
+					continue
+				}
+			}
+			d.replaceMediaOfType(strings.TrimSuffix(key, "s"), urls)
+		case "links":
+			var links []message.Link
+			if !isNull {
+				if err := json.Unmarshal(raw, &links); err != nil {
+					errs = append(errs, invalidType(key, "array of links"))
+					continue
+				}
+			}
+			d.replaceLinks(links)
+		default:
+			errs = append(errs, message.FieldError{
+				Field:   key,
+				Code:    message.CodeUnknownField,
+				Message: "cannot be patched",
+			})
+		}
+	}
+
+	return errs
+}
+
+func (d *projectDraft) setField(key, value string) {
+	switch key {
+	case "name":
+		d.Name = value
+	case "desc":
+		d.Desc = value
+	case "repo":
+		d.Repo = value
+	}
+}
+
+func (d *projectDraft) getField(key string) string {
+	switch key {
+	case "name":
+		return d.Name
+	case "desc":
+		return d.Desc
+	default:
+		return d.Repo
+	}
+}
+
+// Keeps the ids of media whose URL did not change. The new list takes
+// the place of the first media of its type, or goes last.
+func (d *projectDraft) replaceMediaOfType(mediaType string, urls []string) {
+	existing := make(map[string][]int)
+	at := -1
+	kept := []message.Media{}
+	for _, m := range d.Media {
+		if m.Type == mediaType {
+			existing[m.URL] = append(existing[m.URL], m.Id)
+			if at < 0 {
+				at = len(kept)
+			}
+			continue
+		}
+		kept = append(kept, m)
+	}
+	if at < 0 {
+		at = len(kept)
+	}
+
+	replaced := make([]message.Media, 0, len(urls))
+	for _, url := range urls {
+		m := message.Media{Type: mediaType, URL: url}
+		if ids := existing[url]; len(ids) > 0 {
+			m.Id = ids[0]
+			existing[url] = ids[1:]
+		}
+		replaced = append(replaced, m)
+	}
+	d.Media = append(kept[:at], append(replaced, kept[at:]...)...)
+}
+
+// Keeps the ids of links whose URL did not change
+func (d *projectDraft) replaceLinks(links []message.Link) {
+	existing := make(map[string][]int)
+	for _, l := range d.Links {
+		existing[l.URL] = append(existing[l.URL], l.Id)
+	}
+
+	next := make([]message.Link, 0, len(links))
+	for _, l := range links {
+		link := message.Link{Name: l.Name, URL: l.URL}
+		if ids := existing[l.URL]; len(ids) > 0 {
+			link.Id = ids[0]
+			existing[l.URL] = ids[1:]
+		}
+		next = append(next, link)
+	}
+	d.Links = next
+}
+
+//
+// JSON Patch (RFC 6902)
+//
+
+func (d *projectDraft) applyJsonPatch(ops []PatchOperation) message.ValidationErrors {
+	for i, op := range ops {
+		if err := d.applyOperation(op); err != "" {
+			return message.ValidationErrors{{
+				Field:   fmt.Sprintf("[%d]%s", i, op.Path),
+				Code:    message.CodeInvalidPatch,
+				Message: err,
+			}}
+		}
+	}
+	return nil
+}
+
+// Returns a description of what went wrong, empty on success
+func (d *projectDraft) applyOperation(op PatchOperation) string {
+	switch op.Op {
+	case "add", "remove", "replace", "test":
+	default:
+		return "unsupported op " + strconv.Quote(op.Op)
+	}
+	if op.Op != "remove" && len(op.Value) == 0 {
+		return "value is required"
+	}
+
+	tokens, ok := parsePointer(op.Path)
+	if !ok || len(tokens) == 0 {
+		return "invalid path"
+	}
+
+	switch tokens[0] {
+	case "name", "desc", "repo":
+		if len(tokens) != 1 {
+			return "invalid path"
+		}
+		return d.patchField(op, tokens[0])
+	case "media":
+		return d.patchMedia(op, tokens[1:])
+	case "links":
+		return d.patchLinks(op, tokens[1:])
+	}
+	return "unknown path"
+}
+
+func (d *projectDraft) patchField(op PatchOperation, key string) string {
+	var value string
+	if op.Op != "remove" {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return "value must be a string"
+		}
+	}
+
+	switch op.Op {
+	case "test":
+		if d.getField(key) != value {
+			return "test failed"
+		}
+	default:
+		d.setField(key, value)
+	}
+	return ""
+}
+
+func (d *projectDraft) patchMedia(op PatchOperation, tokens []string) string {
+	if len(tokens) == 0 {
+		if op.Op == "remove" {
+			d.Media = []message.Media{}
+			return ""
+		}
+		var media []message.Media
+		if err := json.Unmarshal(op.Value, &media); err != nil {
+			return "value must be an array of media"
+		}
+		if op.Op == "test" {
+			return testJson(d.Media, media)
+		}
+		for _, mediaType := range []string{"photo", "video"} {
+			urls := []string{}
+			for _, m := range media {
+				if m.Type == mediaType {
+					urls = append(urls, m.URL)
+				}
+			}
+			d.replaceMediaOfType(mediaType, urls)
+		}
+		return ""
+	}
+
+	index, ok := arrayIndex(tokens[0], len(d.Media), op.Op == "add")
+	if !ok {
+		return "index out of range"
+	}
+
+	if len(tokens) == 1 {
+		var m message.Media
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &m); err != nil {
+				return "value must be a media object"
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			m.Id = 0
+			d.Media = append(d.Media[:index], append([]message.Media{m}, d.Media[index:]...)...)
+		case "remove":
+			d.Media = append(d.Media[:index], d.Media[index+1:]...)
+		case "replace":
+			m.Id = d.Media[index].Id
+			d.Media[index] = m
+		case "test":
+			return testJson(d.Media[index], m)
+		}
+		return ""
+	}
+
+	if len(tokens) != 2 || (tokens[1] != "type" && tokens[1] != "url") {
+		return "invalid path"
+	}
+	if op.Op != "replace" && op.Op != "test" {
+		return "only replace and test are allowed on media fields"
+	}
+
+	var value string
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return "value must be a string"
+	}
+	target := &d.Media[index].URL
+	if tokens[1] == "type" {
+		target = &d.Media[index].Type
+	}
+	if op.Op == "test" {
+		if *target != value {
+			return "test failed"
+		}
+		return ""
+	}
+	*target = value
+	return ""
+}
+
+func (d *projectDraft) patchLinks(op PatchOperation, tokens []string) string {
+	if len(tokens) == 0 {
+		if op.Op == "remove" {
+			d.Links = []message.Link{}
+			return ""
+		}
+		var links []message.Link
+		if err := json.Unmarshal(op.Value, &links); err != nil {
+			return "value must be an array of links"
+		}
+		if op.Op == "test" {
+			return testJson(d.Links, links)
+		}
+		d.replaceLinks(links)
+		return ""
+	}
+
+	index, ok := arrayIndex(tokens[0], len(d.Links), op.Op == "add")
+	if !ok {
+		return "index out of range"
+	}
+
+	if len(tokens) == 1 {
+		var l message.Link
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &l); err != nil {
+				return "value must be a link object"
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			l.Id = 0
+			d.Links = append(d.Links[:index], append([]message.Link{l}, d.Links[index:]...)...)
+		case "remove":
+			d.Links = append(d.Links[:index], d.Links[index+1:]...)
+		case "replace":
+			l.Id = d.Links[index].Id
+			d.Links[index] = l
+		case "test":
+			return testJson(d.Links[index], l)
+		}
+		return ""
+	}
+
+	if len(tokens) != 2 || (tokens[1] != "name" && tokens[1] != "url") {
+		return "invalid path"
+	}
+	if op.Op != "replace" && op.Op != "test" {
+		return "only replace and test are allowed on link fields"
+	}
+
+	var value string
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return "value must be a string"
+	}
+	target := &d.Links[index].URL
+	if tokens[1] == "name" {
+		target = &d.Links[index].Name
+	}
+	if op.Op == "test" {
+		if *target != value {
+			return "test failed"
+		}
+		return ""
+	}
+	*target = value
+	return ""
+}
+
+// JSON Pointer (RFC 6901)
+func parsePointer(path string) ([]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		t = strings.ReplaceAll(t, "~1", "/")
+		tokens[i] = strings.ReplaceAll(t, "~0", "~")
+	}
+	return tokens, true
+}
+
+// "-" appends, and only makes sense for add
+func arrayIndex(token string, length int, adding bool) (int, bool) {
+	if token == "-" {
+		return length, adding
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	if adding {
+		return index, index <= length
+	}
+	return index, index < length
+}
+
+// Ids and project ids are server-owned, so they are ignored in comparisons
+func testJson(current, expected interface{}) string {
+	strip := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		var generic interface{}
+		json.Unmarshal(b, &generic)
+		stripIds(generic)
+		out, _ := json.Marshal(generic)
+		return string(out)
+	}
+	if strip(current) != strip(expected) {
+		return "test failed"
+	}
+	return ""
+}
+
+func stripIds(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		delete(t, "id")
+		delete(t, "projectId")
+	case []interface{}:
+		for _, item := range t {
+			stripIds(item)
+		}
+	}
+}
+
+func invalidType(field, expected string) message.FieldError {
+	return message.FieldError{
+		Field:   field,
+		Code:    message.CodeInvalidValue,
+		Message: "must be " + expected,
+	}
+}
+
+//
+// Save
+//
+
+// Writes only what differs between the stored project and the draft,
+// returning the names of the changed fields
+func saveProjectDraft(current message.Project, draft *projectDraft) ([]string, error) {
+	changed := []string{}
+
+	tx, err := beginProjectTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.rollback()
+
+	if current.Name != draft.Name {
+		changed = append(changed, "name")
+	}
+	if current.Desc != draft.Desc {
+		changed = append(changed, "desc")
+	}
+	if current.Repo != draft.Repo {
+		changed = append(changed, "repo")
+	}
+
+	mediaChanged, err := saveDraftMedia(tx.tx, current, draft)
+	if err != nil {
+		return nil, err
+	}
+	if mediaChanged {
+		changed = append(changed, "media")
+	}
+
+	linksChanged, err := saveDraftLinks(tx.tx, current, draft)
+	if err != nil {
+		return nil, err
+	}
+	if linksChanged {
+		changed = append(changed, "links")
+	}
+
+	// Also runs for media and link changes so updatedAt and version move
+	if len(changed) > 0 {
+		result, err := tx.tx.Exec(
+			db.Q(db.UpdateProject),
+			draft.Name,
+			draft.Desc,
+			draft.Repo,
+			current.Id,
+			current.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return nil, errVersionConflict
+		}
+	}
+
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Project %d patched: %v", current.Id, changed)
+	return changed, nil
+}
+
+// Media and links are stored with their position, so once a list
+// changes at all, even by reordering alone, every row is rewritten
+// where it now stands
+func saveDraftMedia(tx *sql.Tx, current message.Project, draft *projectDraft) (bool, error) {
+	if sameMedia(current.Media, draft.Media) {
+		return false, nil
+	}
+
+	old := make(map[int]bool)
+	for _, m := range current.Media {
+		old[m.Id] = true
+	}
+
+	for i, m := range draft.Media {
+		if m.Id == 0 {
+			if _, err := tx.Exec(db.Q(db.InsertMedia), current.Id, m.Type, m.URL, i); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		delete(old, m.Id)
+		if _, err := tx.Exec(db.Q(db.UpdateMedia), m.Type, m.URL, i, m.Id, current.Id); err != nil {
+			return false, err
+		}
+	}
+
+	for id := range old {
+		if _, err := tx.Exec(db.Q(db.DeleteMedia), id, current.Id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func saveDraftLinks(tx *sql.Tx, current message.Project, draft *projectDraft) (bool, error) {
+	if sameLinks(current.Links, draft.Links) {
+		return false, nil
+	}
+
+	old := make(map[int]bool)
+	for _, l := range current.Links {
+		old[l.Id] = true
+	}
+
+	for i, l := range draft.Links {
+		if l.Id == 0 {
+			if _, err := tx.Exec(db.Q(db.InsertLink), current.Id, l.Name, l.URL, i); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		delete(old, l.Id)
+		if _, err := tx.Exec(db.Q(db.UpdateLink), l.Name, l.URL, i, l.Id, current.Id); err != nil {
+			return false, err
+		}
+	}
+
+	for id := range old {
+		if _, err := tx.Exec(db.Q(db.DeleteLink), id, current.Id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Same rows in the same order, whatever project id the draft carries
+func sameMedia(a []message.Media, b []message.Media) bool {
+	return slices.EqualFunc(a, b, func(x, y message.Media) bool {
+		return x.Id == y.Id && x.Type == y.Type && x.URL == y.URL
+	})
+}
+
+func sameLinks(a []message.Link, b []message.Link) bool {
+	return slices.EqualFunc(a, b, func(x, y message.Link) bool {
+		return x.Id == y.Id && x.Name == y.Name && x.URL == y.URL
+	})
+}
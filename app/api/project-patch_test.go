@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"main/message"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func testDraft() *projectDraft {
+	return newProjectDraft(message.Project{
+		Id:   1,
+		Name: "Portfolio",
+		Desc: "A site",
+		Repo: "https://github.com/a/b",
+		Media: []message.Media{
+			{Id: 10, ProjectId: 1, Type: "photo", URL: "https://example.com/a.png"},
+			{Id: 11, ProjectId: 1, Type: "video", URL: "https://example.com/a.mp4"},
+		},
+		Links: []message.Link{
+			{Id: 20, ProjectId: 1, Name: "Docs", URL: "https://example.com/docs"},
+		},
+	})
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+		ok   bool
+	}{
+		{"/name", []string{"name"}, true},
+		{"/media/0/url", []string{"media", "0", "url"}, true},
+		{"/a~1b/c~0d/~01", []string{"a/b", "c~d", "~1"}, true},
+		{"/", []string{""}, true},
+		{"", nil, false},
+		{"name", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parsePointer(tt.path)
+		if ok != tt.ok || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%q: got %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestArrayIndex(t *testing.T) {
+	tests := []struct {
+		token  string
+		length int
+		adding bool
+		want   int
+		ok     bool
+	}{
+		{"0", 2, false, 0, true},
+		{"1", 2, false, 1, true},
+		{"2", 2, false, 0, false},
+		{"2", 2, true, 2, true},
+		{"3", 2, true, 0, false},
+		{"-", 2, true, 2, true},
+		{"-", 2, false, 2, false},
+		{"-1", 2, false, 0, false},
+		{"x", 2, true, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := arrayIndex(tt.token, tt.length, tt.adding)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%q of %d (adding %v): got %d, %v", tt.token, tt.length, tt.adding, got, ok)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		check  func(d *projectDraft) bool
+		errors []string
+	}{
+		{
+			"fields",
+			`{"name": "New", "repo": null}`,
+			func(d *projectDraft) bool { return d.Name == "New" && d.Desc == "A site" && d.Repo == "" },
+			nil,
+		},
+		{
+			"photos keep ids, order and place",
+			`{"photos": ["https://example.com/b.png", "https://example.com/a.png"]}`,
+			func(d *projectDraft) bool {
+				return len(d.Media) == 3 && d.Media[0].Id == 0 && d.Media[1].Id == 10 && d.Media[2].Id == 11
+			},
+			nil,
+		},
+		{
+			"null clears",
+			`{"videos": null, "links": null}`,
+			func(d *projectDraft) bool { return len(d.Media) == 1 && len(d.Links) == 0 },
+			nil,
+		},
+		{
+			"links keep ids",
+			`{"links": [{"name": "Renamed", "url": "https://example.com/docs"}, {"name": "New", "url": "https://example.com/new"}]}`,
+			func(d *projectDraft) bool {
+				return len(d.Links) == 2 && d.Links[0].Id == 20 && d.Links[0].Name == "Renamed" && d.Links[1].Id == 0
+			},
+			nil,
+		},
+		{
+			"wrong types",
+			`{"name": 1, "photos": "x", "links": [1]}`,
+			func(d *projectDraft) bool { return d.Name == "Portfolio" },
+			[]string{"links:invalid_value", "name:invalid_value", "photos:invalid_value"},
+		},
+		{
+			"unknown field",
+			`{"id": 2}`,
+			func(d *projectDraft) bool { return true },
+			[]string{"id:unknown_field"},
+		},
+	}
+
+	for _, tt := range tests {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		d := testDraft()
+		got := fieldCodes(d.applyMergePatch(patch))
+		if strings.Join(got, ",") != strings.Join(tt.errors, ",") {
+			t.Errorf("%s: got errors %v, want %v", tt.name, got, tt.errors)
+		}
+		if !tt.check(d) {
+			t.Errorf("%s: got %+v", tt.name, d)
+		}
+	}
+}
+
+func TestApplyJsonPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		ops   string
+		check func(d *projectDraft) bool
+		error string
+	}{
+		{
+			"replace and test",
+			`[{"op": "test", "path": "/name", "value": "Portfolio"}, {"op": "replace", "path": "/name", "value": "New"}]`,
+			func(d *projectDraft) bool { return d.Name == "New" },
+			"",
+		},
+		{
+			"remove field",
+			`[{"op": "remove", "path": "/repo"}]`,
+			func(d *projectDraft) bool { return d.Repo == "" },
+			"",
+		},
+		{
+			"append and insert media",
+			`[{"op": "add", "path": "/media/-", "value": {"id": 99, "type": "photo", "url": "https://example.com/c.png"}},
+			  {"op": "add", "path": "/media/0", "value": {"type": "video", "url": "https://example.com/b.mp4"}}]`,
+			func(d *projectDraft) bool {
+				return len(d.Media) == 4 && d.Media[0].URL == "https://example.com/b.mp4" && d.Media[3].Id == 0
+			},
+			"",
+		},
+		{
+			"replace keeps the id",
+			`[{"op": "replace", "path": "/links/0", "value": {"id": 5, "name": "Site", "url": "https://example.com"}}]`,
+			func(d *projectDraft) bool { return d.Links[0].Id == 20 && d.Links[0].Name == "Site" },
+			"",
+		},
+		{
+			"nested fields",
+			`[{"op": "replace", "path": "/media/1/url", "value": "https://example.com/z.mp4"}, {"op": "test", "path": "/links/0/name", "value": "Docs"}]`,
+			func(d *projectDraft) bool { return d.Media[1].URL == "https://example.com/z.mp4" },
+			"",
+		},
+		{
+			"test ignores ids",
+			`[{"op": "test", "path": "/links", "value": [{"name": "Docs", "url": "https://example.com/docs"}]}]`,
+			func(d *projectDraft) bool { return true },
+			"",
+		},
+		{
+			"remove then append a link",
+			`[{"op": "remove", "path": "/links/0"}, {"op": "add", "path": "/links/-", "value": {"name": "A", "url": "https://a.example"}}]`,
+			func(d *projectDraft) bool { return len(d.Links) == 1 && d.Links[0].Name == "A" },
+			"",
+		},
+		{"failed test", `[{"op": "test", "path": "/desc", "value": "Other"}]`, nil, "[0]/desc: test failed"},
+		{"unknown op", `[{"op": "move", "path": "/name", "from": "/desc"}]`, nil, `[0]/name: unsupported op "move"`},
+		{"missing value", `[{"op": "add", "path": "/name"}]`, nil, "[0]/name: value is required"},
+		{"bad path", `[{"op": "replace", "path": "name", "value": "x"}]`, nil, "[0]name: invalid path"},
+		{"unknown path", `[{"op": "replace", "path": "/version", "value": 2}]`, nil, "[0]/version: unknown path"},
+		{"past the end", `[{"op": "replace", "path": "/media/2", "value": {}}]`, nil, "[0]/media/2: index out of range"},
+		{"append outside add", `[{"op": "remove", "path": "/links/-"}]`, nil, "[0]/links/-: index out of range"},
+		{"add to a field", `[{"op": "add", "path": "/links/0/url", "value": "https://x.example"}]`, nil, "[0]/links/0/url: only replace and test are allowed on link fields"},
+		{"wrong type", `[{"op": "replace", "path": "/name", "value": 3}]`, nil, "[0]/name: value must be a string"},
+		{"stops at the first error", `[{"op": "replace", "path": "/name", "value": "x"}, {"op": "remove", "path": "/media/9"}, {"op": "bad"}]`, nil, "[1]/media/9: index out of range"},
+	}
+
+	for _, tt := range tests {
+		var ops []PatchOperation
+		if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		d := testDraft()
+		errs := d.applyJsonPatch(ops)
+
+		got := ""
+		if len(errs) > 0 {
+			got = errs[0].Field + ": " + errs[0].Message
+		}
+		if got != tt.error {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.error)
+		}
+		if tt.check != nil && !tt.check(d) {
+			t.Errorf("%s: got %+v", tt.name, d)
+		}
+	}
+}
+
+func TestDraftValidate(t *testing.T) {
+	d := testDraft()
+	d.Media = append(d.Media, message.Media{Type: "audio", URL: "https://example.com/a.mp3"})
+	d.Name = ""
+
+	got := fieldCodes(d.validate())
+	want := []string{"media[2].type:invalid_value", "name:required"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Sorted field:code pairs, as map iteration order is random
+func fieldCodes(errs message.ValidationErrors) []string {
+	codes := []string{}
+	for _, e := range errs {
+		codes = append(codes, e.Field+":"+e.Code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"main/db"
+	"main/message"
+)
+
+// Projects, media and links live in separate SQLite files. A write
+// attaches media and links to a project connection, so one transaction
+// covers all three and commits or rolls back as a whole.
+type projectTx struct {
+	conn     *sql.Conn
+	tx       *sql.Tx
+	attached []string
+}
+
+// Databases in extra, such as audit, join the same transaction
+func beginProjectTx(extra ...string) (*projectTx, error) {
+	attached := append([]string{"media", "links"}, extra...)
+	conn, err := db.Attach("project", attached...)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		db.Detach(conn, attached...)
+		return nil, err
+	}
+	return &projectTx{conn: conn, tx: tx, attached: attached}, nil
+}
+
+// Safe to call after commit, which makes it a no-op
+func (t *projectTx) rollback() {
+	if t.conn == nil {
+		return
+	}
+	t.tx.Rollback()
+	t.close()
+}
+
+func (t *projectTx) commit() error {
+	err := t.tx.Commit()
+	t.close()
+	return err
+}
+
+func (t *projectTx) close() {
+	db.Detach(t.conn, t.attached...)
+	t.conn = nil
+}
+
+// Savepoints let a single operation be undone without
+// giving up the surrounding transaction
+func (t *projectTx) savepoint(name string) error {
+	_, err := t.tx.Exec("SAVEPOINT " + name)
+	return err
+}
+
+func (t *projectTx) rollbackTo(name string) error {
+	_, err := t.tx.Exec("ROLLBACK TO " + name)
+	return err
+}
+
+func (t *projectTx) release(name string) error {
+	_, err := t.tx.Exec("RELEASE " + name)
+	return err
+}
+
+// Create
+func (t *projectTx) createProject(req message.CreateProjectRequest) (int64, error) {
+	res, err := t.tx.Exec(
+		db.Q(db.InsertProject),
+		req.Name,
+		req.Desc,
+		req.Repo,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	projectId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.insertChildren(projectId, req.Photos, req.Videos, req.Links); err != nil {
+		return 0, err
+	}
+	return projectId, nil
+}
+
+// Replaces every field, media item and link. Returns errVersionConflict
+// when the stored version is no longer the expected one.
+func (t *projectTx) replaceProject(
+	id int,
+	version int,
+	req message.UpdateProjectRequest,
+) error {
+	result, err := t.tx.Exec(
+		db.Q(db.UpdateProject),
+		req.Name,
+		req.Desc,
+		req.Repo,
+		id,
+		version,
+	)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errVersionConflict
+	}
+
+	if _, err := t.tx.Exec(db.Q(db.DeleteProjectMedia), id); err != nil {
+		return err
+	}
+	if _, err := t.tx.Exec(db.Q(db.DeleteProjectLinks), id); err != nil {
+		return err
+	}
+
+	return t.insertChildren(int64(id), req.Photos, req.Videos, req.Links)
+}
+
+// Delete
+func (t *projectTx) deleteProject(id int, version int) error {
+	result, err := t.tx.Exec(db.Q(db.DeleteProject), id, version)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errVersionConflict
+	}
+
+	if _, err := t.tx.Exec(db.Q(db.DeleteProjectMedia), id); err != nil {
+		return err
+	}
+	if _, err := t.tx.Exec(db.Q(db.DeleteProjectLinks), id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns sql.ErrNoRows when the project does not exist
+func (t *projectTx) projectVersion(id int) (int, error) {
+	var version int
+	err := t.tx.QueryRow(db.Q(db.GetProjectVersion), id).Scan(&version)
+	return version, err
+}
+
+func (t *projectTx) insertChildren(
+	projectId int64,
+	photos []string,
+	videos []string,
+	links []message.Link,
+) error {
+	for i, photo := range photos {
+		if _, err := t.tx.Exec(db.Q(db.InsertMedia), projectId, "photo", photo, i); err != nil {
+			return err
+		}
+	}
+	for i, video := range videos {
+		if _, err := t.tx.Exec(db.Q(db.InsertMedia), projectId, "video", video, len(photos)+i); err != nil {
+			return err
+		}
+	}
+	for i, link := range links {
+		if _, err := t.tx.Exec(db.Q(db.InsertLink), projectId, link.Name, link.URL, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *projectTx) projectMedia(id int) ([]message.Media, error) {
+	rows, err := t.tx.Query(db.Q(db.GetProjectMedia), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []message.Media{}
+	for rows.Next() {
+		var m message.Media
+		if err := rows.Scan(&m.Id, &m.ProjectId, &m.Type, &m.URL); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+func (t *projectTx) projectLinks(id int) ([]message.Link, error) {
+	rows, err := t.tx.Query(db.Q(db.GetProjectLinks), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []message.Link{}
+	for rows.Next() {
+		var l message.Link
+		if err := rows.Scan(&l.Id, &l.ProjectId, &l.Name, &l.URL); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// The project as this transaction sees it, including earlier writes
+// that are not committed yet
+func (t *projectTx) snapshot(id int) (message.Project, error) {
+	var p message.Project
+	err := t.tx.QueryRow(db.Q(db.GetProjectById), id).Scan(
+		&p.Id,
+		&p.Name,
+		&p.Desc,
+		&p.Repo,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	if p.Media, err = t.projectMedia(id); err != nil {
+		return p, err
+	}
+	p.Links, err = t.projectLinks(id)
+	return p, err
+}
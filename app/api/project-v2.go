@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"main/message"
+	"net/http"
+	"strconv"
+)
+
+// v2 reads the same projects as v1 and only changes their shape.
+// Writes stay on v1 until v2 request bodies are settled.
+
+// Get Projects
+func GetAllProjectsV2Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	entry, err := projectsCache.get()
+	if err != nil {
+		writeInternalError(w, r, "Get projects error", err)
+		return
+	}
+
+	etag := versionETag(entry.etag, V2)
+	setValidators(w, etag, entry.lastModified, cachePolicy.List)
+	if notModified(r, etag, entry.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := message.ProjectListV2{
+		Data: make([]message.ProjectV2, 0, len(entry.projects)),
+		Meta: message.ListMetaV2{Count: len(entry.projects)},
+	}
+	for _, p := range entry.projects {
+		response.Data = append(response.Data, p.V2())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func GetProjectV2Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(projectIdString(r))
+	if err != nil {
+		writeInvalidId(w, r)
+		return
+	}
+
+	p, err := getProject(id)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Get project error", err)
+		return
+	}
+
+	etag := versionETag(projectETag(p), V2)
+	setValidators(w, etag, p.UpdatedAt, cachePolicy.Item)
+	if notModified(r, etag, p.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message.ProjectItemV2{Data: p.V2()})
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/limit"
+	"main/message"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const CodeRateLimited = "rate_limited"
+
+// Route groups, each with its own bucket per client IP
+const (
+	LimitRead    = "read"
+	LimitWrite   = "write"
+	LimitLogin   = "login"
+	LimitUpgrade = "upgrade"
+)
+
+type RateLimitConfig struct {
+	Read    limit.Rate
+	Write   limit.Rate
+	Login   limit.Rate
+	Upgrade limit.Rate
+	// Open WebSocket connections per IP
+	Connections int
+}
+
+var (
+	limiters    = map[string]*limit.Limiter{}
+	connections = limit.NewConnections(0)
+)
+
+func init() {
+	SetRateLimits(RateLimitConfig{})
+}
+
+// Set Rate Limits, zero fields keep their default
+func SetRateLimits(c RateLimitConfig) {
+	defaults := map[string]limit.Rate{
+		LimitRead:    {Limit: 300, Per: time.Minute},
+		LimitWrite:   {Limit: 60, Per: time.Minute},
+		LimitLogin:   {Limit: 10, Per: 15 * time.Minute},
+		LimitUpgrade: {Limit: 30, Per: time.Minute},
+	}
+	configured := map[string]limit.Rate{
+		LimitRead:    c.Read,
+		LimitWrite:   c.Write,
+		LimitLogin:   c.Login,
+		LimitUpgrade: c.Upgrade,
+	}
+
+	for name, rate := range defaults {
+		if configured[name] != (limit.Rate{}) {
+			rate = configured[name]
+		}
+		limiters[name] = limit.NewLimiter(name, rate)
+	}
+
+	if c.Connections <= 0 {
+		c.Connections = 10
+	}
+	connections = limit.NewConnections(c.Connections)
+}
+
+// Rate Limit by method: reads and writes have separate allowances
+func RateLimit(next http.HandlerFunc) http.HandlerFunc {
+	read := RateLimitGroup(LimitRead, next)
+	write := RateLimitGroup(LimitWrite, next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			read(w, r)
+		default:
+			write(w, r)
+		}
+	}
+}
+
+func RateLimitGroup(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, group) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Limit Connections of WebSocket upgrades: how often a client may
+// connect, and how many connections it may hold open at once. Plain
+// requests to the same route count as reads.
+func LimitConnections(next http.HandlerFunc) http.HandlerFunc {
+	read := RateLimitGroup(LimitRead, next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			read(w, r)
+			return
+		}
+		if !allow(w, r, LimitUpgrade) {
+			return
+		}
+
+		ip := clientIp(r)
+		if !connections.Acquire(ip) {
+			log.Printf("Too many connections from %s to %s", ip, r.URL.Path)
+			WriteError(
+				w, r,
+				http.StatusTooManyRequests,
+				CodeRateLimited,
+				"Too many open connections",
+				map[string]interface{}{"limit": "connections", "max": connections.Max()},
+			)
+			return
+		}
+		defer connections.Release(ip)
+
+		next(w, r)
+	}
+}
+
+func allow(w http.ResponseWriter, r *http.Request, group string) bool {
+	limiter := limiters[group]
+	ok, wait := limiter.Allow(clientIp(r))
+	if ok {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	log.Printf("Rate limited %s on %s %s (%s)", clientIp(r), r.Method, r.URL.Path, group)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	WriteError(
+		w, r,
+		http.StatusTooManyRequests,
+		CodeRateLimited,
+		fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter),
+		map[string]interface{}{"limit": group, "retryAfter": retryAfter},
+	)
+	return false
+}
+
+// GET /api/admin/rate-limits shows each group with the clients that
+// used part of their allowance, and open WebSocket connections
+func RateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	const maxClients = 50
+
+	response := message.RateLimitsResponse{Groups: []message.RateLimitGroup{}}
+	for _, name := range []string{LimitRead, LimitWrite, LimitLogin, LimitUpgrade} {
+		state := limiters[name].State(maxClients)
+		group := message.RateLimitGroup{
+			Name:    state.Name,
+			Rate:    state.Rate.String(),
+			Limited: state.Limited,
+			Clients: []message.RateLimitClient{},
+		}
+		for _, c := range state.Clients {
+			group.Clients = append(group.Clients, message.RateLimitClient{
+				Ip:        c.Key,
+				Remaining: int(c.Tokens),
+			})
+		}
+		response.Groups = append(response.Groups, group)
+	}
+
+	conns := connections.State(maxClients)
+	response.Connections = message.ConnectionLimit{
+		Max:      conns.Max,
+		Open:     conns.Open,
+		Rejected: conns.Rejected,
+		Clients:  []message.ConnectionClient{},
+	}
+	for _, c := range conns.Clients {
+		response.Connections.Clients = append(response.Connections.Clients, message.ConnectionClient{
+			Ip:   c.Key,
+			Open: c.Open,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"main/limit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetRateLimits(t *testing.T) {
+	defer SetRateLimits(RateLimitConfig{})
+
+	SetRateLimits(RateLimitConfig{Write: limit.Off, Login: limit.Rate{Limit: 1, Per: time.Second}})
+	for group, want := range map[string]string{
+		LimitRead:    "300/1m",
+		LimitWrite:   "off",
+		LimitLogin:   "1/1s",
+		LimitUpgrade: "30/1m",
+	} {
+		if got := limiters[group].Rate().String(); got != want {
+			t.Errorf("%s: got %s, want %s", group, got, want)
+		}
+	}
+	if connections.Max() != 10 {
+		t.Errorf("got %d connections", connections.Max())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	defer SetRateLimits(RateLimitConfig{})
+	SetRateLimits(RateLimitConfig{
+		Read:  limit.Rate{Limit: 1, Per: time.Hour},
+		Write: limit.Rate{Limit: 2, Per: time.Hour},
+	})
+
+	handler := RateLimit(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(method string, remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/projects", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i, tt := range []struct {
+		method     string
+		remote     string
+		status     int
+		retryAfter string
+	}{
+		{http.MethodGet, "192.0.2.1:1", http.StatusOK, ""},
+		{http.MethodHead, "192.0.2.1:2", http.StatusTooManyRequests, "3600"},
+		{http.MethodPost, "192.0.2.1:3", http.StatusOK, ""},
+		{http.MethodDelete, "192.0.2.1:4", http.StatusOK, ""},
+		{http.MethodPut, "192.0.2.1:5", http.StatusTooManyRequests, "1800"},
+		{http.MethodGet, "192.0.2.2:1", http.StatusOK, ""},
+	} {
+		w := request(tt.method, tt.remote)
+		if w.Code != tt.status {
+			t.Errorf("%d %s: got %d, want %d", i, tt.method, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusTooManyRequests {
+			continue
+		}
+		if w.Header().Get("Retry-After") != tt.retryAfter || decodeError(t, w).Code != CodeRateLimited {
+			t.Errorf("%d %s: got %v %s", i, tt.method, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestLimitConnections(t *testing.T) {
+	defer SetRateLimits(RateLimitConfig{})
+	SetRateLimits(RateLimitConfig{Connections: 1})
+
+	upgrade := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		return r
+	}
+
+	var inner *httptest.ResponseRecorder
+	handler := LimitConnections(func(w http.ResponseWriter, r *http.Request) {
+		// A second connection while the first is open
+		if inner == nil {
+			inner = httptest.NewRecorder()
+			LimitConnections(func(http.ResponseWriter, *http.Request) {})(inner, upgrade())
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, upgrade())
+	if w.Code != http.StatusOK || inner.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d and %d", w.Code, inner.Code)
+	}
+	if state := connections.State(10); state.Open != 0 || state.Rejected != 1 {
+		t.Errorf("got %+v", state)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, upgrade())
+	if w.Code != http.StatusOK {
+		t.Errorf("slot was not released: got %d", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replaced by the request's nonce in the policy and in served pages
+const noncePlaceholder = "{nonce}"
+
+// Scripts run only with the page's nonce, which the modules they import
+// inherit. Media URLs may be http or https like validation allows.
+const defaultCSP = "default-src 'self'; " +
+	"script-src 'nonce-{nonce}'; " +
+	"style-src 'self'; " +
+	"img-src 'self' http: https: data:; " +
+	"media-src 'self' http: https:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'; " +
+	"report-uri /api/csp-report; " +
+	"report-to csp"
+
+type SecurityConfig struct {
+	// Content-Security-Policy, "off" sends none
+	CSP string
+	// Only report violations instead of blocking
+	ReportOnly bool
+	// Strict-Transport-Security max-age, sent over TLS only
+	HSTSMaxAge time.Duration
+	// Extends HSTS to every subdomain, which then must serve HTTPS too
+	HSTSIncludeSubDomains bool
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+}
+
+var security = SecurityConfig{}
+
+func init() {
+	SetSecurityConfig(SecurityConfig{})
+}
+
+// Set Security Config, empty fields keep their default
+func SetSecurityConfig(c SecurityConfig) {
+	if c.CSP == "" {
+		c.CSP = defaultCSP
+	}
+	if c.HSTSMaxAge <= 0 {
+		c.HSTSMaxAge = 180 * 24 * time.Hour
+	}
+	if c.FrameOptions == "" {
+		c.FrameOptions = "DENY"
+	}
+	if c.ReferrerPolicy == "" {
+		c.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if c.PermissionsPolicy == "" {
+		c.PermissionsPolicy = "camera=(), microphone=(), geolocation=(), payment=(), usb=()"
+	}
+	security = c
+}
+
+type nonceKey struct{}
+
+// Nonce for inline and module scripts of the page being served
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+// Security Headers on every response, with a fresh script nonce
+func SecurityHeaders(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", security.FrameOptions)
+		h.Set("Referrer-Policy", security.ReferrerPolicy)
+		h.Set("Permissions-Policy", security.PermissionsPolicy)
+		if tlsRequest(r) {
+			hsts := "max-age=" + strconv.Itoa(int(security.HSTSMaxAge.Seconds()))
+			if security.HSTSIncludeSubDomains {
+				hsts += "; includeSubDomains"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		if security.CSP != "off" {
+			policy := security.CSP
+			// Only a policy that uses a nonce makes pages uncacheable
+			if strings.Contains(policy, noncePlaceholder) {
+				nonce := newNonce()
+				policy = strings.ReplaceAll(policy, noncePlaceholder, nonce)
+				r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+			}
+			header := "Content-Security-Policy"
+			if security.ReportOnly {
+				header = "Content-Security-Policy-Report-Only"
+			}
+			h.Set(header, policy)
+			h.Set("Reporting-Endpoints", `csp="/api/csp-report"`)
+		}
+
+		next(w, r)
+	}
+}
+
+// Serve an HTML page as a template, whose script tags carry
+// nonce="{{.Nonce}}". Parsed on every request, so pages edited on disk
+// show up on reload.
+func ServeHTML(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) {
+	source, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		log.Printf("Page %s error: %v", name, err)
+		http.NotFound(w, r)
+		return
+	}
+	page, err := template.New(name).Parse(string(source))
+	if err != nil {
+		writeInternalError(w, r, "Page template error", err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := page.Execute(&body, htmlPage{Nonce: CSPNonce(r)}); err != nil {
+		writeInternalError(w, r, "Page template error", err)
+		return
+	}
+	content := assetManifest.Rewrite(body.Bytes())
+
+	noStoreNonced(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	if r.Method != http.MethodHead {
+		w.Write(content)
+	}
+}
+
+type htmlPage struct {
+	Nonce string
+}
+
+// A page with the request's nonce in it only matches that response's
+// policy. Kept by a browser through a 304, or by a shared cache, it
+// would meet another nonce and have its scripts blocked.
+func noStoreNonced(w http.ResponseWriter, r *http.Request) {
+	if CSPNonce(r) == "" {
+		return
+	}
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Del("ETag")
+	h.Del("Last-Modified")
+}
+
+// HSTS only means something on a connection that already is HTTPS
+func tlsRequest(r *http.Request) bool {
+	return r.TLS != nil || (trustProxy && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("CSP nonce error: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
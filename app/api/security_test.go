@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	defer SetSecurityConfig(SecurityConfig{})
+
+	tests := []struct {
+		name   string
+		config SecurityConfig
+		tls    bool
+		hsts   string
+		csp    string
+	}{
+		{"plain HTTP", SecurityConfig{}, false, "", "Content-Security-Policy"},
+		{"TLS", SecurityConfig{}, true, "max-age=15552000", "Content-Security-Policy"},
+		{
+			"subdomains",
+			SecurityConfig{HSTSMaxAge: time.Hour, HSTSIncludeSubDomains: true},
+			true, "max-age=3600; includeSubDomains", "Content-Security-Policy",
+		},
+		{"report only", SecurityConfig{ReportOnly: true}, false, "", "Content-Security-Policy-Report-Only"},
+		{"no policy", SecurityConfig{CSP: "off"}, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		SetSecurityConfig(tt.config)
+		var nonce string
+		handler := SecurityHeaders(func(w http.ResponseWriter, r *http.Request) { nonce = CSPNonce(r) })
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		h := w.Header()
+		if got := h.Get("Strict-Transport-Security"); got != tt.hsts {
+			t.Errorf("%s: got HSTS %q, want %q", tt.name, got, tt.hsts)
+		}
+		if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: got %v", tt.name, h)
+		}
+		if tt.csp == "" {
+			if nonce != "" || h.Get("Content-Security-Policy") != "" {
+				t.Errorf("%s: got a policy with the CSP off", tt.name)
+			}
+			continue
+		}
+		if len(nonce) != 22 || !strings.Contains(h.Get(tt.csp), "script-src 'nonce-"+nonce+"';") {
+			t.Errorf("%s: nonce %q is not the only script source in %q", tt.name, nonce, h.Get(tt.csp))
+		}
+		if !strings.Contains(h.Get(tt.csp), "img-src 'self' http: https:") {
+			t.Errorf("%s: http media refused by %q", tt.name, h.Get(tt.csp))
+		}
+	}
+}
+
+func TestServeHTML(t *testing.T) {
+	defer SetSecurityConfig(SecurityConfig{})
+	fsys := fstest.MapFS{
+		"index.html":  {Data: []byte(`<head><script nonce="{{.Nonce}}" type="module" src="/main.js"></script></head><p>&lt;script&gt;</p>`)},
+		"broken.html": {Data: []byte(`<p>{{.Nonce</p>`)},
+	}
+	serve := func(name string) (*httptest.ResponseRecorder, string) {
+		var nonce string
+		w := httptest.NewRecorder()
+		SecurityHeaders(func(w http.ResponseWriter, r *http.Request) {
+			nonce = CSPNonce(r)
+			ServeHTML(w, r, fsys, name)
+		})(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w, nonce
+	}
+
+	w, nonce := serve("index.html")
+	want := `<head><script nonce="` + nonce + `" type="module" src="/main.js"></script></head><p>&lt;script&gt;</p>`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("nonced page is cacheable: %v", w.Header())
+	}
+
+	SetSecurityConfig(SecurityConfig{CSP: "default-src 'self'"})
+	w, _ = serve("index.html")
+	if !strings.Contains(w.Body.String(), `<script nonce="" type="module"`) || w.Header().Get("Cache-Control") == "no-store" {
+		t.Errorf("without a nonce: got %v %s", w.Header(), w.Body.String())
+	}
+
+	if w, _ := serve("broken.html"); w.Code != http.StatusInternalServerError {
+		t.Errorf("broken template: got %d", w.Code)
+	}
+	if w, _ := serve("missing.html"); w.Code != http.StatusNotFound {
+		t.Errorf("missing page: got %d", w.Code)
+	}
+}
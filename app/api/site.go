@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Public metadata for feeds and pages. Every stored project is
+// considered published.
+type SiteConfig struct {
+	URL         string
+	Title       string
+	Description string
+	Author      string
+	AuthorEmail string
+	AuthorURL   string
+	FeedLimit   int
+
+	// URLs per sitemap before /sitemap.xml becomes an index
+	SitemapLimit int
+
+	// Paths crawlers are asked to skip, or the full robots.txt to
+	// serve instead of the generated one
+	RobotsDisallow []string
+	Robots         string
+}
+
+const (
+	defaultFeedLimit = 50
+	// The sitemap protocol allows at most 50,000 URLs per file
+	maxSitemapLimit = 50000
+)
+
+var site = SiteConfig{
+	Title:        "Projects",
+	FeedLimit:    defaultFeedLimit,
+	SitemapLimit: maxSitemapLimit,
+}
+
+// Set Site Config
+func SetSiteConfig(config SiteConfig) {
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	if config.Title == "" {
+		config.Title = "Projects"
+	}
+	if config.FeedLimit <= 0 {
+		config.FeedLimit = defaultFeedLimit
+	}
+	if config.SitemapLimit <= 0 || config.SitemapLimit > maxSitemapLimit {
+		config.SitemapLimit = maxSitemapLimit
+	}
+	site = config
+}
+
+// Set Site URL
+func SetSiteURL(url string) {
+	site.URL = strings.TrimSuffix(url, "/")
+}
+
+// Configured public URL, or the one the request came in on. The scheme
+// only follows X-Forwarded-Proto behind a trusted proxy, like HSTS.
+func siteURL(r *http.Request) string {
+	if site.URL != "" {
+		return site.URL
+	}
+
+	scheme := "http"
+	if tlsRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func projectURL(base string, id int) string {
+	return base + "/projects/" + strconv.Itoa(id)
+}
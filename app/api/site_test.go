@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteURL(t *testing.T) {
+	defer SetTrustProxy(false)
+	defer SetSiteConfig(SiteConfig{})
+
+	tests := []struct {
+		name  string
+		url   string
+		trust bool
+		proto string
+		want  string
+	}{
+		{"request", "", false, "", "http://example.com"},
+		{"untrusted proxy", "", false, "https", "http://example.com"},
+		{"trusted proxy", "", true, "https", "https://example.com"},
+		{"configured", "https://site.example/", true, "http", "https://site.example"},
+	}
+
+	for _, tt := range tests {
+		SetSiteConfig(SiteConfig{URL: tt.url})
+		SetTrustProxy(tt.trust)
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/feed.xml", nil)
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		if got := siteURL(r); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
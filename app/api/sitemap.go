@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/xml"
+	"io"
+	"main/message"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	NS       string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// The index page and every project, oldest first so page contents stay
+// stable as projects are added
+func sitemapURLs(base string, entry *cacheEntry) []sitemapURL {
+	projects := append([]message.Project(nil), entry.projects...)
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Id < projects[j].Id })
+
+	urls := []sitemapURL{{Loc: base + "/", LastMod: lastMod(entry.lastModified)}}
+	for _, p := range projects {
+		urls = append(urls, sitemapURL{Loc: projectURL(base, p.Id), LastMod: lastMod(p.UpdatedAt)})
+	}
+	return urls
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// /sitemap.xml lists every URL, or once there are more than the limit,
+// indexes the numbered pages under /sitemaps/. Both are rebuilt from the
+// cached project list, so they change whenever a project does.
+func SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	page := 0
+	if strings.HasPrefix(r.URL.Path, "/sitemaps/") {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/sitemaps/"), ".xml"))
+		if err != nil || n < 1 || !strings.HasSuffix(r.URL.Path, ".xml") {
+			writeNotFound(w, r)
+			return
+		}
+		page = n
+	}
+
+	entry, err := projectsCache.get()
+	if err != nil {
+		writeInternalError(w, r, "Sitemap projects error", err)
+		return
+	}
+
+	urls := len(entry.projects) + 1
+	if page > (urls+site.SitemapLimit-1)/site.SitemapLimit {
+		writeNotFound(w, r)
+		return
+	}
+
+	etag := versionETag(entry.etag, "sitemap-"+strconv.Itoa(page))
+	setValidators(w, etag, entry.lastModified, cachePolicy.List)
+	if notModified(r, etag, entry.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	writeSitemap(w, siteURL(r), entry, page)
+}
+
+func writeSitemap(w io.Writer, base string, entry *cacheEntry, page int) error {
+	urls := sitemapURLs(base, entry)
+	limit := site.SitemapLimit
+
+	var doc interface{}
+	switch {
+	case page > 0:
+		end := page * limit
+		if end > len(urls) {
+			end = len(urls)
+		}
+		doc = sitemapURLSet{NS: sitemapNS, URLs: urls[(page-1)*limit : end]}
+
+	case len(urls) > limit:
+		index := sitemapIndex{NS: sitemapNS}
+		for start, n := 0, 1; start < len(urls); start, n = start+limit, n+1 {
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{
+				Loc:     base + "/sitemaps/" + strconv.Itoa(n) + ".xml",
+				LastMod: lastMod(entry.lastModified),
+			})
+		}
+		doc = index
+
+	default:
+		doc = sitemapURLSet{NS: sitemapNS, URLs: urls}
+	}
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// Robots
+func RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.WriteString(w, robots(siteURL(r)))
+}
+
+// A custom robots.txt is served as is, with the sitemap added when it
+// does not name one
+func robots(base string) string {
+	sitemap := "Sitemap: " + base + "/sitemap.xml\n"
+
+	if site.Robots != "" {
+		body := strings.TrimRight(site.Robots, "\n") + "\n"
+		if !strings.Contains(strings.ToLower(body), "sitemap:") {
+			body += "\n" + sitemap
+		}
+		return body
+	}
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(site.RobotsDisallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, path := range site.RobotsDisallow {
+		b.WriteString("Disallow: " + path + "\n")
+	}
+	b.WriteString("\n" + sitemap)
+	return b.String()
+}
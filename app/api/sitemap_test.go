@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"main/message"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sitemapEntry(n int) *cacheEntry {
+	updated := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	entry := &cacheEntry{lastModified: updated}
+	for id := n; id >= 1; id-- {
+		entry.projects = append(entry.projects, message.Project{Id: id, UpdatedAt: updated.AddDate(0, 0, -id)})
+	}
+	return entry
+}
+
+func TestLastMod(t *testing.T) {
+	if got := lastMod(time.Time{}); got != "" {
+		t.Errorf("zero time: got %q", got)
+	}
+	at := time.Date(2026, 4, 1, 2, 0, 0, 0, time.FixedZone("x", 7200))
+	if got := lastMod(at); got != "2026-04-01T00:00:00Z" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSitemapURLs(t *testing.T) {
+	entry := sitemapEntry(2)
+	got := sitemapURLs("https://example.com", entry)
+
+	want := []sitemapURL{
+		{Loc: "https://example.com/", LastMod: "2026-04-01T00:00:00Z"},
+		{Loc: "https://example.com/projects/1", LastMod: "2026-03-31T00:00:00Z"},
+		{Loc: "https://example.com/projects/2", LastMod: "2026-03-30T00:00:00Z"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if entry.projects[0].Id != 2 {
+		t.Error("cached projects were reordered")
+	}
+}
+
+func TestWriteSitemap(t *testing.T) {
+	defer SetSiteConfig(SiteConfig{})
+	SetSiteConfig(SiteConfig{SitemapLimit: 2})
+
+	tests := []struct {
+		name     string
+		projects int
+		page     int
+		root     string
+		locs     []string
+	}{
+		{"fits", 1, 0, "urlset", []string{"https://example.com/", "https://example.com/projects/1"}},
+		{"index", 3, 0, "sitemapindex", []string{"https://example.com/sitemaps/1.xml", "https://example.com/sitemaps/2.xml"}},
+		{"first page", 3, 1, "urlset", []string{"https://example.com/", "https://example.com/projects/1"}},
+		{"last page", 3, 2, "urlset", []string{"https://example.com/projects/2", "https://example.com/projects/3"}},
+	}
+
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := writeSitemap(&b, "https://example.com", sitemapEntry(tt.projects), tt.page); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var doc struct {
+			XMLName  xml.Name
+			URLs     []string `xml:"url>loc"`
+			Sitemaps []string `xml:"sitemap>loc"`
+		}
+		if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+			t.Fatalf("%s: %v\n%s", tt.name, err, b.String())
+		}
+		if doc.XMLName.Local != tt.root || doc.XMLName.Space != sitemapNS {
+			t.Errorf("%s: got root %v", tt.name, doc.XMLName)
+		}
+		locs := append(doc.URLs, doc.Sitemaps...)
+		if strings.Join(locs, " ") != strings.Join(tt.locs, " ") {
+			t.Errorf("%s: got %v, want %v", tt.name, locs, tt.locs)
+		}
+	}
+}
+
+func TestRobots(t *testing.T) {
+	defer SetSiteConfig(SiteConfig{})
+
+	tests := []struct {
+		name   string
+		config SiteConfig
+		want   string
+	}{
+		{
+			"default",
+			SiteConfig{},
+			"User-agent: *\nDisallow:\n\nSitemap: https://example.com/sitemap.xml\n",
+		},
+		{
+			"disallowed paths",
+			SiteConfig{RobotsDisallow: []string{"/admin", "/api/"}},
+			"User-agent: *\nDisallow: /admin\nDisallow: /api/\n\nSitemap: https://example.com/sitemap.xml\n",
+		},
+		{
+			"custom",
+			SiteConfig{Robots: "User-agent: *\nDisallow: /\n\n"},
+			"User-agent: *\nDisallow: /\n\nSitemap: https://example.com/sitemap.xml\n",
+		},
+		{
+			"custom with a sitemap",
+			SiteConfig{Robots: "User-agent: *\nSITEMAP: https://cdn.example.com/s.xml"},
+			"User-agent: *\nSITEMAP: https://cdn.example.com/s.xml\n",
+		},
+	}
+
+	for _, tt := range tests {
+		SetSiteConfig(tt.config)
+		if got := robots("https://example.com"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
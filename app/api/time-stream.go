@@ -6,6 +6,8 @@ import (
 	"main/ws"
 	"net/http"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type TimeUpdate struct {
@@ -15,8 +17,33 @@ type TimeUpdate struct {
 	Unix      int64  `json:"unix"`
 }
 
+type TimeComponents struct {
+	Year   int `json:"year"`
+	Month  int `json:"month"`
+	Day    int `json:"day"`
+	Hour   int `json:"hour"`
+	Minute int `json:"minute"`
+	Second int `json:"second"`
+}
+
+type CurrentTime struct {
+	Type       string         `json:"type"`
+	Timestamp  string         `json:"timestamp"`
+	Formatted  string         `json:"formatted"`
+	Unix       int64          `json:"unix"`
+	Timezone   string         `json:"timezone"`
+	Day        string         `json:"day"`
+	Date       string         `json:"date"`
+	Time       string         `json:"time"`
+	Components TimeComponents `json:"components"`
+}
+
 func TimeStreamHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Upgrade") == "websocket" {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+	if websocket.IsWebSocketUpgrade(r) {
 		setTimeStream(w, r)
 		return
 	}
@@ -73,22 +100,22 @@ func setTimeStream(w http.ResponseWriter, r *http.Request) {
 func displayTimeStream(w http.ResponseWriter) {
 	now := time.Now()
 
-	data := map[string]interface{}{
-		"type":      "currentTime",
-		"timestamp": now.Format(time.RFC3339),
-		"formatted": now.Format("2006-01-02 15:04:05"),
-		"unix":      now.Unix(),
-		"timezone":  now.Location().String(),
-		"day":       now.Format("Monday"),
-		"date":      now.Format("January 2, 2006"),
-		"time":      now.Format("3:04:05 PM"),
-		"components": map[string]interface{}{
-			"year":   now.Year(),
-			"month":  int(now.Month()),
-			"day":    now.Day(),
-			"hour":   now.Hour(),
-			"minute": now.Minute(),
-			"second": now.Second(),
+	data := CurrentTime{
+		Type:      "currentTime",
+		Timestamp: now.Format(time.RFC3339),
+		Formatted: now.Format("2006-01-02 15:04:05"),
+		Unix:      now.Unix(),
+		Timezone:  now.Location().String(),
+		Day:       now.Format("Monday"),
+		Date:      now.Format("January 2, 2006"),
+		Time:      now.Format("3:04:05 PM"),
+		Components: TimeComponents{
+			Year:   now.Year(),
+			Month:  int(now.Month()),
+			Day:    now.Day(),
+			Hour:   now.Hour(),
+			Minute: now.Minute(),
+			Second: now.Second(),
 		},
 	}
 
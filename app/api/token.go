@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"main/auth"
+	"main/message"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GET lists the admin's API tokens, POST creates one. Only a signed in
+// admin gets here, see RequireAdmin.
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	principal := CurrentPrincipal(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := auth.ListTokens(principal.AdminId)
+		if err != nil {
+			writeInternalError(w, r, "List tokens error", err)
+			return
+		}
+
+		response := make([]message.TokenResponse, 0, len(tokens))
+		for _, token := range tokens {
+			response = append(response, tokenResponse(token))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		limitBody(w, r)
+
+		var req message.CreateTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		if errs := validateTokenRequest(req); len(errs) > 0 {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+
+		plain, token, err := auth.CreateToken(principal.AdminId, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			writeInternalError(w, r, "Create token error", err)
+			return
+		}
+		token.Username = principal.Username
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message.CreateTokenResponse{
+			TokenResponse: tokenResponse(token),
+			Token:         plain,
+		})
+
+	default:
+		WriteMethodNotAllowed(w, r)
+	}
+}
+
+// DELETE /api/auth/tokens/{id} revokes a token. It stays in the list,
+// marked revoked, so its last use can still be looked up.
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/auth/tokens/"))
+	if err != nil || id <= 0 {
+		writeInvalidId(w, r)
+		return
+	}
+
+	err = auth.RevokeToken(CurrentPrincipal(r).AdminId, id)
+	if errors.Is(err, auth.ErrNoToken) {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Token not found", nil)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Revoke token error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateTokenRequest(req message.CreateTokenRequest) message.ValidationErrors {
+	errs := message.ValidationErrors{}
+
+	if strings.TrimSpace(req.Name) == "" {
+		errs = append(errs, message.FieldError{
+			Field:   "name",
+			Code:    message.CodeRequired,
+			Message: "is required",
+		})
+	}
+	if err := auth.ValidateScopes(req.Scopes); err != nil {
+		errs = append(errs, message.FieldError{
+			Field:   "scopes",
+			Code:    message.CodeInvalidValue,
+			Message: err.Error() + ", allowed: " + strings.Join(auth.Scopes, ", "),
+		})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errs = append(errs, message.FieldError{
+			Field:   "expiresAt",
+			Code:    message.CodeInvalidValue,
+			Message: "must be in the future",
+		})
+	}
+
+	return errs
+}
+
+func tokenResponse(token *auth.Token) message.TokenResponse {
+	return message.TokenResponse{
+		Id:         token.Id,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
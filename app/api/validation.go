@@ -0,0 +1,31 @@
+package api
+
+import (
+	"log"
+	"main/message"
+	"net/http"
+)
+
+const maxProjectBodySize = 1 << 20
+
+// Limit Body
+func limitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProjectBodySize)
+}
+
+// Write Validation Errors
+func writeValidationErrors(
+	w http.ResponseWriter,
+	r *http.Request,
+	errs message.ValidationErrors,
+) {
+	log.Printf("[%s] Validation failed: %v", RequestId(r), errs)
+
+	WriteError(
+		w, r,
+		http.StatusUnprocessableEntity,
+		CodeValidationFailed,
+		"One or more fields are invalid",
+		errs,
+	)
+}
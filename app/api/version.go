@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// Every version served side by side, oldest first
+var Versions = []string{V1, V2}
+
+// Unversioned paths answer exactly like this version
+const aliasVersion = V1
+
+// Deprecates the unversioned paths rather than a version
+const Aliases = "aliases"
+
+type deprecation struct {
+	since  time.Time
+	sunset time.Time
+}
+
+var deprecations = map[string]deprecation{}
+
+// Deprecate marks a version as deprecated from since, to be removed at
+// sunset. Dates are YYYY-MM-DD and sunset may be empty.
+func Deprecate(version string, since string, sunset string) error {
+	if since == "" {
+		delete(deprecations, version)
+		return nil
+	}
+
+	d := deprecation{}
+	var err error
+	if d.since, err = time.Parse(time.DateOnly, since); err != nil {
+		return fmt.Errorf("deprecation date for %s: %w", version, err)
+	}
+	if sunset != "" {
+		if d.sunset, err = time.Parse(time.DateOnly, sunset); err != nil {
+			return fmt.Errorf("sunset date for %s: %w", version, err)
+		}
+	}
+
+	deprecations[version] = d
+	return nil
+}
+
+func isDeprecated(version string) bool {
+	_, ok := deprecations[version]
+	return ok
+}
+
+// Versioned tags responses with the version that produced them and
+// announces its deprecation once configured
+func Versioned(version string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", version)
+
+		if d, ok := deprecations[version]; ok {
+			d.setHeaders(w)
+			successor := successorOf(version)
+			path := "/api/" + successor + strings.TrimPrefix(r.URL.Path, "/api/"+version)
+			if successor != "" && hasRoute(successor, path) {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// Alias serves an unversioned path, which points to the same path under
+// the alias version as its successor and announces its deprecation once
+// configured
+func Alias(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", aliasVersion)
+		if d, ok := deprecations[Aliases]; ok {
+			d.setHeaders(w)
+		}
+		w.Header().Add("Link", fmt.Sprintf(
+			`<%s>; rel="successor-version"`,
+			VersionedPath(aliasVersion, r.URL.Path),
+		))
+
+		next(w, r)
+	}
+}
+
+func (d deprecation) setHeaders(w http.ResponseWriter) {
+	w.Header().Set("Deprecation", deprecationHeader(d.since))
+	if !d.sunset.IsZero() {
+		w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// RFC 9745: a Structured Field Date, @ and seconds since the epoch
+func deprecationHeader(since time.Time) string {
+	return fmt.Sprintf("@%d", since.Unix())
+}
+
+func successorOf(version string) string {
+	for i, v := range Versions {
+		if v == version && i+1 < len(Versions) {
+			return Versions[i+1]
+		}
+	}
+	return ""
+}
+
+// Whether a version serves the path, by the mux's own matching rules
+func hasRoute(version string, path string) bool {
+	for _, route := range Routes {
+		if route.Version != version {
+			continue
+		}
+		if route.Pattern == path ||
+			strings.HasSuffix(route.Pattern, "/") && strings.HasPrefix(path, route.Pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionedPath maps an unversioned path to its place in a version,
+// /api/projects/1 and /count becoming /api/v1/projects/1 and /api/v1/count
+func VersionedPath(version string, path string) string {
+	return "/api/" + version + strings.TrimPrefix(path, "/api")
+}
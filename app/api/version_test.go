@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeprecationHeaders(t *testing.T) {
+	if err := Deprecate(V1, "2026-01-01", "2026-07-01"); err != nil {
+		t.Fatal(err)
+	}
+	defer Deprecate(V1, "", "")
+	if err := Deprecate(Aliases, "2026-10-19", ""); err != nil {
+		t.Fatal(err)
+	}
+	defer Deprecate(Aliases, "", "")
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		want    time.Time
+		sunset  string
+	}{
+		{"versioned", Versioned(V1, ok), "/api/v1/projects", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "Wed, 01 Jul 2026 00:00:00 GMT"},
+		{"alias", Alias(ok), "/api/projects", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(tt.want.Unix(), 10); got != want {
+			t.Errorf("%s: got Deprecation %q, want %q", tt.name, got, want)
+		}
+		if got := w.Header().Get("Sunset"); got != tt.sunset {
+			t.Errorf("%s: got Sunset %q, want %q", tt.name, got, tt.sunset)
+		}
+		if got := w.Header().Get("Api-Version"); got != V1 {
+			t.Errorf("%s: got Api-Version %q", tt.name, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Versioned(V2, ok)(w, httptest.NewRequest(http.MethodGet, "/api/v2/projects", nil))
+	if got := w.Header().Get("Deprecation"); got != "" {
+		t.Errorf("v2: got Deprecation %q", got)
+	}
+
+	if err := Deprecate(Aliases, "2026-10-19", "2027-04-19"); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	Alias(ok)(w, httptest.NewRequest(http.MethodGet, "/api/projects", nil))
+	if got := w.Header().Get("Sunset"); got != "Mon, 19 Apr 2027 00:00:00 GMT" {
+		t.Errorf("alias: got Sunset %q", got)
+	}
+
+	Deprecate(Aliases, "", "")
+	w = httptest.NewRecorder()
+	Alias(ok)(w, httptest.NewRequest(http.MethodGet, "/api/projects", nil))
+	if got, link := w.Header().Get("Deprecation"), w.Header().Get("Link"); got != "" || link != `</api/v1/projects>; rel="successor-version"` {
+		t.Errorf("unconfigured alias: got Deprecation %q and Link %q", got, link)
+	}
+}
+
+func TestDeprecateInvalidDates(t *testing.T) {
+	tests := []struct{ since, sunset string }{
+		{"2026-13-01", ""},
+		{"01/01/2026", ""},
+		{"2026-01-01", "soon"},
+	}
+	for _, tt := range tests {
+		if err := Deprecate(V1, tt.since, tt.sunset); err == nil {
+			t.Errorf("%q, %q: no error", tt.since, tt.sunset)
+		}
+	}
+	if isDeprecated(V1) {
+		t.Error("v1 deprecated by an invalid date")
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"main/message"
+	"main/ws"
+	"net/http"
+)
+
+// GET /api/admin/ws-origins lists the origins allowed to open sockets
+// and how often others tried
+func WebSocketOriginsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	response := message.WebSocketOriginsResponse{
+		Allowed:  ws.AllowedOrigins(),
+		Rejected: []message.RejectedOrigin{},
+	}
+	for _, o := range ws.RejectedOrigins() {
+		response.Rejected = append(response.Rejected, message.RejectedOrigin{Origin: o.Origin, Count: o.Count})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
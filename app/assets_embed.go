@@ -0,0 +1,20 @@
+//go:build embed
+
+package main
+
+import (
+	"embed"
+	"main/config"
+)
+
+// Built with -tags embed after compiling the scripts, the binary carries
+// its pages, scripts and styles:
+//
+//	npm run build && go build -tags embed
+//
+//go:embed server/*.html .out .styles
+var embeddedAssets embed.FS
+
+func init() {
+	config.SetEmbeddedAssets(embeddedAssets)
+}
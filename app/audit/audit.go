@@ -0,0 +1,442 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"main/db"
+	"main/message"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+var Actions = []string{ActionCreate, ActionUpdate, ActionDelete, ActionRestore}
+
+// Entities
+const (
+	EntityProject = "project"
+	EntityMedia   = "media"
+	EntityLink    = "link"
+)
+
+var Entities = []string{EntityProject, EntityMedia, EntityLink}
+
+// Actor types
+const (
+	ActorSession = "session"
+	ActorToken   = "token"
+)
+
+var (
+	ErrNoEntry         = errors.New("audit entry not found")
+	ErrAlreadyRestored = errors.New("audit entry already restored")
+)
+
+// Changes turns a project's state before and after a write into entries,
+// one for the project and one per media item or link that changed.
+// before is nil for a create, after is nil for a delete.
+func Changes(before, after *message.Project) []message.AuditEntry {
+	entries := []message.AuditEntry{}
+
+	projectId := 0
+	var beforeMedia, afterMedia []message.Media
+	var beforeLinks, afterLinks []message.Link
+	if before != nil {
+		projectId = before.Id
+		beforeMedia, beforeLinks = before.Media, before.Links
+	}
+	if after != nil {
+		projectId = after.Id
+		afterMedia, afterLinks = after.Media, after.Links
+	}
+
+	for _, pair := range matchMedia(beforeMedia, afterMedia) {
+		if entry, ok := change(EntityMedia, projectId, pair[0], pair[1]); ok {
+			entries = append(entries, entry)
+		}
+	}
+	for _, pair := range matchLinks(beforeLinks, afterLinks) {
+		if entry, ok := change(EntityLink, projectId, pair[0], pair[1]); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	// Any write bumps the version, so the project always has an entry
+	// when something changed
+	if project, ok := change(EntityProject, projectId, projectOrNil(before), projectOrNil(after)); ok {
+		entries = append([]message.AuditEntry{project}, entries...)
+	}
+	return entries
+}
+
+// Restored projects come back as new rows, every entry says so
+func Restored(after *message.Project, from int) []message.AuditEntry {
+	entries := Changes(nil, after)
+	for i := range entries {
+		entries[i].Action = ActionRestore
+		entries[i].RestoredFrom = from
+	}
+	return entries
+}
+
+func projectOrNil(p *message.Project) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// Builds one entry from two snapshots of the same thing, false when
+// nothing worth recording changed
+func change(entity string, projectId int, before, after interface{}) (message.AuditEntry, bool) {
+	entry := message.AuditEntry{
+		Entity:    entity,
+		ProjectId: projectId,
+	}
+
+	beforeFields := fields(before)
+	afterFields := fields(after)
+	switch {
+	case before == nil:
+		entry.Action = ActionCreate
+		entry.EntityId = id(afterFields)
+	case after == nil:
+		entry.Action = ActionDelete
+		entry.EntityId = id(beforeFields)
+	default:
+		entry.Action = ActionUpdate
+		entry.EntityId = id(afterFields)
+	}
+
+	entry.Diff = diff(beforeFields, afterFields)
+	if len(entry.Diff) == 0 {
+		return entry, false
+	}
+	entry.Before = raw(before)
+	entry.After = raw(after)
+	return entry, true
+}
+
+// Fields compared in a diff. Children get entries of their own and the
+// timestamps follow from the entry's own time.
+func fields(v interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	if v == nil {
+		return out
+	}
+
+	b, _ := json.Marshal(v)
+	json.Unmarshal(b, &out)
+	for _, skip := range []string{"media", "links", "createdAt", "updatedAt", "projectId"} {
+		delete(out, skip)
+	}
+	return out
+}
+
+func id(fields map[string]interface{}) int {
+	n, _ := fields["id"].(float64)
+	return int(n)
+}
+
+func diff(before, after map[string]interface{}) map[string]message.AuditChange {
+	out := map[string]message.AuditChange{}
+	for key, value := range before {
+		if key == "id" {
+			continue
+		}
+		if other, ok := after[key]; !ok || other != value {
+			out[key] = message.AuditChange{Before: value, After: after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok && key != "id" {
+			out[key] = message.AuditChange{Before: nil, After: value}
+		}
+	}
+	return out
+}
+
+func raw(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// Pairs up media by content, then by id. A full replace gives every
+// item a new id without changing it, an edited item keeps its id.
+func matchMedia(before, after []message.Media) [][2]interface{} {
+	return match(len(before), len(after),
+		func(i, j int) bool { return before[i].Id == after[j].Id },
+		func(i, j int) bool { return before[i].Type == after[j].Type && before[i].URL == after[j].URL },
+		func(i int) interface{} { return before[i] },
+		func(j int) interface{} { return after[j] },
+	)
+}
+
+func matchLinks(before, after []message.Link) [][2]interface{} {
+	return match(len(before), len(after),
+		func(i, j int) bool { return before[i].Id == after[j].Id },
+		func(i, j int) bool { return before[i].Name == after[j].Name && before[i].URL == after[j].URL },
+		func(i int) interface{} { return before[i] },
+		func(j int) interface{} { return after[j] },
+	)
+}
+
+// Pairs share content or, failing that, an id. Whatever is left over
+// was created or deleted.
+func match(
+	nBefore, nAfter int,
+	sameId, sameContent func(i, j int) bool,
+	beforeAt, afterAt func(int) interface{},
+) [][2]interface{} {
+	pairs := [][2]interface{}{}
+	usedBefore := make([]bool, nBefore)
+	usedAfter := make([]bool, nAfter)
+
+	for _, same := range []func(i, j int) bool{sameContent, sameId} {
+		for i := 0; i < nBefore; i++ {
+			for j := 0; j < nAfter && !usedBefore[i]; j++ {
+				if usedAfter[j] || !same(i, j) {
+					continue
+				}
+				usedBefore[i], usedAfter[j] = true, true
+				pairs = append(pairs, [2]interface{}{beforeAt(i), afterAt(j)})
+			}
+		}
+	}
+
+	for i := 0; i < nBefore; i++ {
+		if !usedBefore[i] {
+			pairs = append(pairs, [2]interface{}{beforeAt(i), nil})
+		}
+	}
+	for j := 0; j < nAfter; j++ {
+		if !usedAfter[j] {
+			pairs = append(pairs, [2]interface{}{nil, afterAt(j)})
+		}
+	}
+	return pairs
+}
+
+// Record stores entries on behalf of actor and returns them with their
+// ids and time set
+func Record(actor message.AuditActor, entries []message.AuditEntry) ([]message.AuditEntry, error) {
+	database, err := db.GetDb("audit")
+	if err != nil {
+		return nil, err
+	}
+	return record(database, actor, entries)
+}
+
+// RecordTx stores entries inside tx, which has the audit database
+// attached, so they are kept only if the write they describe is.
+// Restoring a delete entry a second time fails with ErrAlreadyRestored.
+func RecordTx(tx *sql.Tx, actor message.AuditActor, entries []message.AuditEntry) ([]message.AuditEntry, error) {
+	return record(tx, actor, entries)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func record(database execer, actor message.AuditActor, entries []message.AuditEntry) ([]message.AuditEntry, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range entries {
+		entry := &entries[i]
+		entry.Actor = actor
+		entry.CreatedAt = now
+
+		diff, err := json.Marshal(entry.Diff)
+		if err != nil {
+			return nil, err
+		}
+		res, err := database.Exec(
+			db.Q(db.InsertAuditEntry),
+			entry.Action,
+			entry.Entity,
+			entry.EntityId,
+			entry.ProjectId,
+			actor.Type,
+			nullInt(actor.AdminId),
+			actor.Username,
+			nullInt(actor.TokenId),
+			actor.TokenName,
+			actor.Ip,
+			actor.RequestId,
+			nullRaw(entry.Before),
+			nullRaw(entry.After),
+			string(diff),
+			nullInt(entry.RestoredFrom),
+			now.Unix(),
+		)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, ErrAlreadyRestored
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		entry.Id = int(id)
+	}
+	return entries, nil
+}
+
+// Filter narrows a listing, zero fields match everything
+type Filter struct {
+	Entity    string
+	Action    string
+	ProjectId int
+	EntityId  int
+	ActorType string
+	Actor     string
+	Since     time.Time
+	Until     time.Time
+	// Only entries older than this id, for paging
+	Before int
+	Limit  int
+}
+
+// List returns matching entries, newest first
+func List(f Filter) ([]message.AuditEntry, error) {
+	rows, err := db.Query(
+		"audit",
+		db.Q(db.GetAuditEntries),
+		f.Entity,
+		f.Action,
+		f.ProjectId,
+		f.EntityId,
+		f.ActorType,
+		f.Actor,
+		unix(f.Since),
+		unix(f.Until),
+		f.Before,
+		f.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []message.AuditEntry{}
+	for rows.Next() {
+		entry, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func Get(id int) (message.AuditEntry, error) {
+	row, err := db.QueryRow("audit", db.Q(db.GetAuditEntry), id)
+	if err != nil {
+		return message.AuditEntry{}, err
+	}
+	entry, err := scan(row)
+	if err == sql.ErrNoRows {
+		return entry, ErrNoEntry
+	}
+	return entry, err
+}
+
+// Id of the restore entry that brought back the delete entry id, 0 when
+// it has not been restored
+func RestoredBy(id int) (int, error) {
+	row, err := db.QueryRow("audit", db.Q(db.GetAuditRestoreOf), id)
+	if err != nil {
+		return 0, err
+	}
+	var restore int
+	err = row.Scan(&restore)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return restore, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row scanner) (message.AuditEntry, error) {
+	var (
+		entry        message.AuditEntry
+		actorId      sql.NullInt64
+		tokenId      sql.NullInt64
+		tokenName    sql.NullString
+		before       sql.NullString
+		after        sql.NullString
+		diff         sql.NullString
+		restoredFrom sql.NullInt64
+		createdAt    int64
+	)
+	err := row.Scan(
+		&entry.Id,
+		&entry.Action,
+		&entry.Entity,
+		&entry.EntityId,
+		&entry.ProjectId,
+		&entry.Actor.Type,
+		&actorId,
+		&entry.Actor.Username,
+		&tokenId,
+		&tokenName,
+		&entry.Actor.Ip,
+		&entry.Actor.RequestId,
+		&before,
+		&after,
+		&diff,
+		&restoredFrom,
+		&createdAt,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Actor.AdminId = int(actorId.Int64)
+	entry.Actor.TokenId = int(tokenId.Int64)
+	entry.Actor.TokenName = tokenName.String
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	if diff.Valid {
+		json.Unmarshal([]byte(diff.String), &entry.Diff)
+	}
+	entry.RestoredFrom = int(restoredFrom.Int64)
+	entry.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return entry, nil
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nullRaw(b json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"main/message"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func auditProject() *message.Project {
+	return &message.Project{
+		Id:        1,
+		Name:      "Portfolio",
+		Desc:      "A site",
+		Version:   1,
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Media: []message.Media{
+			{Id: 10, ProjectId: 1, Type: "photo", URL: "https://example.com/a.png"},
+			{Id: 11, ProjectId: 1, Type: "video", URL: "https://example.com/a.mp4"},
+		},
+		Links: []message.Link{{Id: 20, ProjectId: 1, Name: "Docs", URL: "https://example.com/docs"}},
+	}
+}
+
+// "action entity:id field,field" per entry, in order
+func summarize(entries []message.AuditEntry) []string {
+	out := []string{}
+	for _, e := range entries {
+		keys := []string{}
+		for key := range e.Diff {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out = append(out, e.Action+" "+e.Entity+":"+strconv.Itoa(e.EntityId)+" "+strings.Join(keys, ","))
+	}
+	return out
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		before *message.Project
+		after  func(p *message.Project) *message.Project
+		want   []string
+	}{
+		{
+			"create",
+			nil,
+			func(p *message.Project) *message.Project { return p },
+			[]string{
+				"create project:1 desc,name,repo,version",
+				"create media:10 type,url",
+				"create media:11 type,url",
+				"create link:20 name,url",
+			},
+		},
+		{
+			"delete",
+			auditProject(),
+			func(p *message.Project) *message.Project { return nil },
+			[]string{
+				"delete project:1 desc,name,repo,version",
+				"delete media:10 type,url",
+				"delete media:11 type,url",
+				"delete link:20 name,url",
+			},
+		},
+		{
+			"nothing changed but the time",
+			auditProject(),
+			func(p *message.Project) *message.Project {
+				p.UpdatedAt = p.UpdatedAt.Add(time.Hour)
+				return p
+			},
+			[]string{},
+		},
+		{
+			"fields",
+			auditProject(),
+			func(p *message.Project) *message.Project {
+				p.Name, p.Version = "Renamed", 2
+				return p
+			},
+			[]string{"update project:1 name,version"},
+		},
+		{
+			"replaced media keep their content",
+			auditProject(),
+			func(p *message.Project) *message.Project {
+				p.Version = 2
+				p.Media[0].Id, p.Media[1].Id = 12, 13
+				p.Media[0], p.Media[1] = p.Media[1], p.Media[0]
+				return p
+			},
+			[]string{"update project:1 version"},
+		},
+		{
+			"edited link keeps its id",
+			auditProject(),
+			func(p *message.Project) *message.Project {
+				p.Version = 2
+				p.Links[0].URL = "https://example.com/manual"
+				return p
+			},
+			[]string{"update project:1 version", "update link:20 url"},
+		},
+		{
+			"added and removed",
+			auditProject(),
+			func(p *message.Project) *message.Project {
+				p.Version = 2
+				p.Media = []message.Media{p.Media[0], {Id: 14, ProjectId: 1, Type: "photo", URL: "https://example.com/b.png"}}
+				p.Links = nil
+				return p
+			},
+			[]string{
+				"update project:1 version",
+				"delete media:11 type,url",
+				"create media:14 type,url",
+				"delete link:20 name,url",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		entries := Changes(tt.before, tt.after(auditProject()))
+		got := summarize(entries)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+		for _, e := range entries {
+			if e.ProjectId != 1 {
+				t.Errorf("%s: %s has project %d", tt.name, e.Entity, e.ProjectId)
+			}
+		}
+	}
+}
+
+func TestChangeSnapshots(t *testing.T) {
+	before := auditProject()
+	after := auditProject()
+	after.Name = "Renamed"
+
+	entry := Changes(before, after)[0]
+	if entry.Diff["name"] != (message.AuditChange{Before: "Portfolio", After: "Renamed"}) {
+		t.Errorf("got %+v", entry.Diff)
+	}
+	if !strings.Contains(string(entry.Before), `"name":"Portfolio"`) || !strings.Contains(string(entry.After), `"media":[`) {
+		t.Errorf("got %s and %s", entry.Before, entry.After)
+	}
+
+	created := Changes(nil, after)[0]
+	if created.Before != nil || created.Diff["name"].Before != nil {
+		t.Errorf("got %+v", created)
+	}
+}
+
+func TestRestored(t *testing.T) {
+	entries := Restored(auditProject(), 42)
+	if len(entries) != 4 {
+		t.Fatalf("got %v", summarize(entries))
+	}
+	for _, e := range entries {
+		if e.Action != ActionRestore || e.RestoredFrom != 42 {
+			t.Errorf("got %s from %d", e.Action, e.RestoredFrom)
+		}
+	}
+}
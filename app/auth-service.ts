@@ -0,0 +1,47 @@
+import type { LoginRequest, SessionResponse } from "./types.js";
+import { ProjectService } from "./project-service.js";
+import { csrfHeader } from "./csrf.js";
+
+/**
+ * Admin sessions live in an HTTP-only cookie,
+ * so the page only ever sees who is signed in
+ */
+export class AuthService {
+    private projectService = new ProjectService();
+
+    /**
+     * Login
+     */
+    public async login(data: LoginRequest): Promise<SessionResponse> {
+        const res = await fetch('/api/auth/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...csrfHeader() },
+            body: JSON.stringify(data)
+        });
+        return this.projectService.handle(res, 'Failed to sign in');
+    }
+
+    /**
+     * Logout
+     */
+    public async logout(): Promise<void> {
+        await fetch('/api/auth/logout', { method: 'POST', headers: csrfHeader() });
+    }
+
+    /**
+     * Get Session
+     */
+    public async getSession(): Promise<SessionResponse | null> {
+        const res = await fetch('/api/auth/session');
+        if(res.status === 401) return null;
+        return this.projectService.handle(res, 'Failed to load session');
+    }
+
+    /**
+     * Redirect to Login
+     */
+    public static redirectToLogin(): void {
+        const next = encodeURIComponent(location.pathname);
+        location.href = `/login?next=${next}`;
+    }
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/db"
+	"strings"
+)
+
+const minPasswordLength = 12
+
+// SetPassword creates the admin or changes its password. Existing
+// sessions are revoked, so a leaked password stops working everywhere.
+func SetPassword(username string, password string) (bool, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return false, fmt.Errorf("username is required")
+	}
+	if len(password) < minPasswordLength {
+		return false, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	row, err := db.QueryRow("auth", db.Q(db.GetAdminByUsername), username)
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		adminId  int
+		name     string
+		existing string
+	)
+	err = row.Scan(&adminId, &name, &existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = db.Exec("auth", db.Q(db.InsertAdmin), username, hash)
+		return true, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := db.Exec("auth", db.Q(db.UpdateAdminPassword), hash, adminId); err != nil {
+		return false, err
+	}
+	_, err = RevokeAll(adminId)
+	return false, err
+}
+
+// Admin Id
+func AdminId(username string) (int, error) {
+	row, err := db.QueryRow("auth", db.Q(db.GetAdminByUsername), strings.TrimSpace(username))
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		adminId int
+		name    string
+		hash    string
+	)
+	if err := row.Scan(&adminId, &name, &hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no admin named %s", username)
+		}
+		return 0, err
+	}
+	return adminId, nil
+}
+
+// Bootstrap creates the first admin from config. Once any admin exists
+// it does nothing, so changing the config cannot take over an account.
+func Bootstrap(username string, password string) error {
+	row, err := db.QueryRow("auth", db.Q(db.CountAdmins))
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+	if username == "" || password == "" {
+		log.Printf("Warning: no admin exists, the editor and write endpoints are locked")
+		return nil
+	}
+
+	if _, err := SetPassword(username, password); err != nil {
+		return err
+	}
+	log.Printf("Created admin %s", username)
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stored as pbkdf2-sha256$<iterations>$<salt>$<key>, so the cost can be
+// raised later without invalidating existing hashes
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 600000
+	saltLength     = 16
+	keyLength      = 32
+)
+
+// Hash Password
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, keyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(hashIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// Check Password
+func CheckPassword(encoded string, password string) bool {
+	iterations, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false
+	}
+
+	derived, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(key))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+func decodeHash(encoded string) (int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, fmt.Errorf("unknown hash format")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, fmt.Errorf("invalid iteration count")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid key")
+	}
+	return iterations, salt, key, nil
+}
+
+// Compared against when the username does not exist, so a wrong
+// username takes as long as a wrong password
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("")
+	return hash
+})
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") {
+		t.Errorf("got %s", hash)
+	}
+	if !CheckPassword(hash, "correct horse battery") {
+		t.Error("the password does not match its hash")
+	}
+	if CheckPassword(hash, "correct horse battery ") {
+		t.Error("another password matches")
+	}
+
+	again, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Error("hashes share a salt")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, "secret", salt, 2, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawStdEncoding.EncodeToString
+	hash := func(iterations string, salt string, key string) string {
+		return strings.Join([]string{hashScheme, iterations, salt, key}, "$")
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		ok      bool
+	}{
+		{"other cost and key length", hash("2", b64(salt), b64(key)), true},
+		{"wrong cost", hash("3", b64(salt), b64(key)), false},
+		{"other scheme", "bcrypt" + strings.TrimPrefix(hash("2", b64(salt), b64(key)), hashScheme), false},
+		{"zero cost", hash("0", b64(salt), b64(key)), false},
+		{"bad cost", hash("x", b64(salt), b64(key)), false},
+		{"bad salt", hash("2", "!", b64(key)), false},
+		{"padded key", hash("2", b64(salt), base64.StdEncoding.EncodeToString(key)), false},
+		{"no key", hash("2", b64(salt), ""), false},
+		{"missing part", strings.Join([]string{hashScheme, "2", b64(salt)}, "$"), false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := CheckPassword(tt.encoded, "secret"); got != tt.ok {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
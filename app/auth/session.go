@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"main/db"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrNoSession          = errors.New("no valid session")
+)
+
+type Config struct {
+	// Sessions end this long after login, however active
+	TTL time.Duration
+	// and sooner when unused for this long
+	Idle time.Duration
+	// Cookies only travel over HTTPS
+	Secure bool
+	// SameSite policy of the session and CSRF cookies
+	SameSite http.SameSite
+}
+
+var config = Config{
+	TTL:      12 * time.Hour,
+	Idle:     2 * time.Hour,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// Set Config
+func SetConfig(c Config) {
+	if c.TTL <= 0 {
+		c.TTL = 12 * time.Hour
+	}
+	if c.Idle <= 0 || c.Idle > c.TTL {
+		c.Idle = c.TTL
+	}
+	if c.SameSite == 0 || c.SameSite == http.SameSiteDefaultMode {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	// Browsers drop SameSite=None cookies that are not Secure
+	if c.SameSite == http.SameSiteNoneMode {
+		c.Secure = true
+	}
+	config = c
+}
+
+func Settings() Config {
+	return config
+}
+
+type Session struct {
+	AdminId   int
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Hash of the cookie token, the token itself is never stored
+	id string
+}
+
+// Touching lastSeenAt on every request would write on every read
+const touchInterval = time.Minute
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Login checks the password and opens a session, returning the token
+// for the cookie
+func Login(username string, password string, userAgent string, ip string) (string, *Session, error) {
+	row, err := db.QueryRow("auth", db.Q(db.GetAdminByUsername), strings.TrimSpace(username))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		adminId int
+		name    string
+		hash    string
+	)
+	if err := row.Scan(&adminId, &name, &hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			CheckPassword(dummyHash(), password)
+			return "", nil, ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+	if !CheckPassword(hash, password) {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := &Session{
+		AdminId:   adminId,
+		Username:  name,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.TTL),
+		id:        hashToken(token),
+	}
+
+	_, err = db.Exec(
+		"auth",
+		db.Q(db.InsertSession),
+		session.id,
+		adminId,
+		now.Unix(),
+		session.ExpiresAt.Unix(),
+		now.Unix(),
+		userAgent,
+		ip,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup(now)
+	return token, session, nil
+}
+
+// Authenticate resolves a cookie token to its live session
+func Authenticate(token string) (*Session, error) {
+	session, idle, err := lookup(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if idle > touchInterval {
+		now := time.Now().UTC()
+		if _, err := db.Exec("auth", db.Q(db.TouchSession), now.Unix(), session.id); err != nil {
+			log.Printf("Session touch error: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// Active reports whether token still names a live session, without
+// counting the check as activity
+func Active(token string) bool {
+	_, _, err := lookup(token)
+	return err == nil
+}
+
+// The live session of token and how long it has been unused
+func lookup(token string) (*Session, time.Duration, error) {
+	if token == "" {
+		return nil, 0, ErrNoSession
+	}
+
+	id := hashToken(token)
+	row, err := db.QueryRow("auth", db.Q(db.GetSession), id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		session   = &Session{id: id}
+		created   int64
+		expires   int64
+		lastSeen  int64
+		revokedAt sql.NullInt64
+	)
+	err = row.Scan(&session.id, &session.AdminId, &session.Username, &created, &expires, &lastSeen, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, ErrNoSession
+		}
+		return nil, 0, err
+	}
+	session.CreatedAt = time.Unix(created, 0).UTC()
+	session.ExpiresAt = time.Unix(expires, 0).UTC()
+
+	now := time.Now().UTC()
+	idle := now.Sub(time.Unix(lastSeen, 0))
+	if revokedAt.Valid || !now.Before(session.ExpiresAt) || idle > config.Idle {
+		return nil, 0, ErrNoSession
+	}
+	return session, idle, nil
+}
+
+// Revoke ends one session
+func Revoke(token string) error {
+	_, err := db.Exec("auth", db.Q(db.RevokeSession), time.Now().Unix(), hashToken(token))
+	return err
+}
+
+// RevokeAll ends every session of an admin, returning how many were open
+func RevokeAll(adminId int) (int64, error) {
+	result, err := db.Exec("auth", db.Q(db.RevokeAdminSessions), time.Now().Unix(), adminId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Expired and revoked sessions are kept a day for reference, then dropped
+func cleanup(now time.Time) {
+	cutoff := now.Add(-24 * time.Hour).Unix()
+	if _, err := db.Exec("auth", db.Q(db.DeleteExpiredSessions), cutoff, cutoff); err != nil {
+		log.Printf("Session cleanup error: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetConfig(t *testing.T) {
+	defer SetConfig(Config{})
+
+	tests := []struct {
+		name string
+		in   Config
+		want Config
+	}{
+		{"defaults", Config{}, Config{TTL: 12 * time.Hour, Idle: 12 * time.Hour, SameSite: http.SameSiteLaxMode}},
+		{
+			"idle past the TTL",
+			Config{TTL: time.Hour, Idle: 2 * time.Hour, SameSite: http.SameSiteStrictMode},
+			Config{TTL: time.Hour, Idle: time.Hour, SameSite: http.SameSiteStrictMode},
+		},
+		{
+			"SameSite=None is secure",
+			Config{TTL: time.Hour, Idle: time.Minute, SameSite: http.SameSiteNoneMode},
+			Config{TTL: time.Hour, Idle: time.Minute, SameSite: http.SameSiteNoneMode, Secure: true},
+		},
+	}
+
+	for _, tt := range tests {
+		SetConfig(tt.in)
+		if got := Settings(); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	a, err := generateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := generateToken()
+	if len(a) != 43 || a == b {
+		t.Errorf("got %q and %q", a, b)
+	}
+	if hashToken(a) != hashToken(a) || hashToken(a) == hashToken(b) || len(hashToken(a)) != 64 {
+		t.Error("token hashes are not stable and distinct")
+	}
+}
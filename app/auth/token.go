@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"main/db"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeMediaWrite    = "media:write"
+)
+
+var Scopes = []string{ScopeProjectsRead, ScopeProjectsWrite, ScopeMediaWrite}
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrNoToken      = errors.New("token not found")
+)
+
+// Tokens look like pt_<prefix>_<secret>. The prefix is stored in the
+// clear to find the token and to recognise it in logs, the whole token
+// only as a hash.
+const (
+	tokenScheme       = "pt_"
+	tokenPrefixLength = 8
+)
+
+type Token struct {
+	Id         int
+	AdminId    int
+	Username   string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	hash       string
+}
+
+func (t *Token) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// Who a request acts as: an admin session, which may do anything, or a
+// token limited to its scopes
+type Principal struct {
+	AdminId  int
+	Username string
+	Session  *Session
+	Token    *Token
+}
+
+func (p *Principal) Can(scope string) bool {
+	if p == nil {
+		return false
+	}
+	if p.Session != nil {
+		return true
+	}
+	return p.Token != nil && slices.Contains(p.Token.Scopes, scope)
+}
+
+func SessionPrincipal(s *Session) *Principal {
+	return &Principal{AdminId: s.AdminId, Username: s.Username, Session: s}
+}
+
+// Unknown scopes are rejected rather than ignored, so a typo does not
+// quietly create a weaker token
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// CreateToken returns the token, which is shown once and never again
+func CreateToken(adminId int, name string, scopes []string, expiresAt *time.Time) (string, *Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("name is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+
+	prefixBytes := make([]byte, tokenPrefixLength/2)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", nil, err
+	}
+	secret, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := tokenScheme + hex.EncodeToString(prefixBytes)
+	plain := prefix + "_" + secret
+
+	now := time.Now().UTC().Truncate(time.Second)
+	token := &Token{
+		AdminId:   adminId,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+		hash:      hashToken(plain),
+	}
+
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.Unix()
+	}
+	result, err := db.Exec(
+		"auth",
+		db.Q(db.InsertToken),
+		adminId,
+		name,
+		prefix,
+		token.hash,
+		strings.Join(scopes, " "),
+		now.Unix(),
+		expires,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", nil, err
+	}
+	token.Id = int(id)
+	return plain, token, nil
+}
+
+// AuthenticateToken resolves a bearer token, recording when it was used
+func AuthenticateToken(plain string) (*Token, error) {
+	if !strings.HasPrefix(plain, tokenScheme) {
+		return nil, ErrInvalidToken
+	}
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(plain, tokenScheme), "_")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	row, err := db.QueryRow("auth", db.Q(db.GetTokenByPrefix), tokenScheme+prefix)
+	if err != nil {
+		return nil, err
+	}
+	token, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if subtle.ConstantTimeCompare([]byte(hashToken(plain)), []byte(token.hash)) != 1 || !token.Active(now) {
+		return nil, ErrInvalidToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > touchInterval {
+		if _, err := db.Exec("auth", db.Q(db.TouchToken), now.Unix(), token.Id); err != nil {
+			log.Printf("Token touch error: %v", err)
+		}
+	}
+	return token, nil
+}
+
+// Tokens of an admin, revoked and expired ones included
+func ListTokens(adminId int) ([]*Token, error) {
+	rows, err := db.Query("auth", db.Q(db.GetAdminTokens), adminId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken only touches tokens the admin owns
+func RevokeToken(adminId int, id int) error {
+	result, err := db.Exec("auth", db.Q(db.RevokeToken), time.Now().Unix(), id, adminId)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoToken
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (*Token, error) {
+	var (
+		token     Token
+		scopes    string
+		createdAt int64
+		expiresAt sql.NullInt64
+		lastUsed  sql.NullInt64
+		revokedAt sql.NullInt64
+	)
+	err := row.Scan(
+		&token.Id,
+		&token.AdminId,
+		&token.Username,
+		&token.Name,
+		&token.Prefix,
+		&token.hash,
+		&scopes,
+		&createdAt,
+		&expiresAt,
+		&lastUsed,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.CreatedAt = time.Unix(createdAt, 0).UTC()
+	token.ExpiresAt = unixTime(expiresAt)
+	token.LastUsedAt = unixTime(lastUsed)
+	token.RevokedAt = unixTime(revokedAt)
+	return &token, nil
+}
+
+func unixTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0).UTC()
+	return &t
+}
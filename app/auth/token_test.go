@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		ok     bool
+	}{
+		{[]string{ScopeProjectsRead}, true},
+		{Scopes, true},
+		{nil, false},
+		{[]string{}, false},
+		{[]string{ScopeProjectsRead, "projects:admin"}, false},
+		{[]string{"Projects:Read"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateScopes(tt.scopes); (err == nil) != tt.ok {
+			t.Errorf("%q: got %v", tt.scopes, err)
+		}
+	}
+}
+
+func TestPrincipalCan(t *testing.T) {
+	reader := &Principal{Token: &Token{Scopes: []string{ScopeProjectsRead}}}
+	admin := SessionPrincipal(&Session{AdminId: 1, Username: "admin"})
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		scope     string
+		ok        bool
+	}{
+		{"nobody", nil, ScopeProjectsRead, false},
+		{"empty", &Principal{}, ScopeProjectsRead, false},
+		{"session", admin, ScopeMediaWrite, true},
+		{"token scope", reader, ScopeProjectsRead, true},
+		{"other scope", reader, ScopeProjectsWrite, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.principal.Can(tt.scope); got != tt.ok {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+	if admin.AdminId != 1 || admin.Username != "admin" {
+		t.Errorf("got %+v", admin)
+	}
+}
+
+func TestTokenActive(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name  string
+		token Token
+		ok    bool
+	}{
+		{"no expiry", Token{}, true},
+		{"expires later", Token{ExpiresAt: at(time.Second)}, true},
+		{"expires now", Token{ExpiresAt: at(0)}, false},
+		{"expired", Token{ExpiresAt: at(-time.Hour)}, false},
+		{"revoked", Token{RevokedAt: at(-time.Hour), ExpiresAt: at(time.Hour)}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.token.Active(now); got != tt.ok {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
+
+// Malformed tokens and requests are turned away before the database
+func TestTokenInputs(t *testing.T) {
+	for _, plain := range []string{"", "pt_", "pt_abcd1234", "xx_abcd1234_secret", "Bearer pt_abcd1234_secret"} {
+		if _, err := AuthenticateToken(plain); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%q: got %v", plain, err)
+		}
+	}
+
+	if _, _, err := CreateToken(1, "  ", Scopes, nil); err == nil || err.Error() != "name is required" {
+		t.Errorf("blank name: got %v", err)
+	}
+	if _, _, err := CreateToken(1, "ci", []string{"all"}, nil); err == nil || err.Error() != `unknown scope "all"` {
+		t.Errorf("unknown scope: got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"io/fs"
+	"log"
+	"main/static"
+	"os"
+	"path/filepath"
+)
+
+// Where pages, compiled scripts and styles are read from
+type assetSource struct {
+	Pages   fs.FS
+	Scripts fs.FS
+	Styles  fs.FS
+}
+
+var (
+	assets assetSource
+	// Laid out like app/: server/, .out/ and .styles/
+	embeddedAssets fs.FS
+	devAssets      bool
+)
+
+// SetEmbeddedAssets hands over the assets compiled into the binary
+func SetEmbeddedAssets(fsys fs.FS) {
+	embeddedAssets = fsys
+}
+
+// SetDevAssets serves from disk even when assets are embedded, and
+// without hashed URLs so edits show up on reload
+func SetDevAssets(dev bool) {
+	devAssets = dev
+}
+
+// Embedded assets unless in dev mode or built without them. ASSETS_DIR
+// points at the app directory on disk, found from the working directory
+// when unset.
+func loadAssets() assetSource {
+	if embeddedAssets != nil && !devAssets {
+		log.Printf("Assets: embedded")
+		return assetSource{
+			Pages:   subFS(embeddedAssets, "server"),
+			Scripts: subFS(embeddedAssets, ".out"),
+			Styles:  subFS(embeddedAssets, ".styles"),
+		}
+	}
+
+	dir := GetEnv("ASSETS_DIR")
+	if dir == "" {
+		dir = appDir()
+	}
+	return diskAssets(dir)
+}
+
+func subFS(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		log.Fatalf("Embedded assets %s: %v", dir, err)
+	}
+	return sub
+}
+
+// The server runs from the repository root or from app/
+func appDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Printf("Warning: Could not get working directory: %v", err)
+		wd = "."
+	}
+
+	log.Printf("Working directory: %s", wd)
+
+	if _, err := os.Stat(filepath.Join(wd, "app")); err == nil {
+		return filepath.Join(wd, "app")
+	}
+	return wd
+}
+
+func diskAssets(dir string) assetSource {
+	log.Printf("Assets: %s", dir)
+
+	return assetSource{
+		Pages:   static.Dir(filepath.Join(dir, "server")),
+		Scripts: static.Dir(filepath.Join(dir, ".out")),
+		Styles:  static.Dir(filepath.Join(dir, ".styles")),
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadAssets(t *testing.T) {
+	defer SetEmbeddedAssets(nil)
+	defer SetDevAssets(devAssets)
+
+	SetEmbeddedAssets(fstest.MapFS{
+		"server/index.html": {Data: []byte("embedded page")},
+		".out/main.js":      {Data: []byte("embedded script")},
+		".styles/main.css":  {Data: []byte("embedded style")},
+	})
+
+	SetDevAssets(false)
+	embedded := loadAssets()
+	for name, file := range map[string]struct {
+		fsys fs.FS
+		name string
+	}{
+		"page":   {embedded.Pages, "index.html"},
+		"script": {embedded.Scripts, "main.js"},
+		"style":  {embedded.Styles, "main.css"},
+	} {
+		content, err := fs.ReadFile(file.fsys, file.name)
+		if err != nil || string(content) != "embedded "+name {
+			t.Errorf("%s: got %q, %v", name, content, err)
+		}
+	}
+
+	// ASSETS_DIR is the app directory in tests
+	SetDevAssets(true)
+	content, err := fs.ReadFile(loadAssets().Pages, "index.html")
+	if err != nil || string(content) == "embedded page" {
+		t.Errorf("dev mode did not read from disk: %v", err)
+	}
+}
+
+func TestAppDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, want := range map[string]string{
+		root:                       filepath.Join(root, "app"),
+		filepath.Join(root, "app"): filepath.Join(root, "app"),
+	} {
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := filepath.EvalSymlinks(appDir()); got != mustEval(t, want) {
+			t.Errorf("from %s: got %s, want %s", dir, got, want)
+		}
+	}
+}
+
+func mustEval(t *testing.T, path string) string {
+	t.Helper()
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolved
+}
@@ -1,28 +1,180 @@
 package config
 
 import (
+	"log"
+	"main/api"
+	"main/ws"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// CORS Policy for a group of routes. Origins are exact origins,
+// patterns like https://*.example.com, or * for any origin.
+type CORSPolicy struct {
+	Name        string
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	Credentials bool
+}
+
+var (
+	// Everyone may read
+	publicCORS = &CORSPolicy{
+		Name:    "public",
+		Origins: []string{"*"},
+		Methods: []string{http.MethodGet, http.MethodHead, http.MethodPost},
+		Headers: []string{"Content-Type", "If-None-Match", "If-Modified-Since", "X-Request-Id"},
+	}
+	// The editor may do anything, with its cookies
+	editorCORS = &CORSPolicy{
+		Name:        "editor",
+		Methods:     []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		Headers:     []string{"Content-Type", "Authorization", "X-CSRF-Token", "If-Match", "If-None-Match", "If-Modified-Since", "X-Request-Id"},
+		Credentials: true,
+	}
+
+	corsExpose = []string{
+		"X-Request-Id", "ETag", "Last-Modified", "Api-Version", "Deprecation", "Sunset", "Link", "Retry-After",
+	}
+	corsMaxAge = time.Hour
+)
+
+// CORS_PUBLIC_ORIGINS="*" may read public routes, CORS_EDITOR_ORIGINS
+// (WEB_URL when unset) may also write. CORS_MAX_AGE="1h" caches preflights.
+func initCORS() {
+	if origins := GetEnv("CORS_PUBLIC_ORIGINS"); origins != "" {
+		publicCORS.Origins = splitList(origins)
+	}
+
+	origins := GetEnv("CORS_EDITOR_ORIGINS")
+	if origins == "" {
+		origins = GetEnv("WEB_URL")
+	}
+	editorCORS.Origins = splitList(origins)
+	if slices.Contains(editorCORS.Origins, "*") {
+		log.Fatalf("CORS_EDITOR_ORIGINS cannot be *, the editor sends cookies")
+	}
+
+	if maxAge := durationEnv("CORS_MAX_AGE"); maxAge > 0 {
+		corsMaxAge = maxAge
+	}
+
+	log.Printf("CORS public origins: %s", strings.Join(publicCORS.Origins, ", "))
+	log.Printf("CORS editor origins: %s", strings.Join(editorCORS.Origins, ", "))
+}
+
+// Enable CORS for routes read by everyone and written by the editor
 func EnableCORS(next http.HandlerFunc) http.HandlerFunc {
+	return withCORS(next, editorCORS, publicCORS)
+}
+
+// Public CORS for read-only routes
+func PublicCORS(next http.HandlerFunc) http.HandlerFunc {
+	return withCORS(next, publicCORS)
+}
+
+// Editor CORS for sign in and admin routes, closed to other sites
+func EditorCORS(next http.HandlerFunc) http.HandlerFunc {
+	return withCORS(next, editorCORS)
+}
+
+// The first policy allowing the origin applies. Preflights the policy
+// does not allow are refused, other requests simply get no CORS headers
+// and the browser keeps the response from the page.
+func withCORS(next http.HandlerFunc, policies ...*CORSPolicy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Responses differ by origin, so caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+
 		origin := r.Header.Get("Origin")
-		webUrl := GetEnv("WEB_URL")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		var policy *CORSPolicy
+		if origin != "" {
+			for _, p := range policies {
+				if p.allowsOrigin(origin) {
+					policy = p
+					break
+				}
+			}
+		}
 
-		if origin == webUrl {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if !preflight {
+			if policy != nil {
+				policy.allow(w, origin)
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExpose, ", "))
+			}
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next(w, r)
+			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "3600")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
+		if policy == nil {
+			rejectPreflight(w, r, "Origin "+origin+" is not allowed")
 			return
 		}
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !slices.Contains(policy.Methods, method) {
+			rejectPreflight(w, r, "Method "+method+" is not allowed from "+origin)
+			return
+		}
+		for _, header := range splitList(r.Header.Get("Access-Control-Request-Headers")) {
+			if !slices.ContainsFunc(policy.Headers, func(h string) bool { return strings.EqualFold(h, header) }) {
+				rejectPreflight(w, r, "Header "+header+" is not allowed from "+origin)
+				return
+			}
+		}
+
+		policy.allow(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.Methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.Headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.Origins {
+		if allowed == "*" || ws.MatchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
 
-		next(w, r)
+// A wildcard is only sent without credentials, browsers refuse the pair
+func (p *CORSPolicy) allow(w http.ResponseWriter, origin string) {
+	if !p.Credentials && slices.Contains(p.Origins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if p.Credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func rejectPreflight(w http.ResponseWriter, r *http.Request, reason string) {
+	log.Printf("CORS preflight refused for %s %s: %s", r.Header.Get("Access-Control-Request-Method"), r.URL.Path, reason)
+	api.WriteError(w, r, http.StatusForbidden, api.CodeCORSRejected, reason, nil)
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithCORS(t *testing.T) {
+	public := &CORSPolicy{
+		Name:    "public",
+		Origins: []string{"*"},
+		Methods: []string{http.MethodGet},
+		Headers: []string{"Content-Type"},
+	}
+	editor := &CORSPolicy{
+		Name:        "editor",
+		Origins:     []string{"https://editor.example.com", "https://*.preview.example.com"},
+		Methods:     []string{http.MethodGet, http.MethodPut},
+		Headers:     []string{"Content-Type", "X-CSRF-Token"},
+		Credentials: true,
+	}
+	handler := withCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}, editor, public)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   string
+		headers     string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{"same origin", http.MethodGet, "", "", "", http.StatusTeapot, "", false},
+		{"public read", http.MethodGet, "https://other.example", "", "", http.StatusTeapot, "*", false},
+		{"editor read", http.MethodGet, "https://editor.example.com", "", "", http.StatusTeapot, "https://editor.example.com", true},
+		{"preview subdomain", http.MethodPut, "https://a.preview.example.com", "", "", http.StatusTeapot, "https://a.preview.example.com", true},
+		{"plain OPTIONS", http.MethodOptions, "https://other.example", "", "", http.StatusNoContent, "*", false},
+		{"editor preflight", http.MethodOptions, "https://editor.example.com", http.MethodPut, "content-type, x-csrf-token", http.StatusNoContent, "https://editor.example.com", true},
+		{"public preflight", http.MethodOptions, "https://other.example", http.MethodGet, "Content-Type", http.StatusNoContent, "*", false},
+		{"method refused", http.MethodOptions, "https://other.example", http.MethodPut, "", http.StatusForbidden, "", false},
+		{"header refused", http.MethodOptions, "https://editor.example.com", http.MethodPut, "Authorization", http.StatusForbidden, "", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/projects", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflight != "" {
+			r.Header.Set("Access-Control-Request-Method", tt.preflight)
+		}
+		if tt.headers != "" {
+			r.Header.Set("Access-Control-Request-Headers", tt.headers)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		h := w.Header()
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: got origin %q, want %q", tt.name, got, tt.allowOrigin)
+		}
+		if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+			t.Errorf("%s: got credentials %v", tt.name, got)
+		}
+		if h.Values("Vary")[0] != "Origin" {
+			t.Errorf("%s: got Vary %q", tt.name, h.Values("Vary"))
+		}
+
+		switch {
+		case tt.preflight != "" && tt.status == http.StatusNoContent:
+			if h.Get("Access-Control-Max-Age") != "3600" || h.Get("Access-Control-Allow-Methods") == "" {
+				t.Errorf("%s: got %v", tt.name, h)
+			}
+		case tt.allowOrigin != "":
+			if !strings.Contains(h.Get("Access-Control-Expose-Headers"), "ETag") {
+				t.Errorf("%s: got exposed %q", tt.name, h.Get("Access-Control-Expose-Headers"))
+			}
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(" https://a.example ,, https://b.example,")
+	if strings.Join(got, "|") != "https://a.example|https://b.example" {
+		t.Errorf("got %q", got)
+	}
+	if got := splitList(""); got == nil || len(got) != 0 {
+		t.Errorf("got %#v", got)
+	}
+}
@@ -2,13 +2,22 @@ package config
 
 import (
 	"fmt"
+	"main/api"
 	"net/http"
 )
 
 func Hello(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		api.WriteMethodNotAllowed(w, r)
+		return
+	}
 	fmt.Fprintf(w, "hello!")
 }
 
 func HelloWs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		api.WriteMethodNotAllowed(w, r)
+		return
+	}
 	fmt.Fprintf(w, "hello WebSocket!")
 }
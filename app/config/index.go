@@ -1,73 +1,79 @@
 package config
 
 import (
+	"io/fs"
 	"log"
+	"main/api"
+	"main/static"
 	"net/http"
-	"os"
-	"path/filepath"
+)
+
+// Pages live next to their Go and TypeScript sources, which stay private.
+// The page templates are only served by the guarded routes below.
+var (
+	pageTemplates = []string{"index.html", "project-editor.html", "login.html"}
+	pageSources   = append([]string{"*.go", "*.ts"}, pageTemplates...)
 )
 
 func InitIndex() {
-	wd, err := os.Getwd()
-	if err != nil {
-		log.Printf("Warning: Could not get working directory: %v", err)
-		wd = "."
+	for _, page := range pageTemplates {
+		if _, err := fs.Stat(assets.Pages, page); err != nil {
+			log.Printf("ERROR: %s not found: %v", page, err)
+		}
 	}
 
-	log.Printf("Working directory: %s", wd)
-
-	var indexPath string
-	var projectEditorPath string
-	var staticDir string
-
-	appPath := filepath.Join(wd, "app")
-	if _, err := os.Stat(appPath); err == nil {
-		indexPath = filepath.Join(wd, "app", "server", "index.html")
-		projectEditorPath = filepath.Join(wd, "app", "server", "project-editor.html")
-		staticDir = filepath.Join(wd, "app", "server")
-	} else {
-		indexPath = filepath.Join(wd, "server", "index.html")
-		projectEditorPath = filepath.Join(wd, "server", "project-editor.html")
-		staticDir = filepath.Join(wd, "server")
+	serveIndex := func(w http.ResponseWriter, r *http.Request) {
+		api.ServeHTML(w, r, assets.Pages, "index.html")
 	}
 
-	log.Printf("Index path: %s", indexPath)
-	log.Printf("Project editor path: %s", projectEditorPath)
-	log.Printf("Static directory: %s", staticDir)
-
-	if _, err := os.Stat(indexPath); err != nil {
-		log.Printf("ERROR: index.html not found at %s", indexPath)
-	}
-	if _, err := os.Stat(projectEditorPath); err != nil {
-		log.Printf("ERROR: project-editor.html not found at %s", projectEditorPath)
-	}
+	// Unknown paths get 404.html when there is one, the index otherwise
+	pages := static.New("pages", assets.Pages, static.Options{
+		NotFoundPage: "404.html",
+		NotFound: func(w http.ResponseWriter, r *http.Request) {
+			log.Printf("Fallback to index page")
+			serveIndex(w, r)
+		},
+		Exclude: pageSources,
+	})
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	handle("/", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Request: %s %s", r.Method, r.URL.Path)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			api.WriteMethodNotAllowed(w, r)
+			return
+		}
 
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("Expires", "0")
 
-		if r.URL.Path == "/editor" || r.URL.Path == "/editor/" {
+		// Matched on the cleaned name, which is what the pages server
+		// would look up, so a trailing slash cannot get around the guard
+		name, _ := static.Clean(r.URL.Path)
+
+		if name == "editor" || name == "project-editor.html" {
+			if api.CurrentSession(r) == nil {
+				log.Printf("Editor requires sign in")
+				http.Redirect(w, r, "/login?next=/editor", http.StatusSeeOther)
+				return
+			}
 			log.Printf("Serving editor page")
-			http.ServeFile(w, r, projectEditorPath)
+			api.IssueCSRF(w, r)
+			api.ServeHTML(w, r, assets.Pages, "project-editor.html")
 			return
 		}
-		if r.URL.Path == "/" {
-			log.Printf("Serving index page")
-			http.ServeFile(w, r, indexPath)
+		if name == "login" || name == "login.html" {
+			log.Printf("Serving login page")
+			api.IssueCSRF(w, r)
+			api.ServeHTML(w, r, assets.Pages, "login.html")
 			return
 		}
-
-		filePath := filepath.Join(staticDir, r.URL.Path)
-		if _, err := os.Stat(filePath); err == nil {
-			log.Printf("Serving static file: %s", filePath)
-			http.ServeFile(w, r, filePath)
+		if name == "." || name == "index.html" {
+			log.Printf("Serving index page")
+			serveIndex(w, r)
 			return
 		}
 
-		log.Printf("Fallback to index page")
-		http.ServeFile(w, r, indexPath)
+		pages.Serve(w, r, r.URL.Path)
 	})
 }
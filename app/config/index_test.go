@@ -0,0 +1,40 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Page templates are only reachable through their guarded routes, however
+// the path is spelled
+func TestPageRoutes(t *testing.T) {
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/editor", http.StatusSeeOther, "/login?next=/editor"},
+		{"/editor/", http.StatusSeeOther, "/login?next=/editor"},
+		{"/project-editor.html", http.StatusSeeOther, "/login?next=/editor"},
+		{"/project-editor.html/", http.StatusSeeOther, "/login?next=/editor"},
+		{"/login", http.StatusOK, ""},
+		{"/login.html/", http.StatusOK, ""},
+		{"/", http.StatusOK, ""},
+		{"/index.html/", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %d to %q, want %d to %q", tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+			continue
+		}
+		if tt.status == http.StatusOK && strings.Contains(w.Body.String(), "{{") {
+			t.Errorf("%s: served the raw template", tt.path)
+		}
+	}
+}
@@ -3,16 +3,34 @@ package config
 import (
 	"log"
 	"main/api"
+	"main/auth"
+	"main/limit"
 	"main/ws"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 var (
 	wsServer *Server
+	routes   []string
 )
 
+// Handle
+func handle(pattern string, handler http.HandlerFunc) {
+	routes = append(routes, pattern)
+	http.HandleFunc(pattern, api.SecurityHeaders(api.Compress(api.ResolvePrincipal(handler))))
+}
+
+// Patterns registered on the default mux, in registration order
+func Routes() []string {
+	return append([]string(nil), routes...)
+}
+
 // Endpoint
 func reader(conn *websocket.Conn) {
 	for {
@@ -32,10 +50,6 @@ func reader(conn *websocket.Conn) {
 }
 
 func wsEndpoint(w http.ResponseWriter, r *http.Request) {
-	ws.Upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
-	}
-
 	ws, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
@@ -51,15 +65,272 @@ func wsEndpoint(w http.ResponseWriter, r *http.Request) {
 func Setup(s *ws.Server) {
 	wsServer = &Server{s}
 
+	assets = loadAssets()
 	InitScripts()
 	InitIndex()
 
-	http.HandleFunc("/ws", wsServer.HandleWebSocket)
-	http.HandleFunc("/hello", EnableCORS(Hello))
-	http.HandleFunc("/helloWs", EnableCORS(HelloWs))
+	api.SetCachePolicy(api.CachePolicy{
+		List: GetEnv("API_CACHE_CONTROL_LIST"),
+		Item: GetEnv("API_CACHE_CONTROL_ITEM"),
+	})
+	initDeprecations()
+	initSite()
+	initAuth()
+	initRateLimits()
+	initWebSocket()
+	initCORS()
+	initSecurity()
+	initCompression()
+
+	handle("/ws", api.LimitConnections(wsServer.HandleWebSocket))
+	handle("/hello", PublicCORS(Hello))
+	handle("/helloWs", PublicCORS(HelloWs))
+
+	handle("/feed.xml", PublicCORS(api.WithRequestId(api.RateLimit(api.RSSFeedHandler))))
+	handle("/atom.xml", PublicCORS(api.WithRequestId(api.RateLimit(api.AtomFeedHandler))))
+	handle("/feed.json", PublicCORS(api.WithRequestId(api.RateLimit(api.JSONFeedHandler))))
+	handle("/sitemap.xml", api.WithRequestId(api.RateLimit(api.SitemapHandler)))
+	handle("/sitemaps/", api.WithRequestId(api.RateLimit(api.SitemapHandler)))
+	handle("/robots.txt", api.RobotsHandler)
+	handle("/projects/", api.WithRequestId(api.RateLimit(api.ProjectPageHandler)))
+
+	// Unversioned paths predate /api/v1 and stay as its aliases
+	handle("/time-stream", PublicCORS(api.LimitConnections(api.Alias(api.TimeStreamHandler))))
+	handle("/count", PublicCORS(api.LimitConnections(api.Alias(api.ClientsConnectedHandler(s)))))
+	handle("/api/projects", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(api.Alias(api.HandleProjects(s))))))))
+	handle("/api/projects/", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(api.Alias(api.HandleProjectById(s))))))))
+	handle("/api/projects/bulk", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(api.Alias(api.BulkProjectsHandler(s))))))))
+
+	// v1 is frozen, response changes go into a new version
+	handle("/api/v1/time-stream", PublicCORS(api.LimitConnections(v1(api.TimeStreamHandler))))
+	handle("/api/v1/count", PublicCORS(api.LimitConnections(v1(api.ClientsConnectedHandler(s)))))
+	handle("/api/v1/projects", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(v1(api.HandleProjects(s))))))))
+	handle("/api/v1/projects/", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(v1(api.HandleProjectById(s))))))))
+	handle("/api/v1/projects/bulk", EnableCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.ProjectAccess(v1(api.BulkProjectsHandler(s))))))))
+
+	handle("/api/v2/projects", PublicCORS(api.WithRequestId(api.RateLimit(v2(api.GetAllProjectsV2Handler)))))
+	handle("/api/v2/projects/", PublicCORS(api.WithRequestId(api.RateLimit(v2(api.GetProjectV2Handler)))))
+
+	handle("/api/auth/login", EditorCORS(api.WithRequestId(api.RateLimitGroup(api.LimitLogin, api.CSRF(api.LoginHandler)))))
+	handle("/api/auth/logout", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.LogoutHandler)))))
+	handle("/api/auth/session", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.SessionHandler)))))
+	handle("/api/auth/csrf", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRFHandler))))
+	handle("/api/auth/tokens", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.RequireAdmin(api.TokensHandler))))))
+	handle("/api/auth/tokens/", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.RequireAdmin(api.TokenHandler))))))
+
+	handle("/api/admin/rate-limits", EditorCORS(api.WithRequestId(api.RequireAdmin(api.RateLimitsHandler))))
+	handle("/api/admin/csp-reports", EditorCORS(api.WithRequestId(api.RequireAdmin(api.CSPReportsHandler))))
+	handle("/api/csp-report", api.WithRequestId(api.RateLimit(api.CSPReportHandler)))
+	handle("/api/admin/ws-origins", EditorCORS(api.WithRequestId(api.RequireAdmin(api.WebSocketOriginsHandler))))
+	handle("/api/audit", EditorCORS(api.WithRequestId(api.RateLimit(api.RequireAdmin(api.AuditHandler)))))
+	handle("/api/audit/", EditorCORS(api.WithRequestId(api.RateLimit(api.CSRF(api.RequireAdmin(api.AuditRestoreHandler(s)))))))
+
+	handle("/api/graphql", PublicCORS(api.WithRequestId(api.LimitConnections(api.GraphQLHandler(s)))))
+	handle("/api/openapi.json", PublicCORS(api.WithRequestId(api.OpenAPIHandler)))
+	handle("/api/", PublicCORS(api.WithRequestId(api.NotFoundHandler)))
+
+}
+
+// Versions
+func v1(handler http.HandlerFunc) http.HandlerFunc {
+	return api.Versioned(api.V1, handler)
+}
+
+func v2(handler http.HandlerFunc) http.HandlerFunc {
+	return api.Versioned(api.V2, handler)
+}
+
+// API_DEPRECATED_V1="2026-01-01" and API_SUNSET_V1="2026-07-01"
+// announce v1's retirement, likewise for later versions and for the
+// unversioned paths with API_DEPRECATED_ALIASES and API_SUNSET_ALIASES
+func initDeprecations() {
+	for _, version := range append([]string{api.Aliases}, api.Versions...) {
+		suffix := strings.ToUpper(version)
+		err := api.Deprecate(
+			version,
+			GetEnv("API_DEPRECATED_"+suffix),
+			GetEnv("API_SUNSET_"+suffix),
+		)
+		if err != nil {
+			log.Fatalf("Invalid API deprecation config: %v", err)
+		}
+	}
+}
+
+// SITE_URL is the public address used in feed and sitemap links, which
+// otherwise come from the request's Host header
+func initSite() {
+	if GetEnv("SITE_URL") == "" {
+		log.Printf("Warning: SITE_URL is not set, feed, sitemap and page links follow the Host header")
+	}
+
+	disallow := GetEnv("ROBOTS_DISALLOW")
+	if disallow == "" {
+		disallow = "/editor,/api/"
+	}
 
-	http.HandleFunc("/time-stream", EnableCORS(api.TimeStreamHandler))
-	http.HandleFunc("/count", EnableCORS(api.ClientsConnectedHandler(s)))
-	http.HandleFunc("/api/projects", EnableCORS(api.HandleProjects(s)))
-	http.HandleFunc("/api/projects/", EnableCORS(api.HandleProjectById(s)))
+	robots := ""
+	if path := GetEnv("ROBOTS_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read ROBOTS_FILE: %v", err)
+		}
+		robots = string(content)
+	}
+
+	api.SetSiteConfig(api.SiteConfig{
+		URL:         GetEnv("SITE_URL"),
+		Title:       GetEnv("SITE_TITLE"),
+		Description: GetEnv("SITE_DESCRIPTION"),
+		Author:      GetEnv("SITE_AUTHOR"),
+		AuthorEmail: GetEnv("SITE_AUTHOR_EMAIL"),
+		AuthorURL:   GetEnv("SITE_AUTHOR_URL"),
+		FeedLimit:   positiveEnv("FEED_LIMIT"),
+
+		SitemapLimit:   positiveEnv("SITEMAP_LIMIT"),
+		RobotsDisallow: strings.Split(disallow, ","),
+		Robots:         robots,
+	})
+
+	// Page templates in TEMPLATES_DIR replace the built-in ones by file name
+	if dir := GetEnv("TEMPLATES_DIR"); dir != "" {
+		if err := api.LoadTemplates(dir); err != nil {
+			log.Fatalf("Could not load templates from %s: %v", dir, err)
+		}
+		log.Printf("Page templates loaded from %s", dir)
+	}
+}
+
+// Zero when unset, leaving the default in place
+func positiveEnv(key string) int {
+	value := GetEnv(key)
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("Invalid %s %q", key, value)
+	}
+	return n
+}
+
+// SESSION_TTL="12h" and SESSION_IDLE="2h" bound sessions, ADMIN_USERNAME
+// and ADMIN_PASSWORD create the first admin when there is none
+func initAuth() {
+	auth.SetConfig(auth.Config{
+		TTL:      durationEnv("SESSION_TTL"),
+		Idle:     durationEnv("SESSION_IDLE"),
+		Secure:   GetEnv("SESSION_SECURE") == "true",
+		SameSite: sameSiteEnv("COOKIE_SAMESITE"),
+	})
+
+	if err := auth.Bootstrap(GetEnv("ADMIN_USERNAME"), GetEnv("ADMIN_PASSWORD")); err != nil {
+		log.Fatalf("Could not create admin: %v", err)
+	}
+}
+
+// RATE_LIMIT_READ="300/m", RATE_LIMIT_WRITE, RATE_LIMIT_LOGIN and
+// RATE_LIMIT_UPGRADE take count/period or off. WS_MAX_CONNECTIONS caps
+// open sockets per IP, TRUST_PROXY="true" reads IPs from X-Forwarded-For.
+func initRateLimits() {
+	api.SetTrustProxy(GetEnv("TRUST_PROXY") == "true")
+	api.SetRateLimits(api.RateLimitConfig{
+		Read:        rateEnv("RATE_LIMIT_READ"),
+		Write:       rateEnv("RATE_LIMIT_WRITE"),
+		Login:       rateEnv("RATE_LIMIT_LOGIN"),
+		Upgrade:     rateEnv("RATE_LIMIT_UPGRADE"),
+		Connections: positiveEnv("WS_MAX_CONNECTIONS"),
+	})
+}
+
+// WS_ALLOWED_ORIGINS="https://example.com,https://*.example.com" lists
+// the pages that may open sockets, WEB_URL when unset
+func initWebSocket() {
+	origins := GetEnv("WS_ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = GetEnv("WEB_URL")
+	}
+	ws.SetAllowedOrigins(splitList(origins))
+	log.Printf("WebSocket origins: %s", strings.Join(ws.AllowedOrigins(), ", "))
+}
+
+// CSP replaces the Content-Security-Policy, {nonce} standing for the
+// script nonce; pages are not cached while it is used.
+// CSP_REPORT_ONLY="true" only reports violations.
+// HSTS_INCLUDE_SUBDOMAINS="true" extends HSTS to every subdomain.
+// HSTS_MAX_AGE, FRAME_OPTIONS, REFERRER_POLICY and PERMISSIONS_POLICY
+// override the other headers.
+func initSecurity() {
+	api.SetSecurityConfig(api.SecurityConfig{
+		CSP:                   GetEnv("CSP"),
+		ReportOnly:            GetEnv("CSP_REPORT_ONLY") == "true",
+		HSTSMaxAge:            durationEnv("HSTS_MAX_AGE"),
+		HSTSIncludeSubDomains: GetEnv("HSTS_INCLUDE_SUBDOMAINS") == "true",
+		FrameOptions:          GetEnv("FRAME_OPTIONS"),
+		ReferrerPolicy:        GetEnv("REFERRER_POLICY"),
+		PermissionsPolicy:     GetEnv("PERMISSIONS_POLICY"),
+	})
+}
+
+// COMPRESS="off" sends every response as it is. COMPRESS_MIN_SIZE sets
+// the smallest body worth compressing in bytes, COMPRESS_LEVEL the gzip
+// and deflate level from 1 to 9, and COMPRESS_TYPES the content types.
+func initCompression() {
+	level := positiveEnv("COMPRESS_LEVEL")
+	if level > 9 {
+		log.Fatalf("Invalid COMPRESS_LEVEL %d, expected 1 to 9", level)
+	}
+
+	api.SetCompression(api.CompressionConfig{
+		Off:     GetEnv("COMPRESS") == "off",
+		MinSize: positiveEnv("COMPRESS_MIN_SIZE"),
+		Level:   level,
+		Types:   splitList(GetEnv("COMPRESS_TYPES")),
+	})
+}
+
+// Zero when unset, leaving the default in place
+func rateEnv(key string) limit.Rate {
+	value := GetEnv(key)
+	if value == "" {
+		return limit.Rate{}
+	}
+
+	rate, err := limit.ParseRate(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return rate
+}
+
+// Zero when unset, leaving the default in place
+func sameSiteEnv(key string) http.SameSite {
+	switch value := strings.ToLower(GetEnv(key)); value {
+	case "":
+		return 0
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		log.Fatalf("Invalid %s %q, expected lax, strict or none", key, value)
+		return 0
+	}
+}
+
+// Zero when unset, leaving the default in place
+func durationEnv(key string) time.Duration {
+	value := GetEnv(key)
+	if value == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Invalid %s %q", key, value)
+	}
+	return d
 }
@@ -0,0 +1,509 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"main/api"
+	"main/auth"
+	"main/db"
+	"main/message"
+	"main/server"
+	"main/ws"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	testAdmin    = "admin"
+	testPassword = "correct horse battery"
+	testCSRF     = "cm91dGUtdGVzdC1jc3JmLXRva2VuLTMyLWJ5dGVzISE"
+)
+
+// Registers every route on the default mux, against fresh databases
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+
+	dir, err := os.MkdirTemp("", "routes-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for key, value := range map[string]string{
+		"ASSETS_DIR":         "..",
+		"ADMIN_USERNAME":     testAdmin,
+		"ADMIN_PASSWORD":     testPassword,
+		"RATE_LIMIT_READ":    "off",
+		"RATE_LIMIT_WRITE":   "off",
+		"RATE_LIMIT_LOGIN":   "off",
+		"RATE_LIMIT_UPGRADE": "off",
+	} {
+		os.Setenv(key, value)
+	}
+	if err := InitEnv(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	SetDevAssets(true)
+
+	if err := db.InitDb(db.Config{DataDir: dir, SrcDir: "../db/src"}); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	Setup(&ws.Server{Server: server.Run()})
+
+	code := m.Run()
+	db.CloseDb()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	documented := map[string]bool{}
+	for _, route := range api.Routes {
+		documented[route.Pattern] = true
+		if !strings.HasPrefix(route.Path, strings.TrimSuffix(route.Pattern, "/")) {
+			t.Errorf("spec path %s does not match pattern %s", route.Path, route.Pattern)
+		}
+	}
+
+	registered := map[string]bool{}
+	for _, pattern := range Routes() {
+		registered[pattern] = true
+		if !documented[pattern] {
+			t.Errorf("route %s is registered but not in the spec", pattern)
+		}
+	}
+	for _, route := range api.Routes {
+		if !registered[route.Pattern] {
+			t.Errorf("route %s is in the spec but not registered", route.Pattern)
+		}
+	}
+}
+
+var checkedMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// Every documented method is handled and every other one is a 405, and
+// whatever JSON comes back fits the spec's schema for its status
+func TestMethodsAndResponsesMatchSpec(t *testing.T) {
+	spec := specDocument(t)
+
+	for _, route := range api.Routes {
+		methods := map[string]api.OperationSpec{}
+		for _, op := range route.Operations {
+			methods[op.Method] = op
+		}
+
+		for _, method := range checkedMethods {
+			op, documented := methods[method]
+			name := method + " " + route.Path
+			t.Run(name, func(t *testing.T) {
+				var body interface{}
+				if documented {
+					body = op.Request
+				}
+				w := serve(t, method, samplePath(t, route.Path), body)
+
+				if !documented {
+					// Unknown API paths are a 404 whatever the method
+					want := http.StatusMethodNotAllowed
+					if route.Pattern == "/api/" {
+						want = http.StatusNotFound
+					}
+					if w.Code != want {
+						t.Fatalf("undocumented method got %d, want %d", w.Code, want)
+					}
+					return
+				}
+				if w.Code == http.StatusMethodNotAllowed {
+					t.Fatalf("documented method got 405")
+				}
+				checkResponse(t, spec, route.Path, method, w)
+			})
+		}
+	}
+}
+
+// Request bodies built from the spec's types are accepted, and what
+// comes back is what the spec says
+func TestRequestTypesMatchSpec(t *testing.T) {
+	spec := specDocument(t)
+
+	create := message.CreateProjectRequest{
+		Name:   "Spec",
+		Desc:   "Created by the spec test",
+		Repo:   "https://github.com/example/spec",
+		Photos: []string{"https://example.com/a.png"},
+		Videos: []string{},
+		Links:  []message.Link{{Name: "Site", URL: "https://example.com"}},
+	}
+	checkRequest(t, spec, "/api/projects", http.MethodPost, create)
+	w := serve(t, http.MethodPost, "/api/projects", create)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create got %d: %s", w.Code, w.Body)
+	}
+	checkResponse(t, spec, "/api/projects", http.MethodPost, w)
+
+	var created struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/api/projects/" + strconv.Itoa(created.Id)
+
+	update := message.UpdateProjectRequest{
+		Name:   "Spec updated",
+		Desc:   create.Desc,
+		Repo:   create.Repo,
+		Photos: create.Photos,
+		Videos: create.Videos,
+		Links:  create.Links,
+	}
+	checkRequest(t, spec, "/api/projects/{id}", http.MethodPut, update)
+	w = serve(t, http.MethodPut, path, update)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update got %d: %s", w.Code, w.Body)
+	}
+	checkResponse(t, spec, "/api/projects/{id}", http.MethodPut, w)
+
+	w = serve(t, http.MethodGet, path, nil)
+	checkResponse(t, spec, "/api/projects/{id}", http.MethodGet, w)
+	w = serve(t, http.MethodGet, "/api/v2/projects/"+strconv.Itoa(created.Id), nil)
+	checkResponse(t, spec, "/api/v2/projects/{id}", http.MethodGet, w)
+
+	w = serve(t, http.MethodDelete, path, nil)
+	if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Fatalf("delete got %d: %s", w.Code, w.Body)
+	}
+	checkResponse(t, spec, "/api/projects/{id}", http.MethodDelete, w)
+}
+
+// Patches that only reorder media or links are stored, not dropped
+func TestPatchKeepsOrder(t *testing.T) {
+	w := serve(t, http.MethodPost, "/api/projects", message.CreateProjectRequest{
+		Name:   "Order",
+		Desc:   "Reordered by a patch",
+		Photos: []string{"https://example.com/a.png", "https://example.com/b.png"},
+		Videos: []string{"https://example.com/a.mp4"},
+		Links:  []message.Link{{Name: "A", URL: "https://example.com/a"}, {Name: "B", URL: "https://example.com/b"}},
+	})
+	var created struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/api/projects/" + strconv.Itoa(created.Id)
+
+	tests := []struct {
+		name   string
+		patch  map[string]interface{}
+		photos string
+		links  string
+	}{
+		{
+			"reordered",
+			map[string]interface{}{
+				"photos": []string{"https://example.com/b.png", "https://example.com/a.png"},
+				"links":  []message.Link{{Name: "B", URL: "https://example.com/b"}, {Name: "A", URL: "https://example.com/a"}},
+			},
+			"b.png a.png", "B A",
+		},
+		{
+			"added first",
+			map[string]interface{}{
+				"links": []message.Link{{Name: "C", URL: "https://example.com/c"}, {Name: "B", URL: "https://example.com/b"}, {Name: "A", URL: "https://example.com/a"}},
+			},
+			"b.png a.png", "C B A",
+		},
+	}
+
+	for _, tt := range tests {
+		if w := serve(t, http.MethodPatch, path, tt.patch); w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", tt.name, w.Code, w.Body)
+		}
+
+		var project message.Project
+		json.Unmarshal(serve(t, http.MethodGet, path, nil).Body.Bytes(), &project)
+		photos, links := []string{}, []string{}
+		for _, m := range project.Media {
+			if m.Type == "photo" {
+				photos = append(photos, strings.TrimPrefix(m.URL, "https://example.com/"))
+			}
+		}
+		for _, l := range project.Links {
+			links = append(links, l.Name)
+		}
+		if got := strings.Join(photos, " "); got != tt.photos {
+			t.Errorf("%s: got photos %q, want %q", tt.name, got, tt.photos)
+		}
+		if got := strings.Join(links, " "); got != tt.links {
+			t.Errorf("%s: got links %q, want %q", tt.name, got, tt.links)
+		}
+	}
+
+	var before, after message.Project
+	json.Unmarshal(serve(t, http.MethodGet, path, nil).Body.Bytes(), &before)
+	serve(t, http.MethodPatch, path, map[string]interface{}{"photos": []string{"https://example.com/b.png", "https://example.com/a.png"}})
+	json.Unmarshal(serve(t, http.MethodGet, path, nil).Body.Bytes(), &after)
+	if after.Version != before.Version {
+		t.Errorf("unchanged order: version went from %d to %d", before.Version, after.Version)
+	}
+}
+
+func specDocument(t *testing.T) map[string]interface{} {
+	t.Helper()
+	content, err := json.Marshal(api.BuildOpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(content, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// A project to point {id} at, so id routes reach their handlers
+func sampleProject(t *testing.T) int {
+	t.Helper()
+	w := serve(t, http.MethodPost, "/api/projects", message.CreateProjectRequest{
+		Name:   "Sample",
+		Desc:   "Route test project",
+		Repo:   "https://github.com/example/sample",
+		Photos: []string{},
+		Videos: []string{},
+		Links:  []message.Link{},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("sample project got %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	return created.Id
+}
+
+func samplePath(t *testing.T, path string) string {
+	replacer := strings.NewReplacer(
+		"{page}", "1",
+		"{path}", "missing",
+	)
+	path = replacer.Replace(path)
+	if strings.Contains(path, "{id}") {
+		id := "1"
+		if strings.Contains(path, "projects") {
+			id = strconv.Itoa(sampleProject(t))
+		}
+		path = strings.ReplaceAll(path, "{id}", id)
+	}
+	return path
+}
+
+var adminSession string
+
+// Requests are made as the admin. Auth routes get a session of their
+// own, so signing out does not affect the next request.
+func serve(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(content)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	// Signing out everywhere revokes the shared session too
+	if _, err := auth.Authenticate(adminSession); err != nil {
+		adminSession = ""
+	}
+	token := adminSession
+	if token == "" || strings.HasPrefix(path, "/api/auth/") {
+		var err error
+		token, _, err = auth.Login(testAdmin, testPassword, "routes-test", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adminSession == "" {
+			adminSession = token
+		}
+	}
+	r.AddCookie(&http.Cookie{Name: "session", Value: token})
+	r.AddCookie(&http.Cookie{Name: "csrf", Value: testCSRF})
+	r.Header.Set("X-CSRF-Token", testCSRF)
+	r.Header.Set("Origin", "http://localhost:5500")
+
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, r)
+	return w
+}
+
+func operation(t *testing.T, spec map[string]interface{}, path, method string) map[string]interface{} {
+	t.Helper()
+	item, _ := spec["paths"].(map[string]interface{})[path].(map[string]interface{})
+	op, ok := item[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("no %s %s in the spec", method, path)
+	}
+	return op
+}
+
+func checkRequest(t *testing.T, spec map[string]interface{}, path, method string, body interface{}) {
+	t.Helper()
+	op := operation(t, spec, path, method)
+	content, _ := op["requestBody"].(map[string]interface{})["content"].(map[string]interface{})
+	media, ok := content["application/json"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s documents no JSON request", method, path)
+	}
+
+	var value interface{}
+	encoded, _ := json.Marshal(body)
+	json.Unmarshal(encoded, &value)
+	for _, problem := range validate(spec, media["schema"].(map[string]interface{}), value, "request") {
+		t.Errorf("%s %s %s", method, path, problem)
+	}
+}
+
+// The response must be documented under its status, a range or the
+// default, and JSON bodies must fit the documented schema
+func checkResponse(t *testing.T, spec map[string]interface{}, path, method string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	op := operation(t, spec, path, method)
+	responses := op["responses"].(map[string]interface{})
+
+	status := strconv.Itoa(w.Code)
+	response, ok := responses[status].(map[string]interface{})
+	if !ok {
+		response, ok = responses[status[:1]+"XX"].(map[string]interface{})
+	}
+	if !ok && w.Code >= 400 {
+		response, ok = responses["default"].(map[string]interface{})
+	}
+	if !ok {
+		t.Fatalf("status %d is not documented: %s", w.Code, w.Body)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if contentType != "application/json" || w.Body.Len() == 0 {
+		return
+	}
+	content, _ := response["content"].(map[string]interface{})
+	media, ok := content["application/json"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("status %d returned JSON the spec does not document", w.Code)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &value); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	for _, problem := range validate(spec, media["schema"].(map[string]interface{}), value, "response") {
+		t.Errorf("status %d %s", w.Code, problem)
+	}
+}
+
+// The subset of JSON Schema the generator emits
+func validate(spec map[string]interface{}, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		components := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		resolved, ok := components[name].(map[string]interface{})
+		if !ok {
+			return []string{at + ": unknown schema " + name}
+		}
+		return validate(spec, resolved, value, at)
+	}
+
+	problems := []string{}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			problems = append(problems, validate(spec, sub.(map[string]interface{}), value, at)...)
+		}
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable && schema["type"] != nil {
+			problems = append(problems, at+": is null")
+		}
+		return problems
+	}
+
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, at+": want a string")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, at+": want a boolean")
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			problems = append(problems, at+": want an integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, at+": want a number")
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, at+": want an array")
+		}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			problems = append(problems, validate(spec, itemSchema, item, at+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, at+": want an object")
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, at+"."+name.(string)+": missing")
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validate(spec, property, object[key], at+"."+key)...)
+			} else if additional != nil {
+				problems = append(problems, validate(spec, additional, object[key], at+"."+key)...)
+			} else if properties != nil && !slices.Contains(required, interface{}(key)) {
+				problems = append(problems, at+"."+key+": not in the spec")
+			}
+		}
+	}
+	return problems
+}
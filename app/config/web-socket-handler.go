@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"log"
+	"main/api"
 	"main/message"
 	"main/server"
 	"main/ws"
@@ -13,23 +14,28 @@ import (
 )
 
 func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.WriteMethodNotAllowed(w, r)
+		return
+	}
 	conn, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Websocket upgrade error!: %v", err)
 		return
 	}
 
+	sessionActive := api.SessionCheck(r)
 	clientId := server.GenerateClientId()
 	client := &server.Client{
 		Id:       clientId,
 		Conn:     conn,
 		Send:     make(chan message.Message, 256),
 		Channels: make(map[string]bool),
+		Admin:    sessionActive != nil,
 	}
 
 	s.Register <- client
 	go s.writePump(client)
-	go s.readPump(client)
 
 	client.Send <- message.Message{
 		Type: "connected",
@@ -39,6 +45,42 @@ func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			"message":   "Connected to API",
 		},
 	}
+
+	if client.Admin {
+		done := make(chan struct{})
+		defer close(done)
+		go watchSession(client, sessionActive, done)
+	}
+
+	// Held until the client goes, so middleware sees how long it stays
+	s.readPump(client)
+}
+
+// How often an admin connection checks its session is still live
+const sessionRecheck = 30 * time.Second
+
+// Signing out or revoking the session also ends the audit stream
+func watchSession(client *server.Client, active func() bool, done <-chan struct{}) {
+	ticker := time.NewTicker(sessionRecheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if active() {
+				continue
+			}
+			client.Conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Session ended"),
+				time.Now().Add(time.Second),
+			)
+			client.Conn.Close()
+			return
+		}
+	}
 }
 
 // Write Pump
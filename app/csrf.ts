@@ -0,0 +1,10 @@
+/**
+ * CSRF
+ *
+ * The server hands the editor and login pages a readable csrf cookie,
+ * state-changing requests echo it back in a header
+ */
+export function csrfHeader(): Record<string, string> {
+    const match = document.cookie.match(/(?:^|;\s*)csrf=([^;]*)/);
+    return match ? { 'X-CSRF-Token': decodeURIComponent(match[1]) } : {};
+}
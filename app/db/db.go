@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"os"
@@ -13,6 +15,9 @@ import (
 
 var DB = make(map[string]*sql.DB)
 
+// File of every database in DB, for ATTACH
+var paths = make(map[string]string)
+
 type Config struct {
 	DataDir string
 	SrcDir  string
@@ -40,6 +45,10 @@ func InitDb(config Config) error {
 		}
 	}
 
+	if err := Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+
 	log.Println("All databases initialized!")
 	return nil
 }
@@ -67,6 +76,7 @@ func createDbFromSqlFile(sqlFilePath, dataDir string) error {
 	}
 
 	DB[dbName] = db
+	paths[dbName] = dbPath
 	log.Printf("Databse created: %s", dbPath)
 	return nil
 }
@@ -81,6 +91,52 @@ func GetDb(name string) (*sql.DB, error) {
 	return db, nil
 }
 
+// Attach returns a connection to one database with the others attached
+// under their own names, so one transaction can write to all of them.
+// SQLite commits it atomically across the files as long as the main
+// database is not in WAL mode. Hand the connection back with Detach.
+func Attach(name string, others ...string) (*sql.Conn, error) {
+	db, err := GetDb(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, other := range others {
+		path, exists := paths[other]
+		if !exists {
+			Detach(conn, others[:i]...)
+			return nil,
+				fmt.Errorf("Database '%s' not found in registry", other)
+		}
+		if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+other, path); err != nil {
+			Detach(conn, others[:i]...)
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Detach undoes Attach and returns the connection to the pool. A
+// connection that cannot be detached is dropped instead, so no other
+// query ever sees the attached databases.
+func Detach(conn *sql.Conn, others ...string) {
+	ctx := context.Background()
+	for _, other := range others {
+		if _, err := conn.ExecContext(ctx, "DETACH DATABASE "+other); err != nil {
+			log.Printf("Failed to detach %s: %v", other, err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+			break
+		}
+	}
+	conn.Close()
+}
+
 // Close Db
 func CloseDb() {
 	for name, db := range DB {
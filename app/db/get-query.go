@@ -5,36 +5,72 @@ type QueryKey string
 
 const (
 	// Projects
-	GetAllProjects QueryKey = "GET_ALL_PROJECTS"
-	GetProjectById QueryKey = "GET_PROJECT_BY_ID"
-	InsertProject  QueryKey = "INSERT_PROJECT"
-	UpdateProject  QueryKey = "UPDATE_PROJECT"
-	DeleteProject  QueryKey = "DELETE_PROJECT"
+	GetAllProjects    QueryKey = "GET_ALL_PROJECTS"
+	GetProjectById    QueryKey = "GET_PROJECT_BY_ID"
+	GetProjectVersion QueryKey = "GET_PROJECT_VERSION"
+	InsertProject     QueryKey = "INSERT_PROJECT"
+	UpdateProject     QueryKey = "UPDATE_PROJECT"
+	DeleteProject     QueryKey = "DELETE_PROJECT"
 
 	// Media
 	GetProjectMedia    QueryKey = "GET_PROJECT_MEDIA"
 	InsertMedia        QueryKey = "INSERT_MEDIA"
+	UpdateMedia        QueryKey = "UPDATE_MEDIA"
+	DeleteMedia        QueryKey = "DELETE_MEDIA"
 	DeleteProjectMedia QueryKey = "DELETE_PROJECT_MEDIA"
 
 	// Links
 	GetProjectLinks    QueryKey = "GET_PROJECT_LINKS"
 	InsertLink         QueryKey = "INSERT_LINK"
+	UpdateLink         QueryKey = "UPDATE_LINK"
+	DeleteLink         QueryKey = "DELETE_LINK"
 	DeleteProjectLinks QueryKey = "DELETE_PROJECT_LINKS"
+
+	// Auth
+	CountAdmins           QueryKey = "COUNT_ADMINS"
+	GetAdminByUsername    QueryKey = "GET_ADMIN_BY_USERNAME"
+	InsertAdmin           QueryKey = "INSERT_ADMIN"
+	UpdateAdminPassword   QueryKey = "UPDATE_ADMIN_PASSWORD"
+	InsertSession         QueryKey = "INSERT_SESSION"
+	GetSession            QueryKey = "GET_SESSION"
+	TouchSession          QueryKey = "TOUCH_SESSION"
+	RevokeSession         QueryKey = "REVOKE_SESSION"
+	RevokeAdminSessions   QueryKey = "REVOKE_ADMIN_SESSIONS"
+	DeleteExpiredSessions QueryKey = "DELETE_EXPIRED_SESSIONS"
+	InsertToken           QueryKey = "INSERT_TOKEN"
+	GetTokenByPrefix      QueryKey = "GET_TOKEN_BY_PREFIX"
+	GetAdminTokens        QueryKey = "GET_ADMIN_TOKENS"
+	TouchToken            QueryKey = "TOUCH_TOKEN"
+	RevokeToken           QueryKey = "REVOKE_TOKEN"
+
+	// Security
+	InsertCSPReport QueryKey = "INSERT_CSP_REPORT"
+	GetCSPReports   QueryKey = "GET_CSP_REPORTS"
+	PruneCSPReports QueryKey = "PRUNE_CSP_REPORTS"
+
+	// Audit
+	InsertAuditEntry  QueryKey = "INSERT_AUDIT_ENTRY"
+	GetAuditEntries   QueryKey = "GET_AUDIT_ENTRIES"
+	GetAuditEntry     QueryKey = "GET_AUDIT_ENTRY"
+	GetAuditRestoreOf QueryKey = "GET_AUDIT_RESTORE_OF"
 )
 
 // Registry
 var QueryRegistry = map[QueryKey]string{
 	// Projects
 	GetAllProjects: `
-		SELECT id, name, description, repo, createdAt, updatedAt
+		SELECT id, name, description, repo, version, createdAt, updatedAt
 		FROM project
 		ORDER BY updatedAt DESC
 	`,
 	GetProjectById: `
-		SELECT id, name, description, repo, createdAt, updatedAt
+		SELECT id, name, description, repo, version, createdAt, updatedAt
 		FROM project
 		WHERE id = ?
 	`,
+	GetProjectVersion: `
+		SELECT version FROM project WHERE id = ?
+	`,
 	InsertProject: `
 		INSERT INTO project(name, description, repo)
 		VALUES(?, ?, ?)
@@ -45,11 +81,12 @@ var QueryRegistry = map[QueryKey]string{
 			name = ?,
 			description = ?,
 			repo = ?,
+			version = version + 1,
 			updatedAt = CURRENT_TIMESTAMP
-		WHERE id = ?
+		WHERE id = ? AND version = ?
 	`,
 	DeleteProject: `
-		DELETE FROM project WHERE id = ?
+		DELETE FROM project WHERE id = ? AND version = ?
 	`,
 
 	// Media
@@ -57,10 +94,19 @@ var QueryRegistry = map[QueryKey]string{
 		SELECT id, projectId, type, url
 		FROM media
 		WHERE projectId = ?
+		ORDER BY position, id
 	`,
 	InsertMedia: `
-		INSERT INTO media (projectId, type, url)
-		VALUES (?, ?, ?)
+		INSERT INTO media (projectId, type, url, position)
+		VALUES (?, ?, ?, ?)
+	`,
+	UpdateMedia: `
+		UPDATE media
+		SET type = ?, url = ?, position = ?
+		WHERE id = ? AND projectId = ?
+	`,
+	DeleteMedia: `
+		DELETE FROM media WHERE id = ? AND projectId = ?
 	`,
 	DeleteProjectMedia: `
 		DELETE FROM media WHERE projectId = ?
@@ -71,14 +117,142 @@ var QueryRegistry = map[QueryKey]string{
 		SELECT id, projectId, name, url
 		FROM links
 		WHERE projectId = ?
+		ORDER BY position, id
 	`,
 	InsertLink: `
-		INSERT INTO links(projectId, name, url)
-		VALUES (?, ?, ?)
+		INSERT INTO links(projectId, name, url, position)
+		VALUES (?, ?, ?, ?)
+	`,
+	UpdateLink: `
+		UPDATE links
+		SET name = ?, url = ?, position = ?
+		WHERE id = ? AND projectId = ?
+	`,
+	DeleteLink: `
+		DELETE FROM links WHERE id = ? AND projectId = ?
 	`,
 	DeleteProjectLinks: `
 		DELETE FROM links WHERE projectId = ?
 	`,
+
+	// Auth
+	CountAdmins: `
+		SELECT COUNT(*) FROM admin
+	`,
+	GetAdminByUsername: `
+		SELECT id, username, passwordHash
+		FROM admin
+		WHERE username = ?
+	`,
+	InsertAdmin: `
+		INSERT INTO admin(username, passwordHash)
+		VALUES (?, ?)
+	`,
+	UpdateAdminPassword: `
+		UPDATE admin
+		SET passwordHash = ?, updatedAt = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`,
+	InsertSession: `
+		INSERT INTO session(id, adminId, createdAt, expiresAt, lastSeenAt, userAgent, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+	GetSession: `
+		SELECT s.id, s.adminId, a.username, s.createdAt, s.expiresAt, s.lastSeenAt, s.revokedAt
+		FROM session s
+		JOIN admin a ON a.id = s.adminId
+		WHERE s.id = ?
+	`,
+	TouchSession: `
+		UPDATE session SET lastSeenAt = ? WHERE id = ?
+	`,
+	RevokeSession: `
+		UPDATE session SET revokedAt = ? WHERE id = ? AND revokedAt IS NULL
+	`,
+	RevokeAdminSessions: `
+		UPDATE session SET revokedAt = ? WHERE adminId = ? AND revokedAt IS NULL
+	`,
+	DeleteExpiredSessions: `
+		DELETE FROM session WHERE expiresAt < ? OR revokedAt < ?
+	`,
+	InsertToken: `
+		INSERT INTO apiToken(adminId, name, prefix, hash, scopes, createdAt, expiresAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+	GetTokenByPrefix: `
+		SELECT t.id, t.adminId, a.username, t.name, t.prefix, t.hash, t.scopes,
+			t.createdAt, t.expiresAt, t.lastUsedAt, t.revokedAt
+		FROM apiToken t
+		JOIN admin a ON a.id = t.adminId
+		WHERE t.prefix = ?
+	`,
+	GetAdminTokens: `
+		SELECT t.id, t.adminId, a.username, t.name, t.prefix, t.hash, t.scopes,
+			t.createdAt, t.expiresAt, t.lastUsedAt, t.revokedAt
+		FROM apiToken t
+		JOIN admin a ON a.id = t.adminId
+		WHERE t.adminId = ?
+		ORDER BY t.id
+	`,
+	TouchToken: `
+		UPDATE apiToken SET lastUsedAt = ? WHERE id = ?
+	`,
+	RevokeToken: `
+		UPDATE apiToken SET revokedAt = ? WHERE id = ? AND adminId = ? AND revokedAt IS NULL
+	`,
+
+	// Security
+	InsertCSPReport: `
+		INSERT INTO cspReport(documentUri, directive, blockedUri, sourceFile, lineNumber, disposition, userAgent, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+	GetCSPReports: `
+		SELECT id, documentUri, directive, blockedUri, sourceFile, lineNumber, disposition, userAgent, createdAt
+		FROM cspReport
+		ORDER BY id DESC
+		LIMIT ?
+	`,
+	PruneCSPReports: `
+		DELETE FROM cspReport
+		WHERE id <= (SELECT MAX(id) FROM cspReport) - ?
+	`,
+
+	// Audit
+	InsertAuditEntry: `
+		INSERT INTO auditLog(
+			action, entity, entityId, projectId,
+			actorType, actorId, actorName, tokenId, tokenName, ip, requestId,
+			before, after, diff, restoredFrom, createdAt
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+	GetAuditEntries: `
+		SELECT id, action, entity, entityId, projectId,
+			actorType, actorId, actorName, tokenId, tokenName, ip, requestId,
+			before, after, diff, restoredFrom, createdAt
+		FROM auditLog
+		WHERE (?1 = '' OR entity = ?1)
+			AND (?2 = '' OR action = ?2)
+			AND (?3 = 0 OR projectId = ?3)
+			AND (?4 = 0 OR entityId = ?4)
+			AND (?5 = '' OR actorType = ?5)
+			AND (?6 = '' OR actorName = ?6)
+			AND (?7 = 0 OR createdAt >= ?7)
+			AND (?8 = 0 OR createdAt < ?8)
+			AND (?9 = 0 OR id < ?9)
+		ORDER BY id DESC
+		LIMIT ?10
+	`,
+	GetAuditEntry: `
+		SELECT id, action, entity, entityId, projectId,
+			actorType, actorId, actorName, tokenId, tokenName, ip, requestId,
+			before, after, diff, restoredFrom, createdAt
+		FROM auditLog
+		WHERE id = ?
+	`,
+	GetAuditRestoreOf: `
+		SELECT id FROM auditLog WHERE restoredFrom = ? AND entity = 'project'
+	`,
 }
 
 // Get Query
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"log"
+)
+
+// Columns added after a table was first shipped. CREATE TABLE IF NOT EXISTS
+// never touches existing databases, so these are applied on startup.
+type Migration struct {
+	Db         string
+	Table      string
+	Column     string
+	Definition string
+}
+
+var Migrations = []Migration{
+	{"project", "project", "version", "INTEGER NOT NULL DEFAULT 1"},
+	// Rows from before keep 0 and so their id order
+	{"media", "media", "position", "INTEGER NOT NULL DEFAULT 0"},
+	{"links", "links", "position", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// Migrate
+func Migrate() error {
+	for _, m := range Migrations {
+		exists, err := columnExists(m.Db, m.Table, m.Column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s.%s: %w", m.Table, m.Column, err)
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition)
+		if _, err := Exec(m.Db, query); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.Table, m.Column, err)
+		}
+		log.Printf("Migrated: added %s.%s", m.Table, m.Column)
+	}
+	return nil
+}
+
+func columnExists(dbName, table, column string) (bool, error) {
+	rows, err := Query(dbName, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue interface{}
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
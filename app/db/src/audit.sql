@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS auditLog (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action TEXT NOT NULL,
+    entity TEXT NOT NULL,
+    entityId INTEGER NOT NULL,
+    projectId INTEGER NOT NULL,
+    actorType TEXT NOT NULL,
+    actorId INTEGER,
+    actorName TEXT,
+    tokenId INTEGER,
+    tokenName TEXT,
+    ip TEXT,
+    requestId TEXT,
+    before TEXT,
+    after TEXT,
+    diff TEXT,
+    restoredFrom INTEGER,
+    createdAt INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_project_id ON auditLog(projectId);
+CREATE INDEX IF NOT EXISTS idx_audit_created_at ON auditLog(createdAt);
+-- A delete entry is restored once. Only the project entry counts: its
+-- media and links carry the same restoredFrom.
+DROP INDEX IF EXISTS idx_audit_restored_from;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_restored_once ON auditLog(restoredFrom) WHERE entity = 'project';
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS admin (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    passwordHash TEXT NOT NULL,
+    createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    adminId INTEGER NOT NULL,
+    createdAt INTEGER NOT NULL,
+    expiresAt INTEGER NOT NULL,
+    lastSeenAt INTEGER NOT NULL,
+    revokedAt INTEGER,
+    userAgent TEXT,
+    ip TEXT,
+    FOREIGN KEY (adminId) REFERENCES admin(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS sessionAdmin ON session(adminId);
+
+CREATE TABLE IF NOT EXISTS apiToken (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    adminId INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    createdAt INTEGER NOT NULL,
+    expiresAt INTEGER,
+    lastUsedAt INTEGER,
+    revokedAt INTEGER,
+    FOREIGN KEY (adminId) REFERENCES admin(id) ON DELETE CASCADE
+);
@@ -2,7 +2,8 @@ CREATE TABLE IF NOT EXISTS media (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     projectId INTEGER NOT NULL,
     type TEXT NOT NULL,
-    url TEXT NOT NULL
+    url TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE INDEX IF NOT EXISTS idx_media_project_id ON media(projectId);
\ No newline at end of file
@@ -3,6 +3,7 @@ CREATE TABLE IF NOT EXISTS project (
     name TEXT NOT NULL,
     description TEXT,
     repo TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
     createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
     updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS cspReport (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    documentUri TEXT NOT NULL,
+    directive TEXT NOT NULL,
+    blockedUri TEXT,
+    sourceFile TEXT,
+    lineNumber INTEGER,
+    disposition TEXT,
+    userAgent TEXT,
+    createdAt INTEGER NOT NULL
+);
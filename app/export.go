@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"main/api"
+	"main/config"
+	"main/export"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// export [-out dist] [-base-url https://example.com]
+func runExport(args []string) error {
+	siteURL := config.GetEnv("SITE_URL")
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := flags.String("out", "dist", "output directory")
+	baseURL := flags.String("base-url", siteURL, "public URL of the static site, defaults to SITE_URL")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Feeds and sitemaps link to where the files will be hosted
+	api.SetSiteURL(*baseURL)
+
+	appDir := "."
+	if _, err := os.Stat("app"); err == nil {
+		appDir = "app"
+	}
+
+	return export.Run(http.DefaultServeMux, export.Options{
+		Out:       *out,
+		BaseURL:   *baseURL,
+		ServerURL: siteURL,
+		Index:     filepath.Join(appDir, "index.html"),
+		Scripts:   filepath.Join(appDir, ".out"),
+		Styles:    filepath.Join(appDir, ".styles"),
+		Static:    filepath.Join(appDir, "server"),
+	})
+}
@@ -0,0 +1,272 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Marks exported pages, so the client reads the JSON files next to them
+// and leaves real-time features off
+const staticMeta = `<meta name="static-export" content="true">`
+
+type Options struct {
+	Out     string
+	BaseURL string
+	// Origin the server runs on, rewritten to root-relative URLs
+	ServerURL string
+
+	Index   string
+	Scripts string
+	Styles  string
+	Static  string
+}
+
+type exporter struct {
+	handler http.Handler
+	opts    Options
+	files   int
+}
+
+// Run renders every public route through handler into opts.Out
+func Run(handler http.Handler, opts Options) error {
+	if opts.Out == "" {
+		return fmt.Errorf("no output directory")
+	}
+	if _, err := url.ParseRequestURI(opts.BaseURL); err != nil {
+		return fmt.Errorf("invalid base URL %q", opts.BaseURL)
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	opts.ServerURL = strings.TrimSuffix(opts.ServerURL, "/")
+
+	if err := os.MkdirAll(opts.Out, 0755); err != nil {
+		return err
+	}
+
+	e := &exporter{handler: handler, opts: opts}
+
+	var projects []struct {
+		Id    int `json:"id"`
+		Media []struct {
+			URL string `json:"url"`
+		} `json:"media"`
+	}
+	body, err := e.get("/api/v1/projects", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &projects); err != nil {
+		return fmt.Errorf("project list: %w", err)
+	}
+
+	if err := e.index(); err != nil {
+		return err
+	}
+
+	routes := map[string]string{
+		"/api/v1/projects": "api/v1/projects.json",
+		"/api/v2/projects": "api/v2/projects.json",
+		"/feed.xml":        "feed.xml",
+		"/atom.xml":        "atom.xml",
+		"/feed.json":       "feed.json",
+		"/robots.txt":      "robots.txt",
+	}
+	for _, p := range projects {
+		id := strconv.Itoa(p.Id)
+		routes["/projects/"+id] = "projects/" + id + "/index.html"
+		routes["/api/v1/projects/"+id] = "api/v1/projects/" + id + ".json"
+		routes["/api/v2/projects/"+id] = "api/v2/projects/" + id + ".json"
+	}
+	for route, file := range routes {
+		if err := e.export(route, file, http.StatusOK); err != nil {
+			return err
+		}
+	}
+
+	if err := e.sitemaps(); err != nil {
+		return err
+	}
+	if err := e.export("/projects/0", "404.html", http.StatusNotFound); err != nil {
+		return err
+	}
+
+	if err := e.copyDir(opts.Scripts, "scripts"); err != nil {
+		return err
+	}
+	if err := e.copyDir(opts.Styles, "styles"); err != nil {
+		return err
+	}
+	for _, p := range projects {
+		for _, m := range p.Media {
+			if err := e.media(m.URL); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Exported %d files to %s", e.files, opts.Out)
+	return nil
+}
+
+func (e *exporter) get(route string, status int) ([]byte, error) {
+	r := httptest.NewRequest(http.MethodGet, e.opts.BaseURL+route, nil)
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, r)
+
+	if w.Code != status {
+		return nil, fmt.Errorf("GET %s: status %d", route, w.Code)
+	}
+	return w.Body.Bytes(), nil
+}
+
+func (e *exporter) export(route string, file string, status int) error {
+	body, err := e.get(route, status)
+	if err != nil {
+		return err
+	}
+
+	switch path.Ext(file) {
+	case ".html":
+		body = []byte(e.rewrite(string(body)))
+		body = []byte(strings.Replace(string(body), "<head>", "<head>\n    "+staticMeta, 1))
+	case ".json":
+		body = []byte(e.rewrite(string(body)))
+	}
+	return e.write(file, body)
+}
+
+// The client index is a plain file whose asset paths point at the
+// source tree
+func (e *exporter) index() error {
+	content, err := os.ReadFile(e.opts.Index)
+	if err != nil {
+		return err
+	}
+
+	page := strings.NewReplacer(
+		"./.styles/", "/styles/",
+		"./.out/", "/scripts/",
+		"<head>", "<head>\n    "+staticMeta,
+	).Replace(string(content))
+	return e.write("index.html", []byte(page))
+}
+
+// Sitemap pages are only linked from the index, so follow it
+func (e *exporter) sitemaps() error {
+	body, err := e.get("/sitemap.xml", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if err := e.write("sitemap.xml", body); err != nil {
+		return err
+	}
+
+	for page := 1; strings.Contains(string(body), "/sitemaps/"+strconv.Itoa(page)+".xml"); page++ {
+		name := "sitemaps/" + strconv.Itoa(page) + ".xml"
+		if err := e.export("/"+name, name, http.StatusOK); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Absolute links to the server become root-relative, which the static
+// host serves from the same paths
+func (e *exporter) rewrite(body string) string {
+	if e.opts.ServerURL == "" {
+		return body
+	}
+	return strings.ReplaceAll(body, e.opts.ServerURL+"/", "/")
+}
+
+// Media served by the server itself is copied, remote media is left alone
+func (e *exporter) media(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+
+	local := u.Path
+	if u.IsAbs() {
+		if e.opts.ServerURL == "" || !strings.HasPrefix(raw, e.opts.ServerURL+"/") {
+			return nil
+		}
+		local = strings.TrimPrefix(raw, e.opts.ServerURL)
+		local, _, _ = strings.Cut(local, "?")
+	}
+	if !strings.HasPrefix(local, "/") {
+		return nil
+	}
+
+	clean := path.Clean(local)
+	src := filepath.Join(e.opts.Static, filepath.FromSlash(clean))
+	if _, err := os.Stat(src); err != nil {
+		log.Printf("Warning: media %s not found at %s", raw, src)
+		return nil
+	}
+	return e.copyFile(src, strings.TrimPrefix(clean, "/"))
+}
+
+func (e *exporter) copyDir(src string, dest string) error {
+	if _, err := os.Stat(src); err != nil {
+		log.Printf("Warning: %s not found, skipping %s", src, dest)
+		return nil
+	}
+
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		return e.copyFile(file, path.Join(dest, filepath.ToSlash(rel)))
+	})
+}
+
+func (e *exporter) copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	target := filepath.Join(e.opts.Out, filepath.FromSlash(dest))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	e.files++
+	return nil
+}
+
+func (e *exporter) write(file string, body []byte) error {
+	target := filepath.Join(e.opts.Out, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, body, 0644); err != nil {
+		return err
+	}
+	e.files++
+	return nil
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const server = "http://localhost:3000"
+
+// Stands in for the routes: every response links back to the server
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	reply := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, body) }
+	}
+
+	projects := `[{"id": 1, "media": [{"url": "` + server + `/uploads/a.png?v=2"}, {"url": "https://cdn.example.com/b.png"}, {"url": "/uploads/missing.png"}]}]`
+	mux.HandleFunc("/api/v1/projects", reply(projects))
+	mux.HandleFunc("/api/v2/projects", reply(`{"projects": []}`))
+	mux.HandleFunc("/api/v1/projects/1", reply(`{"url": "`+server+`/projects/1"}`))
+	mux.HandleFunc("/api/v2/projects/1", reply(`{}`))
+	mux.HandleFunc("/projects/1", reply(`<html><head><link href="`+server+`/styles/a.css"></head></html>`))
+	mux.HandleFunc("/projects/0", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<html><head></head></html>")
+	})
+	for _, route := range []string{"/feed.xml", "/atom.xml", "/feed.json", "/robots.txt", "/sitemaps/1.xml", "/sitemaps/2.xml"} {
+		mux.HandleFunc(route, reply(route))
+	}
+	mux.HandleFunc("/sitemap.xml", reply("<loc>https://example.com/sitemaps/1.xml</loc><loc>https://example.com/sitemaps/2.xml</loc>"))
+	return mux
+}
+
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "index.html"), `<html><head><script src="./.out/main.js"></script><link href="./.styles/a.css"></head></html>`)
+	writeFile(t, filepath.Join(src, "out", "main.js"), "main")
+	writeFile(t, filepath.Join(src, "out", "nested", "util.js"), "util")
+	writeFile(t, filepath.Join(src, "static", "uploads", "a.png"), "png")
+
+	out := filepath.Join(t.TempDir(), "site")
+	err := Run(testHandler(), Options{
+		Out:       out,
+		BaseURL:   "https://example.com/",
+		ServerURL: server + "/",
+		Index:     filepath.Join(src, "index.html"),
+		Scripts:   filepath.Join(src, "out"),
+		Styles:    filepath.Join(src, "missing"),
+		Static:    filepath.Join(src, "static"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"index.html":             `<head>` + "\n    " + staticMeta + `<script src="/scripts/main.js"></script><link href="/styles/a.css">`,
+		"projects/1/index.html":  `<head>` + "\n    " + staticMeta + `<link href="/styles/a.css">`,
+		"404.html":               staticMeta,
+		"api/v1/projects/1.json": `{"url": "/projects/1"}`,
+		"api/v2/projects.json":   `{"projects": []}`,
+		"feed.xml":               "/feed.xml",
+		"sitemap.xml":            "/sitemaps/2.xml",
+		"sitemaps/2.xml":         "/sitemaps/2.xml",
+		"scripts/nested/util.js": "util",
+		"uploads/a.png":          "png",
+		"api/v1/projects.json":   `"url": "/uploads/a.png?v=2"`,
+		"robots.txt":             "/robots.txt",
+		"api/v2/projects/1.json": "{}",
+		"scripts/main.js":        "main",
+		"atom.xml":               "/atom.xml",
+		"feed.json":              "/feed.json",
+		"sitemaps/1.xml":         "/sitemaps/1.xml",
+	} {
+		content, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(file)))
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s: got %q, want %q in it", file, content, want)
+		}
+	}
+
+	for _, file := range []string{"styles", "b.png", "uploads/missing.png"} {
+		if _, err := os.Stat(filepath.Join(out, file)); err == nil {
+			t.Errorf("%s was exported", file)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"no output", Options{BaseURL: "https://example.com"}, "no output directory"},
+		{"no base URL", Options{Out: t.TempDir()}, "invalid base URL"},
+		{"relative base URL", Options{Out: t.TempDir(), BaseURL: "example.com"}, "invalid base URL"},
+		{"no index", Options{Out: t.TempDir(), BaseURL: "https://example.com", Index: "missing.html"}, "missing.html"},
+	}
+
+	for _, tt := range tests {
+		err := Run(testHandler(), tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	err := Run(failing, Options{Out: t.TempDir(), BaseURL: "https://example.com"})
+	if err == nil || err.Error() != "GET /api/v1/projects: status 500" {
+		t.Errorf("got %v", err)
+	}
+}
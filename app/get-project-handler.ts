@@ -4,7 +4,8 @@ import window from "./window.js";
 enum MessageType {
     PROJECT_CREATED = 'project_created',
     PROJECT_UPDATED = 'project_updated',
-    PROJECT_DELETED = 'project_deleted'
+    PROJECT_DELETED = 'project_deleted',
+    PROJECTS_BULK = 'projects_bulk'
 }
 
 export class GetProjectHandler {
@@ -12,6 +13,7 @@ export class GetProjectHandler {
     private onProjectCreated?: (data: any) => void;
     private onProjectUpdated?: (data: any) => void;
     private onProjectDeleted?: (data: any) => void;
+    private onProjectsBulk?: (data: any) => void;
     
     /**
      * 
@@ -72,6 +74,9 @@ export class GetProjectHandler {
             case MessageType.PROJECT_DELETED:
                 if(this.onProjectDeleted) this.onProjectDeleted(message.data);
                 break;
+            case MessageType.PROJECTS_BULK:
+                if(this.onProjectsBulk) this.onProjectsBulk(message.data);
+                break;
         }
     }
 
@@ -87,6 +92,10 @@ export class GetProjectHandler {
         this.onProjectDeleted = cb;
     }
 
+    public setOnProjectsBulk(cb: (data: any) => void): void {
+        this.onProjectsBulk = cb;
+    }
+
     /**
      * 
      * Disconnect
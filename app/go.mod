@@ -7,3 +7,5 @@ require github.com/gorilla/websocket v1.5.3 // direct
 require github.com/mattn/go-sqlite3 v1.14.33 // direct
 
 require github.com/joho/godotenv v1.5.1 // indirect
+
+require github.com/graphql-go/graphql v0.8.1 // direct
@@ -0,0 +1,80 @@
+package limit
+
+import (
+	"sort"
+	"sync"
+)
+
+// Connections caps how many long-lived connections a key holds open
+type Connections struct {
+	max int
+
+	mu       sync.Mutex
+	open     map[string]int
+	rejected uint64
+}
+
+func NewConnections(max int) *Connections {
+	return &Connections{max: max, open: map[string]int{}}
+}
+
+func (c *Connections) Max() int {
+	return c.max
+}
+
+// Acquire takes a slot for key, Release gives it back. Zero max means
+// no cap, but connections are still counted.
+func (c *Connections) Acquire(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.max > 0 && c.open[key] >= c.max {
+		c.rejected++
+		return false
+	}
+	c.open[key]++
+	return true
+}
+
+func (c *Connections) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.open[key] <= 1 {
+		delete(c.open, key)
+		return
+	}
+	c.open[key]--
+}
+
+type ConnectionCount struct {
+	Key  string
+	Open int
+}
+
+type ConnectionsState struct {
+	Max      int
+	Open     int
+	Rejected uint64
+	// Busiest first
+	Clients []ConnectionCount
+}
+
+// State reports at most max clients
+func (c *Connections) State(max int) ConnectionsState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := ConnectionsState{Max: c.max, Rejected: c.rejected, Clients: []ConnectionCount{}}
+	for key, open := range c.open {
+		state.Open += open
+		state.Clients = append(state.Clients, ConnectionCount{Key: key, Open: open})
+	}
+	sort.Slice(state.Clients, func(i, j int) bool {
+		return state.Clients[i].Open > state.Clients[j].Open
+	})
+	if len(state.Clients) > max {
+		state.Clients = state.Clients[:max]
+	}
+	return state
+}
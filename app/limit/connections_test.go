@@ -0,0 +1,44 @@
+package limit
+
+import "testing"
+
+func TestConnections(t *testing.T) {
+	c := NewConnections(2)
+
+	for i, want := range []bool{true, true, false} {
+		if got := c.Acquire("a"); got != want {
+			t.Errorf("a %d: got %v, want %v", i+1, got, want)
+		}
+	}
+	c.Acquire("b")
+
+	state := c.State(10)
+	if state.Max != 2 || state.Open != 3 || state.Rejected != 1 {
+		t.Errorf("got %+v", state)
+	}
+	if len(state.Clients) != 2 || state.Clients[0] != (ConnectionCount{Key: "a", Open: 2}) {
+		t.Errorf("got %+v", state.Clients)
+	}
+
+	c.Release("a")
+	if !c.Acquire("a") {
+		t.Error("released slot was not reused")
+	}
+	c.Release("b")
+	c.Release("b")
+	if state := c.State(1); state.Open != 2 || len(state.Clients) != 1 {
+		t.Errorf("got %+v", state)
+	}
+}
+
+func TestConnectionsUncapped(t *testing.T) {
+	c := NewConnections(0)
+	for i := 0; i < 100; i++ {
+		if !c.Acquire("a") {
+			t.Fatal("uncapped connection refused")
+		}
+	}
+	if state := c.State(10); state.Open != 100 || state.Rejected != 0 {
+		t.Errorf("got %+v", state)
+	}
+}
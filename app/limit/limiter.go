@@ -0,0 +1,185 @@
+package limit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate allows Limit requests per Per, all of them at once if the
+// client has been quiet for a while
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+func (r Rate) Off() bool {
+	return r.Limit <= 0
+}
+
+func (r Rate) String() string {
+	if r.Off() {
+		return "off"
+	}
+	switch {
+	case r.Per%time.Hour == 0:
+		return fmt.Sprintf("%d/%dh", r.Limit, r.Per/time.Hour)
+	case r.Per%time.Minute == 0:
+		return fmt.Sprintf("%d/%dm", r.Limit, r.Per/time.Minute)
+	case r.Per%time.Second == 0:
+		return fmt.Sprintf("%d/%ds", r.Limit, r.Per/time.Second)
+	}
+	return strconv.Itoa(r.Limit) + "/" + r.Per.String()
+}
+
+// Unlimited, unlike the zero Rate which means unset
+var Off = Rate{Limit: -1}
+
+// ParseRate reads "120/m", "10/s", "5/15m" or "off"
+func ParseRate(value string) (Rate, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return Off, nil
+	}
+
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q is not count/period", value)
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid count", value)
+	}
+
+	switch period {
+	case "s", "m", "h":
+		period = "1" + period
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid period", value)
+	}
+	return Rate{Limit: limit, Per: per}, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key, usually a client IP. Buckets
+// that have refilled are dropped, so idle clients cost nothing.
+type Limiter struct {
+	Name string
+	rate Rate
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	limited uint64
+}
+
+func NewLimiter(name string, rate Rate) *Limiter {
+	return &Limiter{
+		Name:    name,
+		rate:    rate,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (l *Limiter) Rate() Rate {
+	return l.rate
+}
+
+// Allow takes a token for key. When there is none it returns false and
+// how long until there is.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.rate.Off() {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Limit), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	l.limited++
+	wait := time.Duration((1 - b.tokens) / l.perSecond() * float64(time.Second))
+	return false, wait
+}
+
+func (l *Limiter) perSecond() float64 {
+	return float64(l.rate.Limit) / l.rate.Per.Seconds()
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	b.tokens = math.Min(float64(l.rate.Limit), b.tokens+now.Sub(b.last).Seconds()*l.perSecond())
+	b.last = now
+}
+
+// Full buckets look exactly like missing ones
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.rate.Limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type ClientState struct {
+	Key    string
+	Tokens float64
+}
+
+type LimiterState struct {
+	Name    string
+	Rate    Rate
+	Limited uint64
+	// Clients that used part of their allowance, emptiest first
+	Clients []ClientState
+}
+
+// State reports at most max clients
+func (l *Limiter) State(max int) LimiterState {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := LimiterState{Name: l.Name, Rate: l.rate, Limited: l.limited, Clients: []ClientState{}}
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens < float64(l.rate.Limit) {
+			state.Clients = append(state.Clients, ClientState{Key: key, Tokens: b.tokens})
+		}
+	}
+	sort.Slice(state.Clients, func(i, j int) bool {
+		return state.Clients[i].Tokens < state.Clients[j].Tokens
+	})
+	if len(state.Clients) > max {
+		state.Clients = state.Clients[:max]
+	}
+	return state
+}
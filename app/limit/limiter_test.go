@@ -0,0 +1,127 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Rate
+		ok    bool
+	}{
+		{"120/m", Rate{Limit: 120, Per: time.Minute}, true},
+		{" 10/s ", Rate{Limit: 10, Per: time.Second}, true},
+		{"5/15m", Rate{Limit: 5, Per: 15 * time.Minute}, true},
+		{"1/h", Rate{Limit: 1, Per: time.Hour}, true},
+		{"3/500ms", Rate{Limit: 3, Per: 500 * time.Millisecond}, true},
+		{"off", Off, true},
+		{"", Rate{}, false},
+		{"120", Rate{}, false},
+		{"0/m", Rate{}, false},
+		{"-1/m", Rate{}, false},
+		{"x/m", Rate{}, false},
+		{"10/", Rate{}, false},
+		{"10/d", Rate{}, false},
+		{"10/-1m", Rate{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %+v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestRateString(t *testing.T) {
+	tests := []struct {
+		rate Rate
+		want string
+	}{
+		{Rate{Limit: 120, Per: time.Minute}, "120/1m"},
+		{Rate{Limit: 5, Per: 15 * time.Minute}, "5/15m"},
+		{Rate{Limit: 1, Per: 2 * time.Hour}, "1/2h"},
+		{Rate{Limit: 10, Per: 90 * time.Second}, "10/90s"},
+		{Rate{Limit: 3, Per: 500 * time.Millisecond}, "3/500ms"},
+		{Off, "off"},
+		{Rate{}, "off"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rate.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.rate, got, tt.want)
+		}
+		if tt.rate.Off() {
+			continue
+		}
+		if parsed, err := ParseRate(tt.want); err != nil || parsed != tt.rate {
+			t.Errorf("%q does not parse back: %+v, %v", tt.want, parsed, err)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter("test", Rate{Limit: 3, Per: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait <= 19*time.Minute || wait > 20*time.Minute {
+		t.Errorf("got %v, wait %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key shares the bucket")
+	}
+
+	state := l.State(10)
+	if state.Name != "test" || state.Limited != 1 || len(state.Clients) != 2 {
+		t.Fatalf("got %+v", state)
+	}
+	if state.Clients[0].Key != "a" || state.Clients[0].Tokens >= 1 || state.Clients[1].Key != "b" {
+		t.Errorf("got %+v", state.Clients)
+	}
+	if state := l.State(1); len(state.Clients) != 1 {
+		t.Errorf("got %d clients", len(state.Clients))
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter("test", Rate{Limit: 2, Per: 100 * time.Millisecond})
+	l.Allow("a")
+	l.Allow("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("bucket did not refill")
+	}
+
+	// Full buckets are swept once a minute has passed since the last sweep
+	time.Sleep(100 * time.Millisecond)
+	l.mu.Lock()
+	l.sweep(time.Now().Add(time.Minute))
+	remaining := len(l.buckets)
+	l.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("%d full buckets kept", remaining)
+	}
+}
+
+func TestLimiterOff(t *testing.T) {
+	l := NewLimiter("test", Off)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("limited with the rate off")
+		}
+	}
+	if state := l.State(10); len(state.Clients) != 0 {
+		t.Errorf("got %+v", state)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"main/config"
 	"main/db"
@@ -34,8 +35,25 @@ func main() {
 		log.Fatal("Failed to load env config", err)
 	}
 
+	// -dev serves pages, scripts and styles from disk even when they are
+	// embedded, and without long-lived caching, so edits show up on reload
+	dev := flag.Bool("dev", false, "serve assets from disk, uncached, for live editing")
+	flag.Parse()
+
+	// Subcommands run against the same config and database instead of
+	// serving: "export" writes a static site, "admin" manages admins
+	command := flag.Arg(0)
+	args := []string{}
+	if flag.NArg() > 1 {
+		args = flag.Args()[1:]
+	}
+	// The export copies assets from disk under their plain names
+	config.SetDevAssets(*dev || command == "export")
+
 	serverAddr := config.GetEnv("SERVER_ADDR")
-	logs()
+	if command == "" {
+		logs()
+	}
 
 	cfg := db.Init()
 	if err := db.InitDb(cfg); err != nil {
@@ -49,6 +67,22 @@ func main() {
 	}
 	config.Setup(wsServer)
 
+	switch command {
+	case "":
+	case "export":
+		if err := runExport(args); err != nil {
+			log.Fatal("Export failed: ", err)
+		}
+		return
+	case "admin":
+		if err := runAdmin(args); err != nil {
+			log.Fatal("Admin command failed: ", err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown command %q, expected export or admin", command)
+	}
+
 	if err := http.ListenAndServe(serverAddr, nil); err != nil {
 		log.Fatal("HTTP server failed to start: ", err)
 	}
@@ -1,12 +1,15 @@
 import { ProjectService } from "./project-service.js";
 import { GetProjectHandler } from "./get-project-handler.js";
-import type { Project } from "./types.js";
+import type { Project, ProjectSummary } from "./types.js";
 import window from "./window.js";
+import { handleMediaErrors } from "./media-fallback.js";
 
 export class Main {
     private projectService: ProjectService;
     private projectHandler: GetProjectHandler;
-    private currentProjects: Project[] = [];
+    private static readonly MAX_PREVIEW_MEDIA = 3;
+
+    private currentProjects: ProjectSummary[] = [];
 
     constructor() {
         window.vars.APP_ENV = 'prod';
@@ -14,20 +17,46 @@ export class Main {
 
         this.projectService = new ProjectService();
         this.projectHandler = new GetProjectHandler();
+        handleMediaErrors();
 
         this.init();
         this.connect();
     }
 
     private async init(): Promise<void> {
-        await this.projectHandler.connect();
-        this.setupHandlers();
+        if(!window.vars.STATIC) {
+            await this.projectHandler.connect();
+            this.setupHandlers();
+        }
         await this.loadProjects();
         this.createModal();
         this.setupImageOverlay();
+        this.hydrate();
+    }
+
+    /**
+     * Hydrate
+     * 
+     * Server-rendered project pages embed their project,
+     * which opens without another request
+     */
+    private hydrate(): void {
+        const initial = document.getElementById('initial-project');
+        if(initial?.textContent) {
+            try {
+                this.showProjectDetails(JSON.parse(initial.textContent));
+                return;
+            } catch (err) {
+                console.error('Failed to read initial project', err);
+            }
+        }
+
+        const match = location.pathname.match(/^\/projects\/(\d+)\/?$/);
+        if(match) this.openProject(Number(match[1]));
     }
 
-    private connect(): WebSocket {
+    private connect(): WebSocket | null {
+        if(window.vars.STATIC) return null;
         const ws = new WebSocket(window.vars.SERVER_WS);
         return ws;
     }
@@ -56,7 +85,7 @@ export class Main {
     private async loadProjects(): Promise<void> {
         try {
             console.log('Loading projects...');
-            this.currentProjects = await this.projectService.getAllProjects();
+            this.currentProjects = await this.projectService.getProjectSummaries(Main.MAX_PREVIEW_MEDIA);
             console.log('Projects loaded:', this.currentProjects);
             this.renderProjects();
         } catch (err) {
@@ -94,6 +123,18 @@ export class Main {
         });
     }
 
+    /**
+     * Open Project
+     */
+    private async openProject(id: number): Promise<void> {
+        try {
+            const project = await this.projectService.getProject(id);
+            this.showProjectDetails(project);
+        } catch (err) {
+            console.error('Failed to load project', err);
+        }
+    }
+
     /**
      * Show Project Details
      */
@@ -116,7 +157,7 @@ export class Main {
                         <img src="${this.escapeHtml(photo.url)}" 
                             alt="Project photo" 
                             loading="lazy"
-                            onerror="this.style.display='none'">
+                            data-fallback="hide">
                     </div>
                 `;
             });
@@ -134,7 +175,7 @@ export class Main {
                                 <img src="${thumbnailUrl}" 
                                     alt="Video thumbnail" 
                                     class="video-thumbnail"
-                                    onerror="this.src='https://img.youtube.com/vi/${id}/hqdefault.jpg'"
+                                    data-fallback-src="https://img.youtube.com/vi/${id}/hqdefault.jpg"
                                 >
                                 <div class="play-button-overlay">▶</div>
                             </a>
@@ -276,19 +317,16 @@ export class Main {
         console.log(`Rendering ${this.currentProjects.length} projects`);
         
         this.currentProjects.forEach(project => {
-            const photos = project.media.filter(m => m.type === 'photo');
-            const videos = project.media.filter(m => m.type === 'video');
-            
-            const MAX_PREVIEW_MEDIA = 3;
-            const allMedia = [...photos, ...videos];
+            const MAX_PREVIEW_MEDIA = Main.MAX_PREVIEW_MEDIA;
+            const allMedia = [...project.photos, ...project.videos];
             const previewMedia = allMedia.slice(0, MAX_PREVIEW_MEDIA);
-            const hasMoreMedia = allMedia.length > MAX_PREVIEW_MEDIA;
+            const hasMoreMedia = project.mediaCount > MAX_PREVIEW_MEDIA;
 
             const projectContainer = document.createElement('div');
             projectContainer.className = 'project-container';
             
             projectContainer.addEventListener('click', () => {
-                this.showProjectDetails(project);
+                this.openProject(project.id);
             });
 
             let mediaHtml = '';
@@ -304,7 +342,7 @@ export class Main {
                             <img src="${this.escapeHtml(photo.url)}" 
                                 alt="Project photo" 
                                 loading="lazy"
-                                onerror="this.style.display='none'"
+                                data-fallback="hide"
                             >
                         </div>
                     `;
@@ -323,7 +361,7 @@ export class Main {
                                     <img src="${thumbnailUrl}" 
                                         alt="Video thumbnail" 
                                         class="video-thumbnail"
-                                        onerror="this.src='https://img.youtube.com/vi/${id}/hqdefault.jpg'"
+                                        data-fallback-src="https://img.youtube.com/vi/${id}/hqdefault.jpg"
                                     >
                                     <div class="play-button-overlay">▶</div>
                                 </div>
@@ -346,7 +384,7 @@ export class Main {
             if(hasMoreMedia) {
                 mediaHtml += `
                     <div class="more-media-indicator">
-                        +${allMedia.length - MAX_PREVIEW_MEDIA} more
+                        +${project.mediaCount - MAX_PREVIEW_MEDIA} more
                     </div>
                 `;
             }
@@ -0,0 +1,25 @@
+/**
+ * Media Fallback
+ *
+ * Inline onerror handlers are blocked by the Content-Security-Policy,
+ * so broken images are handled by one listener instead. Images marked
+ * data-fallback="hide" disappear, data-fallback-src swaps the source once.
+ */
+let installed = false;
+
+export function handleMediaErrors(): void {
+    if(installed) return;
+    installed = true;
+
+    document.addEventListener('error', (e) => {
+        const img = e.target;
+        if(!(img instanceof HTMLImageElement)) return;
+
+        const src = img.dataset.fallbackSrc;
+        if(src && img.src !== src) {
+            img.src = src;
+            return;
+        }
+        if(img.dataset.fallback === 'hide') img.style.display = 'none';
+    }, true);
+}
@@ -0,0 +1,42 @@
+package message
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Who made a change: an admin session, or a token acting for an admin
+type AuditActor struct {
+	Type      string `json:"type"`
+	AdminId   int    `json:"adminId"`
+	Username  string `json:"username"`
+	TokenId   int    `json:"tokenId,omitempty"`
+	TokenName string `json:"tokenName,omitempty"`
+	Ip        string `json:"ip"`
+	RequestId string `json:"requestId,omitempty"`
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditEntry struct {
+	Id        int                    `json:"id"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	EntityId  int                    `json:"entityId"`
+	ProjectId int                    `json:"projectId"`
+	Actor     AuditActor             `json:"actor"`
+	Before    json.RawMessage        `json:"before"`
+	After     json.RawMessage        `json:"after"`
+	Diff      map[string]AuditChange `json:"diff"`
+	// The delete entry a restore brought back
+	RestoredFrom int       `json:"restoredFrom,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type RestoreResponse struct {
+	Id      int64  `json:"id"`
+	Message string `json:"message"`
+}
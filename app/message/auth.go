@@ -0,0 +1,45 @@
+package message
+
+import "time"
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SessionResponse struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type TokenResponse struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// The plain token is only ever returned here
+type CreateTokenResponse struct {
+	TokenResponse
+	Token string `json:"token"`
+}
+
+type CSRFResponse struct {
+	Token  string `json:"token"`
+	Header string `json:"header"`
+}
@@ -0,0 +1,43 @@
+package message
+
+import "encoding/json"
+
+// Modes
+const (
+	BulkAtomic     = "atomic"
+	BulkBestEffort = "best_effort"
+)
+
+type BulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+type BulkOperation struct {
+	Op      string          `json:"op"`
+	Id      int             `json:"id,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type BulkResult struct {
+	Index   int        `json:"index"`
+	Op      string     `json:"op"`
+	Id      int        `json:"id,omitempty"`
+	Status  int        `json:"status"`
+	Version int        `json:"version,omitempty"`
+	Error   *BulkError `json:"error,omitempty"`
+}
+
+type BulkError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
@@ -0,0 +1,36 @@
+package message
+
+// JSON Feed 1.1, https://jsonfeed.org/version/1.1
+
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type JSONFeedItem struct {
+	Id            string               `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url,omitempty"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Attachments   []JSONFeedAttachment `json:"attachments,omitempty"`
+}
+
+type JSONFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
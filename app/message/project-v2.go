@@ -0,0 +1,71 @@
+package message
+
+import "time"
+
+// API v2 shapes. Fields are spelled out, media is split by type and
+// every response is wrapped in an envelope with room for metadata.
+
+type ProjectV2 struct {
+	Id          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Repository  string    `json:"repository"`
+	Version     int       `json:"version"`
+	Photos      []MediaV2 `json:"photos"`
+	Videos      []MediaV2 `json:"videos"`
+	Links       []LinkV2  `json:"links"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type MediaV2 struct {
+	Id  int    `json:"id"`
+	URL string `json:"url"`
+}
+
+type LinkV2 struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type ListMetaV2 struct {
+	Count int `json:"count"`
+}
+
+type ProjectListV2 struct {
+	Data []ProjectV2 `json:"data"`
+	Meta ListMetaV2  `json:"meta"`
+}
+
+type ProjectItemV2 struct {
+	Data ProjectV2 `json:"data"`
+}
+
+func (p Project) V2() ProjectV2 {
+	out := ProjectV2{
+		Id:          p.Id,
+		Name:        p.Name,
+		Description: p.Desc,
+		Repository:  p.Repo,
+		Version:     p.Version,
+		Photos:      []MediaV2{},
+		Videos:      []MediaV2{},
+		Links:       []LinkV2{},
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+
+	for _, m := range p.Media {
+		switch m.Type {
+		case "photo":
+			out.Photos = append(out.Photos, MediaV2{Id: m.Id, URL: m.URL})
+		case "video":
+			out.Videos = append(out.Videos, MediaV2{Id: m.Id, URL: m.URL})
+		}
+	}
+	for _, l := range p.Links {
+		out.Links = append(out.Links, LinkV2{Id: l.Id, Name: l.Name, URL: l.URL})
+	}
+	return out
+}
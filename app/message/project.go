@@ -7,6 +7,7 @@ type Project struct {
 	Name      string    `json:"name"`
 	Desc      string    `json:"desc"`
 	Repo      string    `json:"repo"`
+	Version   int       `json:"version"`
 	Media     []Media   `json:"media"`
 	Links     []Link    `json:"links"`
 	CreatedAt time.Time `json:"createdAt"`
@@ -44,3 +45,17 @@ type UpdateProjectRequest struct {
 	Videos []string `json:"videos"`
 	Links  []Link   `json:"links"`
 }
+
+type CreateProjectResponse struct {
+	Id      int64  `json:"id"`
+	Message string `json:"message"`
+}
+
+type UpdateProjectResponse struct {
+	Message string `json:"message"`
+	Version int    `json:"version"`
+}
+
+type DeleteProjectResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,40 @@
+package message
+
+type RateLimitsResponse struct {
+	Groups      []RateLimitGroup `json:"groups"`
+	Connections ConnectionLimit  `json:"connections"`
+}
+
+type RateLimitGroup struct {
+	Name    string            `json:"name"`
+	Rate    string            `json:"rate"`
+	Limited uint64            `json:"limited"`
+	Clients []RateLimitClient `json:"clients"`
+}
+
+type RateLimitClient struct {
+	Ip        string `json:"ip"`
+	Remaining int    `json:"remaining"`
+}
+
+type ConnectionLimit struct {
+	Max      int                `json:"max"`
+	Open     int                `json:"open"`
+	Rejected uint64             `json:"rejected"`
+	Clients  []ConnectionClient `json:"clients"`
+}
+
+type ConnectionClient struct {
+	Ip   string `json:"ip"`
+	Open int    `json:"open"`
+}
+
+type WebSocketOriginsResponse struct {
+	Allowed  []string         `json:"allowed"`
+	Rejected []RejectedOrigin `json:"rejected"`
+}
+
+type RejectedOrigin struct {
+	Origin string `json:"origin"`
+	Count  uint64 `json:"count"`
+}
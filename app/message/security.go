@@ -0,0 +1,15 @@
+package message
+
+import "time"
+
+type CSPReport struct {
+	Id          int       `json:"id"`
+	DocumentURI string    `json:"documentUri"`
+	Directive   string    `json:"directive"`
+	BlockedURI  string    `json:"blockedUri"`
+	SourceFile  string    `json:"sourceFile"`
+	LineNumber  int       `json:"lineNumber"`
+	Disposition string    `json:"disposition"`
+	UserAgent   string    `json:"userAgent"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
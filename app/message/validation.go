@@ -0,0 +1,171 @@
+package message
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits
+const (
+	MaxNameLength     = 120
+	MaxDescLength     = 5000
+	MaxURLLength      = 2048
+	MaxLinkNameLength = 80
+	MaxPhotos         = 50
+	MaxVideos         = 20
+	MaxLinks          = 20
+)
+
+// Codes
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeTooMany       = "too_many"
+	CodeInvalidURL    = "invalid_url"
+	CodeInvalidScheme = "invalid_scheme"
+	CodeDuplicate     = "duplicate"
+	CodeInvalidValue  = "invalid_value"
+	CodeUnknownField  = "unknown_field"
+	CodeInvalidPatch  = "invalid_patch"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for _, e := range v {
+		parts = append(parts, e.Field+": "+e.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (v *ValidationErrors) add(field, code, msg string) {
+	*v = append(*v, FieldError{
+		Field:   field,
+		Code:    code,
+		Message: msg,
+	})
+}
+
+// Validate
+func (r CreateProjectRequest) Validate() ValidationErrors {
+	return validateProject(r.Name, r.Desc, r.Repo, r.Photos, r.Videos, r.Links)
+}
+
+func (r UpdateProjectRequest) Validate() ValidationErrors {
+	return validateProject(r.Name, r.Desc, r.Repo, r.Photos, r.Videos, r.Links)
+}
+
+func validateProject(
+	name string,
+	desc string,
+	repo string,
+	photos []string,
+	videos []string,
+	links []Link,
+) ValidationErrors {
+	errs := ValidationErrors{}
+
+	validateText(&errs, "name", name, MaxNameLength, true)
+	validateText(&errs, "desc", desc, MaxDescLength, true)
+	if strings.TrimSpace(repo) != "" {
+		validateURL(&errs, "repo", repo)
+	}
+
+	validateURLList(&errs, "photos", photos, MaxPhotos)
+	validateURLList(&errs, "videos", videos, MaxVideos)
+
+	if len(links) > MaxLinks {
+		errs.add("links", CodeTooMany, fmt.Sprintf("at most %d links allowed", MaxLinks))
+	}
+	seen := make(map[string]int)
+	for i, link := range links {
+		field := fmt.Sprintf("links[%d]", i)
+		validateText(&errs, field+".name", link.Name, MaxLinkNameLength, true)
+		if validateURL(&errs, field+".url", link.URL) {
+			key := normalizeURL(link.URL)
+			if first, ok := seen[key]; ok {
+				errs.add(field+".url", CodeDuplicate, fmt.Sprintf("duplicate of links[%d].url", first))
+			} else {
+				seen[key] = i
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateText(errs *ValidationErrors, field, value string, max int, required bool) {
+	if required && strings.TrimSpace(value) == "" {
+		errs.add(field, CodeRequired, "is required")
+		return
+	}
+	if utf8.RuneCountInString(value) > max {
+		errs.add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func validateURLList(errs *ValidationErrors, field string, values []string, max int) {
+	if len(values) > max {
+		errs.add(field, CodeTooMany, fmt.Sprintf("at most %d items allowed", max))
+	}
+
+	seen := make(map[string]int)
+	for i, value := range values {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if !validateURL(errs, itemField, value) {
+			continue
+		}
+
+		key := normalizeURL(value)
+		if first, ok := seen[key]; ok {
+			errs.add(itemField, CodeDuplicate, fmt.Sprintf("duplicate of %s[%d]", field, first))
+			continue
+		}
+		seen[key] = i
+	}
+}
+
+// Reports whether the value is an absolute http(s) URL
+func validateURL(errs *ValidationErrors, field, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		errs.add(field, CodeRequired, "is required")
+		return false
+	}
+	if len(value) > MaxURLLength {
+		errs.add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxURLLength))
+		return false
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		errs.add(field, CodeInvalidURL, "must be an absolute URL")
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		errs.add(field, CodeInvalidScheme, "must use http or https")
+		return false
+	}
+	return true
+}
+
+// Scheme and host are case-insensitive, paths are not
+func normalizeURL(value string) string {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return value
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	return u.String()
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateProject(t *testing.T) {
+	valid := func() CreateProjectRequest {
+		return CreateProjectRequest{
+			Name:   "Portfolio",
+			Desc:   "A site",
+			Repo:   "https://github.com/a/b",
+			Photos: []string{"https://example.com/a.png"},
+			Videos: []string{"http://example.com/a.mp4"},
+			Links:  []Link{{Name: "Docs", URL: "https://example.com/docs"}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(r *CreateProjectRequest)
+		want   []string
+	}{
+		{"valid", func(r *CreateProjectRequest) {}, nil},
+		{"no repo", func(r *CreateProjectRequest) { r.Repo = "  " }, nil},
+		{"blank name", func(r *CreateProjectRequest) { r.Name = " \t" }, []string{"name:required"}},
+		{"missing desc", func(r *CreateProjectRequest) { r.Desc = "" }, []string{"desc:required"}},
+		{"long name", func(r *CreateProjectRequest) { r.Name = strings.Repeat("a", MaxNameLength+1) }, []string{"name:too_long"}},
+		{"name counted in runes", func(r *CreateProjectRequest) { r.Name = strings.Repeat("é", MaxNameLength) }, nil},
+		{"relative repo", func(r *CreateProjectRequest) { r.Repo = "/a/b" }, []string{"repo:invalid_url"}},
+		{"ftp repo", func(r *CreateProjectRequest) { r.Repo = "ftp://example.com/a" }, []string{"repo:invalid_scheme"}},
+		{"long URL", func(r *CreateProjectRequest) {
+			r.Photos = []string{"https://example.com/" + strings.Repeat("a", MaxURLLength)}
+		}, []string{"photos[0]:too_long"}},
+		{"empty photo", func(r *CreateProjectRequest) { r.Photos = []string{""} }, []string{"photos[0]:required"}},
+		{"duplicate photo", func(r *CreateProjectRequest) {
+			r.Photos = []string{"https://example.com/a.png", "HTTPS://Example.com/a.png/"}
+		}, []string{"photos[1]:duplicate"}},
+		{"paths are case-sensitive", func(r *CreateProjectRequest) {
+			r.Photos = []string{"https://example.com/a.png", "https://example.com/A.png"}
+		}, nil},
+		{"too many videos", func(r *CreateProjectRequest) {
+			r.Videos = make([]string, MaxVideos+1)
+			for i := range r.Videos {
+				r.Videos[i] = "https://example.com/" + strings.Repeat("v", i+1)
+			}
+		}, []string{"videos:too_many"}},
+		{"link without name", func(r *CreateProjectRequest) { r.Links[0].Name = "" }, []string{"links[0].name:required"}},
+		{"duplicate link", func(r *CreateProjectRequest) {
+			r.Links = append(r.Links, Link{Name: "Again", URL: "https://EXAMPLE.com/docs"})
+		}, []string{"links[1].url:duplicate"}},
+		{"several at once", func(r *CreateProjectRequest) {
+			r.Name = ""
+			r.Links[0].URL = "mailto:a@example.com"
+		}, []string{"name:required", "links[0].url:invalid_url"}},
+	}
+
+	for _, tt := range tests {
+		req := valid()
+		tt.change(&req)
+
+		got := []string{}
+		for _, e := range req.Validate() {
+			got = append(got, e.Field+":"+e.Code)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+
+		// Updates follow the same rules
+		update := UpdateProjectRequest(req)
+		if len(update.Validate()) != len(got) {
+			t.Errorf("%s: update got %v", tt.name, update.Validate())
+		}
+	}
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	errs := ValidationErrors{}
+	errs.add("name", CodeRequired, "is required")
+	errs.add("repo", CodeInvalidURL, "must be an absolute URL")
+
+	if got, want := errs.Error(), "name: is required; repo: must be an absolute URL"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
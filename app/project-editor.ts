@@ -1,15 +1,19 @@
 import type { Project, CreateProjectRequest } from "./types.js";
-import { ProjectService } from "./project-service.js";
+import { ProjectService, ValidationError, ConflictError, UnauthorizedError } from "./project-service.js";
+import { AuthService } from "./auth-service.js";
 import { GetProjectHandler } from "./get-project-handler.js";
 import { Main } from "./server/main.js";
+import { handleMediaErrors } from "./media-fallback.js";
 
 export class ProjectEditor {
     private main: Main;
     private projectService: ProjectService;
+    private authService: AuthService;
     private projectHandler: GetProjectHandler;
     
     private currentProjects: Project[] = [];
     private editingProjectId: number | null = null;
+    private editingVersion: number | null = null;
 
     private el: HTMLSpanElement | null = null;
 
@@ -17,7 +21,9 @@ export class ProjectEditor {
         this.main = main;
 
         this.projectService = new ProjectService();
+        this.authService = new AuthService();
         this.projectHandler = new GetProjectHandler();
+        handleMediaErrors();
     }
 
     private setLink() {
@@ -59,6 +65,14 @@ export class ProjectEditor {
         /* On Project Updated */
         this.projectHandler.setOnProjectUpdated((data) => {
             console.log('Project updated', data);
+            if(
+                data.id === this.editingProjectId &&
+                this.editingVersion !== null &&
+                data.version > this.editingVersion
+            ) {
+                console.warn(`Project ${data.id} changed on the server while editing`);
+                this.markFormStale();
+            }
             this.loadProjects();
         });
         /* On Project Deleted */
@@ -66,6 +80,14 @@ export class ProjectEditor {
             console.log('Project deleted', data);
             this.loadProjects();
         });
+        /* On Bulk Changes */
+        this.projectHandler.setOnProjectsBulk((data) => {
+            console.log('Projects changed in bulk', data);
+            if(this.editingProjectId !== null && data.updated.includes(this.editingProjectId)) {
+                this.markFormStale();
+            }
+            this.loadProjects();
+        });
     }
 
     /**
@@ -126,7 +148,7 @@ export class ProjectEditor {
                             <img src="${this.escapeHtml(photo.url)}" 
                                 alt="Project photo" 
                                 loading="lazy"
-                                onerror="this.style.display='none'">
+                                data-fallback="hide">
                         </div>
                     `;
                 });
@@ -144,7 +166,7 @@ export class ProjectEditor {
                                     <img src="${thumbnailUrl}" 
                                         alt="Video thumbnail" 
                                         class="video-thumbnail"
-                                        onerror="this.src='https://img.youtube.com/vi/${id}/hqdefault.jpg'"
+                                        data-fallback-src="https://img.youtube.com/vi/${id}/hqdefault.jpg"
                                     >
                                     <div class="play-button-overlay">▶</div>
                                 </a>
@@ -293,11 +315,17 @@ export class ProjectEditor {
      */
     private async deleteProject(id: number): Promise<void> {
         try {
-            await this.projectService.deleteProject(id);
+            const project = this.currentProjects.find(p => p.id === id);
+            await this.projectService.deleteProject(id, project?.version);
             console.log('Project deleted!');
             await this.loadProjects();
         } catch(err) {
+            if(err instanceof UnauthorizedError) {
+                AuthService.redirectToLogin();
+                return;
+            }
             console.error('Failed to delete project!', err);
+            alert(err instanceof Error ? err.message : 'Failed to delete project');
         }
     }
 
@@ -314,6 +342,12 @@ export class ProjectEditor {
             this.showForm();
         });
 
+        // Logout Button
+        document.getElementById('logout-btn')?.addEventListener('click', async () => {
+            await this.authService.logout();
+            location.href = '/login';
+        });
+
         // Form Submit
         document.getElementById('edit-form')?.addEventListener('submit', (e) => {
             e.preventDefault();
@@ -358,10 +392,12 @@ export class ProjectEditor {
         if(project) {
             formTitle.textContent = 'Edit Project';
             this.editingProjectId = project.id;
+            this.editingVersion = project.version;
             this.populateForm(project);
         } else {
             formTitle.textContent = 'Create Project';
             this.editingProjectId = null;
+            this.editingVersion = null;
             this.resetForm();
         }
 
@@ -497,19 +533,24 @@ export class ProjectEditor {
         const desc = (document.getElementById('project-desc') as HTMLTextAreaElement).value;
         const repo = (document.getElementById('project-repo') as HTMLInputElement).value;
 
-        const photos = Array.from(document.querySelectorAll('.photo-input'))
-            .map(input => (input as HTMLInputElement).value)
-            .filter(val => val.trim() !== '');
+        const photoInputs = (Array.from(document.querySelectorAll('.photo-input')) as HTMLInputElement[])
+            .filter(input => input.value.trim() !== '');
+        const photos = photoInputs.map(input => input.value);
 
-        const videos = Array.from(document.querySelectorAll('.video-input'))
-            .map(input => (input as HTMLInputElement).value)
-            .filter(val => val.trim() !== '');
+        const videoInputs = (Array.from(document.querySelectorAll('.video-input')) as HTMLInputElement[])
+            .filter(input => input.value.trim() !== '');
+        const videos = videoInputs.map(input => input.value);
 
-        const linkGroups = Array.from(document.querySelectorAll('.link-input-group'));
+        const linkGroups = Array.from(document.querySelectorAll('.link-input-group'))
+            .filter(group => {
+                const linkName = (group.querySelector('.link-name') as HTMLInputElement).value;
+                const linkUrl = (group.querySelector('.link-url') as HTMLInputElement).value;
+                return linkName.trim() !== '' && linkUrl.trim() !== '';
+            });
         const links = linkGroups.map(group => ({
             name: (group.querySelector('.link-name') as HTMLInputElement).value,
             url: (group.querySelector('.link-url') as HTMLInputElement).value,
-        })).filter(link => link.name.trim() !== '' && link.url.trim() !== '');
+        }));
 
         const data: CreateProjectRequest = {
             name,
@@ -520,9 +561,15 @@ export class ProjectEditor {
             links,
         };
 
+        this.clearFieldErrors();
+
         try {
             if(this.editingProjectId) {
-                await this.projectService.updateProject(this.editingProjectId, data);
+                await this.projectService.updateProject(
+                    this.editingProjectId,
+                    data,
+                    this.editingVersion ?? undefined
+                );
                 console.log('Project updated successfully!');
             } else {
                 await this.projectService.createProject(data);
@@ -531,11 +578,82 @@ export class ProjectEditor {
             this.hideForm();
             await this.loadProjects();
         } catch (error) {
+            if(error instanceof UnauthorizedError) {
+                AuthService.redirectToLogin();
+                return;
+            }
+            if(error instanceof ValidationError) {
+                this.showFieldErrors(error, photoInputs, videoInputs, linkGroups);
+                return;
+            }
+            if(error instanceof ConflictError) {
+                alert('This project was changed by someone else. The form now shows the latest version.');
+                this.showForm(error.current);
+                return;
+            }
             console.error('Failed to save project:', error);
-            console.log('Failed to save project');
+            alert(error instanceof Error ? error.message : 'Failed to save project');
         }
     }
 
+    private markFormStale(): void {
+        const formTitle = document.getElementById('form-title');
+        if(formTitle) formTitle.textContent = 'Edit Project (changed on server)';
+    }
+
+    /**
+     * Field Errors
+     */
+    private showFieldErrors(
+        error: ValidationError,
+        photoInputs: HTMLInputElement[],
+        videoInputs: HTMLInputElement[],
+        linkGroups: Element[]
+    ): void {
+        error.fields.forEach(fieldError => {
+            const match = fieldError.field.match(/^(\w+)(?:\[(\d+)\])?(?:\.(\w+))?$/);
+            if(!match) return;
+
+            const [, field, index, subfield] = match;
+            const i = index !== undefined ? parseInt(index) : -1;
+
+            let el: Element | null | undefined = null;
+            switch(field) {
+                case 'name':
+                    el = document.getElementById('project-name');
+                    break;
+                case 'desc':
+                    el = document.getElementById('project-desc');
+                    break;
+                case 'repo':
+                    el = document.getElementById('project-repo');
+                    break;
+                case 'photos':
+                    el = i >= 0 ? photoInputs[i] : document.getElementById('photos-container');
+                    break;
+                case 'videos':
+                    el = i >= 0 ? videoInputs[i] : document.getElementById('videos-container');
+                    break;
+                case 'links':
+                    el = i >= 0 && subfield
+                        ? linkGroups[i]?.querySelector(`.link-${subfield}`)
+                        : document.getElementById('links-container');
+                    break;
+            }
+            if(!el) return;
+
+            el.classList.add('invalid');
+            el.setAttribute('title', fieldError.message);
+        });
+    }
+
+    private clearFieldErrors(): void {
+        document.querySelectorAll('#edit-form .invalid').forEach(el => {
+            el.classList.remove('invalid');
+            el.removeAttribute('title');
+        });
+    }
+
     private escapeHtml(text: string): string {
         const div = document.createElement('div');
         div.textContent = text;
@@ -1,5 +1,56 @@
-import type { Project, CreateProjectRequest } from "./types.js";
+import type { Project, ProjectSummary, CreateProjectRequest, ApiErrorResponse, FieldError, PatchOperation, BulkRequest, BulkResponse, GraphQLResponse } from "./types.js";
 import window from "./window.js";
+import { csrfHeader } from "./csrf.js";
+
+export class ApiError extends Error {
+    public status: number;
+    public code: string;
+    public details: any;
+    public requestId: string;
+
+    constructor(status: number, body: ApiErrorResponse) {
+        super(body.message);
+        this.status = status;
+        this.code = body.code;
+        this.details = body.details;
+        this.requestId = body.requestId;
+    }
+}
+
+export class UnauthorizedError extends ApiError {}
+
+export class ValidationError extends ApiError {
+    public fields: FieldError[];
+
+    constructor(status: number, body: ApiErrorResponse) {
+        super(status, body);
+        this.fields = Array.isArray(body.details) ? body.details : [];
+    }
+}
+
+export class ConflictError extends ApiError {
+    public current: Project;
+
+    constructor(status: number, body: ApiErrorResponse) {
+        super(status, body);
+        this.current = body.details;
+    }
+}
+
+const PROJECT_SUMMARIES = `
+    query ProjectSummaries($preview: Int!) {
+        projects {
+            id
+            name
+            desc
+            repo
+            mediaCount
+            photos: media(type: "photo", first: $preview) { id projectId type url }
+            videos: media(type: "video", first: $preview) { id projectId type url }
+            links { id projectId name url }
+        }
+    }
+`;
 
 export class ProjectService {
     private url: string | null = null;
@@ -12,68 +63,193 @@ export class ProjectService {
         this.url = window.vars.SERVER_URL;
     }
 
+    /**
+     * Static exports store responses as .json files
+     */
+    private ext(): string {
+        return window.vars.STATIC ? '.json' : '';
+    }
+
+    /**
+     * Summarize
+     * 
+     * What the summaries query selects, for exports without GraphQL
+     */
+    private summarize(project: Project, preview: number): ProjectSummary {
+        return {
+            id: project.id,
+            name: project.name,
+            desc: project.desc,
+            repo: project.repo,
+            mediaCount: project.media.length,
+            photos: project.media.filter(m => m.type === 'photo').slice(0, preview),
+            videos: project.media.filter(m => m.type === 'video').slice(0, preview),
+            links: project.links
+        };
+    }
+
+    /**
+     * If-Match
+     */
+    private ifMatch(id: number, version?: number): Record<string, string> {
+        if(version === undefined) return {};
+        return { 'If-Match': `"p${id}-v${version}"` };
+    }
+
+    /**
+     * Handle Response
+     */
+    public async handle<T>(res: Response, fallback: string): Promise<T> {
+        if(res.ok) return res.json();
+
+        let body: ApiErrorResponse;
+        try {
+            body = await res.json();
+        } catch {
+            body = {
+                code: 'unknown_error',
+                message: `${fallback} (${res.status})`,
+                requestId: res.headers.get('X-Request-Id') || ''
+            };
+        }
+        if(!body.message) body.message = fallback;
+
+        if(body.code === 'unauthorized') throw new UnauthorizedError(res.status, body);
+        if(body.code === 'validation_failed') throw new ValidationError(res.status, body);
+        if(body.code === 'precondition_failed') throw new ConflictError(res.status, body);
+        throw new ApiError(res.status, body);
+    }
+
     /**
      * Get All Projects
      */
     public async getAllProjects(): Promise<Project[]> {
-        const res = await fetch(`${this.url}/api/projects`);
-        if(!res.ok) throw new Error('Failed to fetch projects');
-        return res.json();
+        const res = await fetch(`${this.url}/api/v1/projects${this.ext()}`);
+        return this.handle(res, 'Failed to fetch projects');
+    }
+
+    /**
+     * GraphQL
+     */
+    public async query<T>(query: string, variables: Record<string, any> = {}): Promise<T> {
+        const res = await fetch(`${this.url}/api/graphql`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ query, variables })
+        });
+        const body: GraphQLResponse<T> = await this.handle(res, 'GraphQL request failed');
+        if(body.errors?.length || !body.data) {
+            throw new Error(body.errors?.map(e => e.message).join('; ') || 'GraphQL request failed');
+        }
+        return body.data;
+    }
+
+    /**
+     * Get Project Summaries
+     */
+    public async getProjectSummaries(preview: number): Promise<ProjectSummary[]> {
+        if(window.vars.STATIC) {
+            const projects = await this.getAllProjects();
+            return projects.map(p => this.summarize(p, preview));
+        }
+        const data = await this.query<{ projects: ProjectSummary[] }>(PROJECT_SUMMARIES, { preview });
+        return data.projects;
     }
 
     /**
      * Get Project
      */
     public async getProject(id: number): Promise<Project> {
-        const res = await fetch(`${this.url}/api/projects/${id}`);
-        if(!res.ok) throw new Error('Failed to fetch projects');
-        return res.json();
+        const res = await fetch(`${this.url}/api/v1/projects/${id}${this.ext()}`);
+        return this.handle(res, 'Failed to fetch project');
     }
 
     /**
      * Create Project
      */
     public async createProject(data: CreateProjectRequest): Promise<{ id: number; message: string }> {
-        const res = await fetch(`${this.url}/api/projects`, {
+        const res = await fetch(`${this.url}/api/v1/projects`, {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                ...csrfHeader()
             },
             body: JSON.stringify(data)
         });
-        if(!res.ok) {
-            throw new Error('Failed to create project');
-        }
-        return res.json();
+        return this.handle(res, 'Failed to create project');
     }
 
     /**
      * Update Project
      */
-    public async updateProject(id: number, data: CreateProjectRequest): Promise<{ message: string }> {
-        const res = await fetch(`${this.url}/api/projects/${id}`, {
+    public async updateProject(id: number, data: CreateProjectRequest, version?: number): Promise<{ message: string; version: number }> {
+        const res = await fetch(`${this.url}/api/v1/projects/${id}`, {
             method: 'PUT',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                ...this.ifMatch(id, version),
+                ...csrfHeader()
             },
             body: JSON.stringify(data)
         });
-        if(!res.ok) {
-            throw new Error('Failed to update project');
-        }
-        return res.json();
+        return this.handle(res, 'Failed to update project');
+    }
+
+    /**
+     * Patch Project
+     */
+    public async patchProject(id: number, patch: Partial<CreateProjectRequest>, version?: number): Promise<Project> {
+        const res = await fetch(`${this.url}/api/v1/projects/${id}`, {
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/merge-patch+json',
+                ...this.ifMatch(id, version),
+                ...csrfHeader()
+            },
+            body: JSON.stringify(patch)
+        });
+        return this.handle(res, 'Failed to update project');
+    }
+
+    /**
+     * Patch Project Operations
+     */
+    public async patchProjectOps(id: number, ops: PatchOperation[], version?: number): Promise<Project> {
+        const res = await fetch(`${this.url}/api/v1/projects/${id}`, {
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/json-patch+json',
+                ...this.ifMatch(id, version),
+                ...csrfHeader()
+            },
+            body: JSON.stringify(ops)
+        });
+        return this.handle(res, 'Failed to update project');
+    }
+
+    /**
+     * Bulk
+     */
+    public async bulk(request: BulkRequest): Promise<BulkResponse> {
+        const res = await fetch(`${this.url}/api/v1/projects/bulk`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                ...csrfHeader()
+            },
+            body: JSON.stringify(request)
+        });
+        return this.handle(res, 'Failed to run bulk operations');
     }
 
     /**
      * Delete Project
      */
-    public async deleteProject(id: number): Promise<{ message: string }> {
-        const res = await fetch(`${this.url}/api/projects/${id}`, {
-            method: 'DELETE'
+    public async deleteProject(id: number, version?: number): Promise<{ message: string }> {
+        const res = await fetch(`${this.url}/api/v1/projects/${id}`, {
+            method: 'DELETE',
+            headers: { ...this.ifMatch(id, version), ...csrfHeader() }
         });
-        if(!res.ok) {
-            throw new Error('Failed to delete project');
-        }
-        return res.json();
+        return this.handle(res, 'Failed to delete project');
     }
-}
\ No newline at end of file
+}
@@ -13,6 +13,14 @@ type Client struct {
 	Conn     *websocket.Conn
 	Send     chan message.Message
 	Channels map[string]bool
+	// Connected with an admin session. The connection is closed
+	// when that session ends.
+	Admin bool
+}
+
+// Channels only admin clients may subscribe to
+var AdminChannels = map[string]bool{
+	"audit": true,
 }
 
 // Generate Client Id
@@ -57,6 +65,14 @@ func (s *Server) HandleClientMessage(client *Client, rawMessage []byte) {
 			}
 			return
 		}
+		if AdminChannels[msg.Channel] && !client.Admin {
+			client.Send <- message.Message{
+				Type:    "error",
+				Error:   "Channel requires an admin session",
+				Channel: msg.Channel,
+			}
+			return
+		}
 
 		s.Subscribe <- message.Subscription{
 			ClientId: client.Id,
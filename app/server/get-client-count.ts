@@ -19,7 +19,7 @@ export class GetClientCount {
     public async connect(): Promise<void> {
         if(!this.el) return;
         
-        const url = '/count';
+        const url = '/api/v1/count';
     
         this.main.protocol(url);
     
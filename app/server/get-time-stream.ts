@@ -16,7 +16,7 @@ export class GetTimeStream {
     public async connect(): Promise<void> {
         if(!this.el) return;
         
-        const url = '/time-stream';
+        const url = '/api/v1/time-stream';
 
         this.main.protocol(url);
 
@@ -0,0 +1,52 @@
+import { AuthService } from "../auth-service.js";
+import { ApiError } from "../project-service.js";
+
+class LoginPage {
+    private authService = new AuthService();
+
+    constructor() {
+        document.getElementById('login-form')?.addEventListener('submit', (e) => {
+            e.preventDefault();
+            this.submit();
+        });
+    }
+
+    /**
+     * Only same-site paths, so the form
+     * cannot be used to bounce users elsewhere
+     */
+    private next(): string {
+        const next = new URLSearchParams(location.search).get('next') || '/editor';
+        if(!next.startsWith('/') || next.startsWith('//')) return '/editor';
+        return next;
+    }
+
+    /**
+     * Submit
+     */
+    private async submit(): Promise<void> {
+        const username = (document.getElementById('login-username') as HTMLInputElement).value;
+        const password = (document.getElementById('login-password') as HTMLInputElement).value;
+        const button = document.getElementById('login-btn') as HTMLButtonElement;
+
+        button.disabled = true;
+        this.showError('');
+        try {
+            await this.authService.login({ username, password });
+            location.href = this.next();
+        } catch(err) {
+            this.showError(err instanceof ApiError ? err.message : 'Failed to sign in');
+        } finally {
+            button.disabled = false;
+        }
+    }
+
+    private showError(message: string): void {
+        const el = document.getElementById('login-error');
+        if(!el) return;
+        el.textContent = message;
+        el.classList.toggle('hidden', !message);
+    }
+}
+
+new LoginPage();
@@ -0,0 +1,341 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Cache-Control for content-hashed URLs, whose content never changes
+const Immutable = "public, max-age=31536000, immutable"
+
+// Smaller files are not worth a compressed copy
+const minCompressSize = 256
+
+// Manifest maps asset URLs such as /styles/client.css to content-hashed
+// ones such as /styles/client.1a2b3c4d5e.css
+type Manifest struct {
+	mu   sync.RWMutex
+	urls map[string]string
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{urls: map[string]string{}}
+}
+
+func (m *Manifest) add(url, hashed string) {
+	m.mu.Lock()
+	m.urls[url] = hashed
+	m.mu.Unlock()
+}
+
+// URL returns the hashed URL for url, url itself when it is unknown
+func (m *Manifest) URL(url string) string {
+	if m == nil {
+		return url
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if hashed, ok := m.urls[url]; ok {
+		return hashed
+	}
+	return url
+}
+
+func (m *Manifest) Entries() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]string, len(m.urls))
+	for url, hashed := range m.urls {
+		out[url] = hashed
+	}
+	return out
+}
+
+// Version changes whenever any asset does, for the validators of pages
+// that link to them
+func (m *Manifest) Version() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	urls := make([]string, 0, len(m.urls))
+	for url := range m.urls {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	sum := sha256.New()
+	for _, url := range urls {
+		sum.Write([]byte(m.urls[url] + "\n"))
+	}
+	return hex.EncodeToString(sum.Sum(nil)[:4])
+}
+
+var assetRef = regexp.MustCompile(`(?:src|href)="(/[^"?#]+)`)
+
+// Rewrite points src and href attributes in html at hashed URLs
+func (m *Manifest) Rewrite(html []byte) []byte {
+	if m == nil {
+		return html
+	}
+	return assetRef.ReplaceAllFunc(html, func(match []byte) []byte {
+		attr, url, _ := bytes.Cut(match, []byte(`="`))
+		hashed := m.URL(string(url))
+		if hashed == string(url) {
+			return match
+		}
+		return []byte(string(attr) + `="` + hashed)
+	})
+}
+
+// A fingerprinted file and its precompressed copies
+type asset struct {
+	name     string
+	hash     string
+	variants map[string][]byte
+	// Set for a module whose imports were rewritten to hashed URLs.
+	// Only the hashed URL serves it, the plain one serves the file.
+	content []byte
+}
+
+// Encodings in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Relative specifiers of static imports and exports and of import()
+var moduleImport = regexp.MustCompile(`(\b(?:import|export)\b[^;"'` + "`" + `]*?\bfrom\s*|\bimport\s*\(?\s*)(["'])(\.\.?/[^"'\n]+)(["'])`)
+
+func isModule(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".js" || ext == ".mjs"
+}
+
+// FS names of the fingerprinted modules that module imports
+func moduleDeps(name string, content []byte, assets map[string]*asset) []string {
+	deps := []string{}
+	for _, match := range moduleImport.FindAllSubmatch(content, -1) {
+		dep := path.Join(path.Dir(name), string(match[3]))
+		if _, ok := assets[dep]; ok {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// Fingerprint hashes every file the server would serve and adds it to m
+// under prefix. Hashed URLs are then served with immutable caching, and
+// compressible files get a gzip copy unless the FS already has a .gz
+// next to them. Brotli is only served from .br files, there is no
+// encoder in the standard library.
+//
+// A hashed module imports the hashed URLs of its dependencies, so its
+// hash covers every module it reaches. Otherwise an immutable module
+// would load whatever version of them the plain URL serves.
+func (s *Server) Fingerprint(prefix string, m *Manifest) error {
+	assets := map[string]*asset{}
+	contents := map[string][]byte{}
+
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if _, err := Clean(name); err != nil || s.excluded(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || isVariant(name) {
+			return nil
+		}
+
+		// Such as a link out of the root, which would not be served either
+		content, err := fs.ReadFile(s.fsys, name)
+		if err != nil {
+			log.Printf("Not fingerprinting %s: %v", name, err)
+			return nil
+		}
+		sum := sha256.Sum256(content)
+		assets[name] = &asset{
+			name:     name,
+			hash:     hex.EncodeToString(sum[:5]),
+			variants: map[string][]byte{},
+		}
+		contents[name] = content
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	deps := map[string][]string{}
+	for name, content := range contents {
+		if isModule(name) {
+			if d := moduleDeps(name, content, assets); len(d) > 0 {
+				deps[name] = d
+			}
+		}
+	}
+	// Computed from the file hashes alone, so import cycles are fine
+	hashes := map[string]string{}
+	for name := range deps {
+		hashes[name] = closureHash(name, assets, deps)
+	}
+	for name, hash := range hashes {
+		assets[name].hash = hash
+	}
+
+	hashedName := func(name string) string {
+		ext := path.Ext(name)
+		return strings.TrimSuffix(name, ext) + "." + assets[name].hash + ext
+	}
+
+	hashed := map[string]*asset{}
+	for name, a := range assets {
+		content := contents[name]
+		if _, ok := deps[name]; ok {
+			content = moduleImport.ReplaceAllFunc(content, func(match []byte) []byte {
+				parts := moduleImport.FindSubmatch(match)
+				spec := string(parts[3])
+				dep := path.Join(path.Dir(name), spec)
+				if _, ok := assets[dep]; !ok {
+					return match
+				}
+				spec = strings.TrimSuffix(spec, path.Base(spec)) + path.Base(hashedName(dep))
+				return []byte(string(parts[1]) + string(parts[2]) + spec + string(parts[4]))
+			})
+			a.content = content
+		} else {
+			for _, enc := range encodings {
+				if variant, err := fs.ReadFile(s.fsys, name+enc.ext); err == nil {
+					a.variants[enc.name] = variant
+				}
+			}
+		}
+		if _, ok := a.variants["gzip"]; !ok && compressible(name, content) {
+			if gz := gzipBytes(content); len(gz) < len(content) {
+				a.variants["gzip"] = gz
+			}
+		}
+
+		hashed[hashedName(name)] = a
+		m.add(prefix+name, prefix+hashedName(name))
+	}
+
+	s.mu.Lock()
+	s.assets, s.hashed = assets, hashed
+	s.mu.Unlock()
+	return nil
+}
+
+// Hash of name and every module it reaches through imports
+func closureHash(name string, assets map[string]*asset, deps map[string][]string) string {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for i := 0; i < len(queue); i++ {
+		for _, dep := range deps[queue[i]] {
+			if !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	sort.Strings(queue[1:])
+
+	sum := sha256.New()
+	for _, reached := range queue {
+		sum.Write([]byte(reached + " " + assets[reached].hash + "\n"))
+	}
+	return hex.EncodeToString(sum.Sum(nil)[:5])
+}
+
+// x.js.gz belongs to x.js, it is not an asset of its own
+func isVariant(name string) bool {
+	for _, enc := range encodings {
+		if strings.HasSuffix(name, enc.ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func compressible(name string, content []byte) bool {
+	if len(content) < minCompressSize {
+		return false
+	}
+	return Compressible(ContentType(name, bytes.NewReader(content)))
+}
+
+// Compressible reports whether content of this type shrinks when
+// compressed, unlike images, video or archives
+func Compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	ct = strings.TrimSpace(strings.ToLower(ct))
+	switch {
+	case strings.HasPrefix(ct, "text/"):
+		return true
+	case strings.HasSuffix(ct, "+json"), strings.HasSuffix(ct, "+xml"):
+		return true
+	}
+	switch ct {
+	case "application/json", "application/javascript", "application/xml",
+		"image/svg+xml", "application/wasm", "image/x-icon":
+		return true
+	}
+	return false
+}
+
+func gzipBytes(content []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(content)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// AcceptsEncoding reports whether an Accept-Encoding header allows
+// coding, by name or through *
+func AcceptsEncoding(header, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if name == coding {
+			return accepted
+		}
+		wildcard = accepted
+	}
+	return wildcard
+}
@@ -0,0 +1,217 @@
+package static
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFingerprintModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.js":        {Data: []byte(`import { a } from "./a.js";` + "\n" + `import("./lazy/b.js");`)},
+		"a.js":           {Data: []byte(`import "./cycle.js"; export const a = 1;`)},
+		"cycle.js":       {Data: []byte(`export * from "./a.js";`)},
+		"lazy/b.js":      {Data: []byte(`export const b = "` + strings.Repeat("b", 300) + `";`)},
+		"plain.js":       {Data: []byte(`const s = "./a.js";`)},
+		"style.css":      {Data: []byte("body{}")},
+		".hidden/x.js":   {Data: []byte("x")},
+		"missing.js":     {Data: []byte(`import "./gone.js";`)},
+		"nested/c.js":    {Data: []byte(`import { a } from "../a.js"; // ` + strings.Repeat("c", 300))},
+		"nested/c.js.gz": {Data: []byte("stale")},
+	}
+	s := New("scripts", fsys, Options{CacheControl: "no-cache"})
+	m := NewManifest()
+	if err := s.Fingerprint("/scripts/", m); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(url string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.Handler("/scripts/")(w, r)
+		return w
+	}
+	hashed := func(name string) string {
+		url := m.URL("/scripts/" + name)
+		if url == "/scripts/"+name {
+			t.Fatalf("%s is not in the manifest", name)
+		}
+		return url
+	}
+	base := func(url string) string {
+		return url[strings.LastIndex(url, "/")+1:]
+	}
+
+	main := get(hashed("main.js"))
+	if main.Code != http.StatusOK || main.Header().Get("Cache-Control") != Immutable {
+		t.Fatalf("got %d with %q", main.Code, main.Header().Get("Cache-Control"))
+	}
+	body := main.Body.String()
+	for _, want := range []string{
+		`from "./` + base(hashed("a.js")) + `"`,
+		`import("./lazy/` + base(hashed("lazy/b.js")) + `")`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("main.js: %q does not contain %q", body, want)
+		}
+	}
+	if c := get(hashed("nested/c.js")).Body.String(); !strings.Contains(c, `"../`+base(hashed("a.js"))+`"`) {
+		t.Errorf("nested/c.js: got %q", c)
+	}
+
+	// Imports stay plain under the plain URL, which revalidates
+	plain := get("/scripts/main.js")
+	if !strings.Contains(plain.Body.String(), `"./a.js"`) || plain.Header().Get("ETag") != "" {
+		t.Errorf("plain main.js: got %q with ETag %q", plain.Body.String(), plain.Header().Get("ETag"))
+	}
+	if body := get(hashed("plain.js")).Body.String(); body != `const s = "./a.js";` {
+		t.Errorf("plain.js: got %q", body)
+	}
+	if body := get(hashed("missing.js")).Body.String(); body != `import "./gone.js";` {
+		t.Errorf("missing.js: got %q", body)
+	}
+
+	// A rewritten module is compressed from its rewritten content
+	gz := get(hashed("nested/c.js"), "Accept-Encoding", "gzip")
+	if gz.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("nested/c.js: got Content-Encoding %q, want gzip", gz.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unzipped, _ := io.ReadAll(zr); !strings.Contains(string(unzipped), base(hashed("a.js"))) {
+		t.Errorf("nested/c.js: got %q", unzipped)
+	}
+
+	// Only gzip is offered, there is no brotli encoder
+	br := get(hashed("lazy/b.js"), "Accept-Encoding", "br, gzip")
+	if br.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("lazy/b.js: got Content-Encoding %q, want gzip", br.Header().Get("Content-Encoding"))
+	}
+	if _, ok := m.Entries()["/scripts/.hidden/x.js"]; ok {
+		t.Error(".hidden/x.js is in the manifest")
+	}
+}
+
+// A module's URL changes when anything it imports does, cycles included
+func TestFingerprintHashCoversImports(t *testing.T) {
+	urls := func(cycle string) map[string]string {
+		fsys := fstest.MapFS{
+			"main.js":  {Data: []byte(`import "./a.js";`)},
+			"a.js":     {Data: []byte(`import "./cycle.js";`)},
+			"cycle.js": {Data: []byte(`import "./a.js"; ` + cycle)},
+			"other.js": {Data: []byte(`export {};`)},
+		}
+		m := NewManifest()
+		if err := New("scripts", fsys, Options{}).Fingerprint("/", m); err != nil {
+			t.Fatal(err)
+		}
+		return m.Entries()
+	}
+
+	before, after := urls("// one"), urls("// two")
+	for _, name := range []string{"/main.js", "/a.js", "/cycle.js"} {
+		if before[name] == after[name] {
+			t.Errorf("%s kept %s", name, before[name])
+		}
+	}
+	if before["/other.js"] != after["/other.js"] {
+		t.Errorf("/other.js changed from %s to %s", before["/other.js"], after["/other.js"])
+	}
+}
+
+func TestManifestRewrite(t *testing.T) {
+	m := NewManifest()
+	m.add("/scripts/main.js", "/scripts/main.1a2b3c4d5e.js")
+	m.add("/styles/site.css", "/styles/site.5e4d3c2b1a.css")
+
+	html := `<link href="/styles/site.css?v=1"><script src="/scripts/main.js"></script>` +
+		`<a href="/projects/1">x</a><img src="https://cdn.example.com/scripts/main.js"><p>/scripts/main.js</p>`
+	want := `<link href="/styles/site.5e4d3c2b1a.css?v=1"><script src="/scripts/main.1a2b3c4d5e.js"></script>` +
+		`<a href="/projects/1">x</a><img src="https://cdn.example.com/scripts/main.js"><p>/scripts/main.js</p>`
+	if got := string(m.Rewrite([]byte(html))); got != want {
+		t.Errorf("got %s", got)
+	}
+
+	var none *Manifest
+	if string(none.Rewrite([]byte(html))) != html || none.URL("/a.js") != "/a.js" || none.Version() != "" {
+		t.Error("nil manifest changed something")
+	}
+}
+
+func TestManifestVersion(t *testing.T) {
+	a, b := NewManifest(), NewManifest()
+	a.add("/a.js", "/a.1.js")
+	a.add("/b.js", "/b.1.js")
+	b.add("/b.js", "/b.1.js")
+	b.add("/a.js", "/a.1.js")
+	if a.Version() != b.Version() || len(a.Version()) != 8 {
+		t.Errorf("got %s and %s", a.Version(), b.Version())
+	}
+
+	b.add("/b.js", "/b.2.js")
+	if a.Version() == b.Version() {
+		t.Error("version did not change with an asset")
+	}
+
+	entries := a.Entries()
+	entries["/a.js"] = "changed"
+	if a.URL("/a.js") != "/a.1.js" {
+		t.Error("entries share the manifest's map")
+	}
+}
+
+// Precompressed .br files are served as they are, and are not assets
+// of their own
+func TestFingerprintBrotli(t *testing.T) {
+	css := "body { color: red; }" + strings.Repeat(" ", 300)
+	fsys := fstest.MapFS{
+		"site.css":    {Data: []byte(css)},
+		"site.css.br": {Data: []byte("brotli bytes")},
+	}
+	s := New("styles", fsys, Options{})
+	m := NewManifest()
+	if err := s.Fingerprint("/styles/", m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Entries()["/styles/site.css.br"]; ok {
+		t.Error("site.css.br was fingerprinted")
+	}
+
+	tests := []struct {
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"gzip, br", "br", "brotli bytes"},
+		{"br;q=0, gzip", "gzip", ""},
+		{"", "", css},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, m.URL("/styles/site.css"), nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept-Encoding", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		s.Handler("/styles/")(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%q: got encoding %q, want %q", tt.accept, got, tt.encoding)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%q: got %q", tt.accept, w.Body.String())
+		}
+		if tt.encoding != "" && !strings.HasSuffix(w.Header().Get("ETag"), "-"+tt.encoding+`"`) {
+			t.Errorf("%q: got ETag %s", tt.accept, w.Header().Get("ETag"))
+		}
+	}
+}
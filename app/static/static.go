@@ -0,0 +1,290 @@
+package static
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidPath = errors.New("invalid static path")
+
+// Types that must not depend on the host's mime database
+var contentTypes = map[string]string{
+	".html":        "text/html; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".map":         "application/json",
+	".json":        "application/json",
+	".svg":         "image/svg+xml",
+	".ico":         "image/x-icon",
+	".webmanifest": "application/manifest+json",
+	".wasm":        "application/wasm",
+	".txt":         "text/plain; charset=utf-8",
+	".xml":         "application/xml",
+}
+
+type Options struct {
+	// Served for a directory, "index.html" when empty
+	Index string
+	// Page in the FS served with a 404, plain text when missing
+	NotFoundPage string
+	// Called when there is no 404 page
+	NotFound http.HandlerFunc
+	// path.Match patterns, against the base name, that are never served
+	Exclude      []string
+	CacheControl string
+}
+
+// Server serves files from an fs.FS. Paths are cleaned before they
+// reach the FS, and anything hidden or outside it is a 404.
+type Server struct {
+	Name string
+	fsys fs.FS
+	opts Options
+
+	// Set by Fingerprint, by FS name and by hashed name
+	mu     sync.RWMutex
+	assets map[string]*asset
+	hashed map[string]*asset
+}
+
+func New(name string, fsys fs.FS, opts Options) *Server {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	return &Server{Name: name, fsys: fsys, opts: opts}
+}
+
+func (s *Server) FS() fs.FS {
+	return s.fsys
+}
+
+// Dir roots an FS at dir on disk. Unlike os.DirFS, symlinks cannot lead
+// outside of it.
+func Dir(dir string) fs.FS {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		log.Printf("Static directory %s: %v", dir, err)
+		return emptyFS{}
+	}
+	return root.FS()
+}
+
+// Clean turns a URL path into an FS name. Any segment starting with a
+// dot is refused, which covers traversal as well as dotfiles such as
+// .env or .git.
+func Clean(urlPath string) (string, error) {
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", ErrInvalidPath
+	}
+
+	name := strings.Trim(urlPath, "/")
+	if name == "" {
+		return ".", nil
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", ErrInvalidPath
+		}
+	}
+	if !fs.ValidPath(name) {
+		return "", ErrInvalidPath
+	}
+	return name, nil
+}
+
+// ContentType by extension, sniffing the content when it is unknown
+func ContentType(name string, content io.ReadSeeker) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+
+	var buf [512]byte
+	n, _ := io.ReadFull(content, buf[:])
+	content.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+// Serve the file at urlPath, relative to the FS root
+func (s *Server) Serve(w http.ResponseWriter, r *http.Request, urlPath string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := Clean(urlPath)
+	if err != nil || s.excluded(name) {
+		s.notFound(w, r)
+		return
+	}
+
+	cacheControl := s.opts.CacheControl
+	s.mu.RLock()
+	a, hashed := s.hashed[name]
+	s.mu.RUnlock()
+	if hashed {
+		name, cacheControl = a.name, Immutable
+	}
+
+	file, info, err := s.open(name)
+	if err == nil && info.IsDir() {
+		file.Close()
+		name = path.Join(name, s.opts.Index)
+		file, info, err = s.open(name)
+	}
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	defer file.Close()
+	if info.IsDir() {
+		s.notFound(w, r)
+		return
+	}
+
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	s.serveFile(w, r, name, file, info, http.StatusOK, hashed)
+}
+
+func (s *Server) open(name string) (fs.File, fs.FileInfo, error) {
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+func (s *Server) excluded(name string) bool {
+	base := path.Base(name)
+	for _, pattern := range s.opts.Exclude {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Seekable files get ranges and conditional requests from
+// http.ServeContent, anything else is copied as is
+func (s *Server) serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	file fs.File,
+	info fs.FileInfo,
+	status int,
+	hashed bool,
+) {
+	h := w.Header()
+	if h.Get("Cache-Control") == "" && s.opts.CacheControl != "" {
+		h.Set("Cache-Control", s.opts.CacheControl)
+	}
+
+	content, seekable := file.(io.ReadSeeker)
+	if seekable {
+		h.Set("Content-Type", ContentType(name, content))
+	} else if ct, ok := contentTypes[strings.ToLower(path.Ext(name))]; ok {
+		h.Set("Content-Type", ct)
+	}
+
+	if status == http.StatusOK && s.serveAsset(w, r, name, info, hashed) {
+		return
+	}
+	if status != http.StatusOK || !seekable {
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			io.Copy(w, file)
+		}
+		return
+	}
+
+	// Embedded files have a zero time, which ServeContent leaves out
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// Fingerprinted files revalidate by hash and come precompressed when the
+// client takes it. Ranges then apply to the compressed bytes. A module
+// with rewritten imports is only itself under its hashed URL.
+func (s *Server) serveAsset(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo, hashed bool) bool {
+	s.mu.RLock()
+	a, ok := s.assets[name]
+	s.mu.RUnlock()
+	if !ok || (a.content != nil && !hashed) {
+		return false
+	}
+
+	h := w.Header()
+	h.Set("ETag", `"`+a.hash+`"`)
+	if len(a.variants) == 0 && a.content == nil {
+		return false
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+	for _, enc := range encodings {
+		variant, ok := a.variants[enc.name]
+		if !ok || !AcceptsEncoding(r.Header.Get("Accept-Encoding"), enc.name) {
+			continue
+		}
+		h.Set("Content-Encoding", enc.name)
+		h.Set("ETag", `"`+a.hash+"-"+enc.name+`"`)
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(variant))
+		return true
+	}
+	if a.content != nil {
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(a.content))
+		return true
+	}
+	return false
+}
+
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	if s.opts.NotFoundPage != "" {
+		if file, info, err := s.open(s.opts.NotFoundPage); err == nil {
+			defer file.Close()
+			if !info.IsDir() {
+				s.serveFile(w, r, s.opts.NotFoundPage, file, info, http.StatusNotFound, false)
+				return
+			}
+		}
+	}
+	if s.opts.NotFound != nil {
+		s.opts.NotFound(w, r)
+		return
+	}
+	http.Error(w, "404 page not found", http.StatusNotFound)
+}
+
+// Stands in for a directory that could not be opened
+type emptyFS struct{}
+
+func (emptyFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Handler serves the FS under a URL prefix such as /scripts/
+func (s *Server) Handler(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Serve(w, r, strings.TrimPrefix(r.URL.Path, prefix))
+	}
+}
@@ -0,0 +1,217 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"", ".", true},
+		{"/", ".", true},
+		{"/main.js", "main.js", true},
+		{"lib/util.js/", "lib/util.js", true},
+		{"/a..b.js", "a..b.js", true},
+		{"/../secret", "", false},
+		{"/lib/../../secret", "", false},
+		{"/.env", "", false},
+		{"/.git/config", "", false},
+		{"/lib/.hidden.js", "", false},
+		{"/lib//util.js", "", false},
+		{"/lib/./util.js", "", false},
+		{"/lib\\util.js", "", false},
+		{"/main.js\x00.png", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := Clean(tt.path)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"main.js", "", "text/javascript; charset=utf-8"},
+		{"MAIN.MJS", "", "text/javascript; charset=utf-8"},
+		{"site.webmanifest", "", "application/manifest+json"},
+		{"photo.png", "", "image/png"},
+		{"notes", "plain words", "text/plain; charset=utf-8"},
+		{"page", "<!DOCTYPE html><p>", "text/html; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		content := strings.NewReader(tt.content)
+		if got := ContentType(tt.name, content); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if content.Len() != len(tt.content) {
+			t.Errorf("%s: content was not rewound", tt.name)
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		ok          bool
+	}{
+		{"text/css; charset=utf-8", true},
+		{"Application/JSON", true},
+		{"application/ld+json", true},
+		{"application/atom+xml", true},
+		{"image/svg+xml", true},
+		{"application/wasm", true},
+		{"image/png", false},
+		{"video/mp4", false},
+		{"application/zip", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Compressible(tt.contentType); got != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.contentType, got, tt.ok)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"gzip", true},
+		{"deflate, GZIP", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=0", false},
+		{"gzip;q=0.0, *", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*;q=0, gzip", true},
+		{"br, deflate", false},
+		{"gzip;q=x", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := AcceptsEncoding(tt.header, "gzip"); got != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.header, got, tt.ok)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<p>home</p>")},
+		"docs/index.html": {Data: []byte("<p>docs</p>")},
+		"empty/x.txt":     {Data: []byte("x")},
+		"main.js":         {Data: []byte("console.log(1)")},
+		"main.js.map":     {Data: []byte("{}")},
+		"404.html":        {Data: []byte("<p>missing</p>")},
+		".env":            {Data: []byte("SECRET=1")},
+	}
+	s := New("site", fsys, Options{NotFoundPage: "404.html", Exclude: []string{"*.map"}, CacheControl: "no-cache"})
+
+	tests := []struct {
+		method string
+		path   string
+		header string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/", "", http.StatusOK, "<p>home</p>"},
+		{http.MethodGet, "/docs/", "", http.StatusOK, "<p>docs</p>"},
+		{http.MethodGet, "/main.js", "", http.StatusOK, "console.log(1)"},
+		{http.MethodGet, "/main.js", "bytes=0-6", http.StatusPartialContent, "console"},
+		{http.MethodHead, "/main.js", "", http.StatusOK, ""},
+		{http.MethodGet, "/empty", "", http.StatusNotFound, "<p>missing</p>"},
+		{http.MethodGet, "/main.js.map", "", http.StatusNotFound, "<p>missing</p>"},
+		{http.MethodGet, "/.env", "", http.StatusNotFound, "<p>missing</p>"},
+		{http.MethodGet, "/../index.html", "", http.StatusNotFound, "<p>missing</p>"},
+		{http.MethodPost, "/main.js", "", http.StatusMethodNotAllowed, "405 method not allowed\n"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Range", tt.header)
+		}
+		w := httptest.NewRecorder()
+		s.Serve(w, r, tt.path)
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if w.Code == http.StatusOK && w.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s %s: got Cache-Control %q", tt.method, tt.path, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/main.js", nil)
+	w := httptest.NewRecorder()
+	s.Serve(w, r, "/main.js")
+	if got := w.Header().Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	called := false
+	s := New("site", fstest.MapFS{}, Options{
+		NotFoundPage: "404.html",
+		NotFound:     func(w http.ResponseWriter, r *http.Request) { called = true },
+	})
+	s.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "/missing")
+	if !called {
+		t.Error("NotFound was not called without a 404 page")
+	}
+
+	w := httptest.NewRecorder()
+	New("site", fstest.MapFS{}, Options{}).Serve(w, httptest.NewRequest(http.MethodGet, "/", nil), "/missing")
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDir(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Skip(err)
+	}
+
+	s := New("site", Dir(root), Options{})
+	for path, status := range map[string]int{"/a.txt": http.StatusOK, "/link.txt": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		s.Serve(w, httptest.NewRequest(http.MethodGet, "/", nil), path)
+		if w.Code != status {
+			t.Errorf("%s: got %d, want %d", path, w.Code, status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	New("site", Dir(filepath.Join(root, "missing")), Options{}).Serve(w, httptest.NewRequest(http.MethodGet, "/", nil), "/a.txt")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing directory: got %d", w.Code)
+	}
+}
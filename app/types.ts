@@ -3,12 +3,28 @@ export interface Project {
     name: string;
     desc: string;
     repo: string;
+    version: number;
     createdAt: string;
     updatedAt: string;
     media: Media[]
     links: Link[];
 }
 
+/**
+ * Listing page shape from the GraphQL endpoint,
+ * with only the media previews it shows
+ */
+export interface ProjectSummary {
+    id: number;
+    name: string;
+    desc: string;
+    repo: string;
+    mediaCount: number;
+    photos: Media[];
+    videos: Media[];
+    links: Link[];
+}
+
 export interface Media {
     id: number;
     projectId: number;
@@ -32,6 +48,74 @@ export interface CreateProjectRequest {
     links: { name: string; url: string }[];
 }
 
+export interface BulkOperation {
+    op: 'create' | 'update' | 'delete';
+    id?: number;
+    version?: number;
+    data?: CreateProjectRequest;
+}
+
+export interface BulkRequest {
+    mode?: 'atomic' | 'best_effort';
+    operations: BulkOperation[];
+}
+
+export interface BulkResult {
+    index: number;
+    op: string;
+    id?: number;
+    status: number;
+    version?: number;
+    error?: { code: string; message: string; details?: any };
+}
+
+export interface BulkResponse {
+    mode: string;
+    succeeded: number;
+    failed: number;
+    results: BulkResult[];
+}
+
+export interface PatchOperation {
+    op: 'add' | 'remove' | 'replace' | 'test';
+    path: string;
+    value?: any;
+}
+
+export interface FieldError {
+    field: string;
+    code: string;
+    message: string;
+}
+
+export interface ApiErrorResponse {
+    code: string;
+    message: string;
+    details?: any;
+    requestId: string;
+}
+
+export interface LoginRequest {
+    username: string;
+    password: string;
+}
+
+export interface SessionResponse {
+    username: string;
+    expiresAt: string;
+}
+
+export interface GraphQLError {
+    message: string;
+    locations?: { line: number; column: number }[];
+    path?: (string | number)[];
+}
+
+export interface GraphQLResponse<T> {
+    data?: T | null;
+    errors?: GraphQLError[];
+}
+
 export interface WebSocketMessage {
     type: string;
     channel: string;
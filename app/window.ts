@@ -6,10 +6,21 @@ class Window {
         SERVER_WS: '',
         SERVER_URL: '',
         API_URL: '',
-        WEB_URL: ''
+        WEB_URL: '',
+        STATIC: false
     }
 
     init() {
+        // Static exports serve everything from the same origin, without a server
+        if(document.querySelector('meta[name="static-export"]')) {
+            this.vars.STATIC = true
+            this.vars.SERVER_WS=""
+            this.vars.SERVER_URL=""
+            this.vars.API_URL="/api"
+            this.vars.WEB_URL=location.origin
+            return
+        }
+
         if(this.vars.APP_ENV === 'prod') {
             this.vars.SERVER_ADDR=`0.0.0.0:${this.vars.PORT}`
             this.vars.SERVER_WS="wss://portfolio-server-npwe.onrender.com/ws"
@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Origins allowed to open a socket. Entries are exact origins such as
+// https://example.com, or patterns such as https://*.example.com that
+// match any subdomain.
+var (
+	originsMu      sync.RWMutex
+	allowedOrigins []string
+	rejected       = map[string]uint64{}
+)
+
+const maxRejectedOrigins = 100
+
+func SetAllowedOrigins(origins []string) {
+	clean := []string{}
+	for _, origin := range origins {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			clean = append(clean, strings.ToLower(origin))
+		}
+	}
+
+	originsMu.Lock()
+	allowedOrigins = clean
+	originsMu.Unlock()
+}
+
+func AllowedOrigins() []string {
+	originsMu.RLock()
+	defer originsMu.RUnlock()
+	return append([]string{}, allowedOrigins...)
+}
+
+// Requests without Origin do not come from a browser page, and a page
+// served by this host may always connect back to it
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	originsMu.Lock()
+	defer originsMu.Unlock()
+
+	if err == nil {
+		for _, allowed := range allowedOrigins {
+			if matchOrigin(allowed, u) {
+				return true
+			}
+		}
+	}
+
+	// Origin is whatever the client sends, so the tally stays bounded
+	if _, ok := rejected[origin]; !ok && len(rejected) >= maxRejectedOrigins {
+		origin = "other"
+	}
+	rejected[origin]++
+	log.Printf("Rejected WebSocket from origin %s to %s (%d so far)", origin, r.URL.Path, rejected[origin])
+	return false
+}
+
+// MatchOrigin reports whether origin fits an allowlist entry
+func MatchOrigin(pattern string, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && matchOrigin(strings.ToLower(strings.TrimSuffix(pattern, "/")), u)
+}
+
+func matchOrigin(pattern string, origin *url.URL) bool {
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok || !strings.EqualFold(scheme, origin.Scheme) {
+		return false
+	}
+
+	got := strings.ToLower(origin.Host)
+	if suffix, ok := strings.CutPrefix(host, "*."); ok {
+		return strings.HasSuffix(got, "."+suffix)
+	}
+	return got == host
+}
+
+type RejectedOrigin struct {
+	Origin string
+	Count  uint64
+}
+
+// Rejected origins, most attempts first
+func RejectedOrigins() []RejectedOrigin {
+	originsMu.RLock()
+	defer originsMu.RUnlock()
+
+	out := make([]RejectedOrigin, 0, len(rejected))
+	for origin, count := range rejected {
+		out = append(out, RejectedOrigin{Origin: origin, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
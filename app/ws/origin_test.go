@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		ok      bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com/", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com:8443", "https://example.com:8443", true},
+		{"https://example.com", "https://www.example.com", false},
+		{"https://*.example.com", "https://www.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://badexample.com", false},
+		{"https://*.example.com", "https://example.com.evil.net", false},
+		{"example.com", "https://example.com", false},
+		{"https://example.com", "null", false},
+		{"https://example.com", "%zz", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchOrigin(tt.pattern, tt.origin); got != tt.ok {
+			t.Errorf("%q against %q: got %v, want %v", tt.origin, tt.pattern, got, tt.ok)
+		}
+	}
+}
+
+func TestSetAllowedOrigins(t *testing.T) {
+	defer SetAllowedOrigins(nil)
+
+	SetAllowedOrigins([]string{" https://Example.com/ ", "", "https://*.example.org"})
+	got := AllowedOrigins()
+	if len(got) != 2 || got[0] != "https://example.com" || got[1] != "https://*.example.org" {
+		t.Errorf("got %q", got)
+	}
+	got[0] = "changed"
+	if AllowedOrigins()[0] != "https://example.com" {
+		t.Error("allowlist shares its slice")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	defer SetAllowedOrigins(nil)
+	defer func() { rejected = map[string]uint64{} }()
+	SetAllowedOrigins([]string{"https://*.example.org"})
+	rejected = map[string]uint64{}
+
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"http://localhost:3000", true},
+		{"https://LOCALHOST:3000", true},
+		{"https://app.example.org", true},
+		{"https://evil.example", false},
+		{"https://evil.example", false},
+		{"http://localhost:3001", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:3000/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(r); got != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.origin, got, tt.ok)
+		}
+	}
+
+	got := RejectedOrigins()
+	if len(got) != 2 || got[0] != (RejectedOrigin{Origin: "https://evil.example", Count: 2}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+// Clients choose the Origin header, so the tally cannot grow unbounded
+func TestRejectedOriginsBounded(t *testing.T) {
+	defer func() { rejected = map[string]uint64{} }()
+	rejected = map[string]uint64{}
+
+	for i := 0; i < maxRejectedOrigins+20; i++ {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:3000/ws", nil)
+		r.Header.Set("Origin", "https://"+strconv.Itoa(i)+".example")
+		checkOrigin(r)
+	}
+
+	got := RejectedOrigins()
+	if len(got) != maxRejectedOrigins+1 || got[0] != (RejectedOrigin{Origin: "other", Count: 20}) {
+		t.Errorf("got %d origins, first %+v", len(got), got[0])
+	}
+}
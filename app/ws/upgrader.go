@@ -2,7 +2,6 @@ package ws
 
 import (
 	"main/server"
-	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -10,11 +9,9 @@ import (
 
 var (
 	Upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		CheckOrigin:      checkOrigin,
 		HandshakeTimeout: 10 * time.Second,
 	}
 	s *server.Server
@@ -1,6 +1,6 @@
 @echo off
 cd /d "%~dp0app"
 
-go run .
+go run . -dev
 
 pause